@@ -4,14 +4,18 @@ import (
 	"context"
 	"eventify/auth/internal/config"
 	"eventify/auth/internal/handler"
+	"eventify/auth/internal/password"
 	"eventify/auth/internal/repository"
 	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"eventify/common/kafka"
 	"eventify/common/logger"
 	"eventify/common/postgres"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -31,9 +35,42 @@ func main() {
 	}
 
 	router := gin.Default()
+	if err = router.SetTrustedProxies(cfg.Auth.TrustedProxies); err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "invalid trusted proxies", zap.Error(err))
+	}
 	authRepo := repository.NewAuthRepository(pool)
-	authService := service.NewAuthService(authRepo, cfg.Auth.SecretKey)
-	authHandler := handler.NewAuthHandler(authService, router)
+
+	producer := kafka.NewProducer([]string{"kafka:9092"}, "events")
+	defer producer.Close()
+
+	keys, err := jwt.LoadKeyRing(cfg.Auth.KeysDir, cfg.Auth.ActiveKID)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "failed to load signing keys", zap.Error(err))
+	}
+
+	passwords, err := password.FromConfig(cfg.Auth.Password)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "invalid password hashing config", zap.Error(err))
+	}
+	policy, err := password.NewPolicy(cfg.Auth.Password)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "failed to load password policy", zap.Error(err))
+	}
+
+	denylist := jwt.NewDenylist()
+	authService := service.NewAuthService(authRepo, producer, denylist, keys.Active(), passwords, policy, cfg.Auth)
+	if err = authService.LoadRevokedTokens(ctx); err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "failed to load revoked tokens", zap.Error(err))
+	}
+
+	// у каждого экземпляра своя группа, чтобы отзывы токенов доходили до всех экземпляров
+	hostname, _ := os.Hostname()
+	revocations := kafka.NewConsumer([]string{"kafka:9092"}, "events", "auth-service-denylist-"+hostname)
+	defer revocations.Close()
+	go revocations.StartListening(ctx, denylist.HandleMessage)
+	go authService.RunSweeper(ctx, cfg.Auth.SweepInterval)
+
+	authHandler := handler.NewAuthHandler(authService, router, keys, denylist, cfg.Auth.ServiceToken)
 
 	authHandler.RegisterRoutes()
 
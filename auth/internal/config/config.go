@@ -4,12 +4,83 @@ import (
 	"eventify/common/postgres"
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"time"
 )
 
 type AuthConfig struct {
-	Port          int    `yaml:"port" env:"PORT"`
-	MigrationPath string `yaml:"migration-path" env:"MIGRATION_PATH"`
-	SecretKey     string `yaml:"secret-key" env:"SECRET_KEY" env-default:"your-secret-key"`
+	Port            int           `yaml:"port" env:"PORT"`
+	MigrationPath   string        `yaml:"migration-path" env:"MIGRATION_PATH"`
+	KeysDir         string        `yaml:"keys-dir" env:"KEYS_DIR" env-default:"configs/keys"`
+	ActiveKID       string        `yaml:"active-kid" env:"ACTIVE_KID"`
+	AccessTokenTTL  time.Duration `yaml:"access-token-ttl" env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh-token-ttl" env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+	ResetTokenTTL   time.Duration `yaml:"reset-token-ttl" env:"RESET_TOKEN_TTL" env-default:"1h"`
+	ResetURL        string        `yaml:"reset-url" env:"RESET_URL" env-default:"http://localhost:3000/reset-password"`
+	VerifyTokenTTL  time.Duration `yaml:"verify-token-ttl" env:"VERIFY_TOKEN_TTL" env-default:"48h"`
+	VerifyURL       string        `yaml:"verify-url" env:"VERIFY_URL" env-default:"http://localhost:8081/auth/verify"`
+	// RequireEmailVerification запрещает вход, пока email не подтвержден
+	RequireEmailVerification bool `yaml:"require-email-verification" env:"REQUIRE_EMAIL_VERIFICATION" env-default:"true"`
+
+	// MFATokenTTL сколько живет mfa_pending токен между проверкой пароля и вводом кода
+	MFATokenTTL time.Duration `yaml:"mfa-token-ttl" env:"MFA_TOKEN_TTL" env-default:"5m"`
+	// MFAIssuer название сервиса в приложении-аутентификаторе
+	MFAIssuer string `yaml:"mfa-issuer" env:"MFA_ISSUER" env-default:"Eventify"`
+
+	// ExportEventsURL и ExportInteractionsURL эндпоинты остальных сервисов, из которых собирается /auth/me/export
+	ExportEventsURL       string `yaml:"export-events-url" env:"EXPORT_EVENTS_URL" env-default:"http://event-service:8082/events/me/export"`
+	ExportInteractionsURL string `yaml:"export-interactions-url" env:"EXPORT_INTERACTIONS_URL" env-default:"http://userinteract-service:8083/user-interact/me/export"`
+
+	// TrustedProxies адреса или подсети прокси (nginx), которым верим в X-Forwarded-For и X-Real-IP.
+	// Пустой список — адрес клиента берется из соединения, иначе любой клиент подставит свой IP и обойдет блокировку
+	TrustedProxies []string `yaml:"trusted-proxies" env:"TRUSTED_PROXIES" env-separator:","`
+	// ServiceToken общий секрет, с которым остальные сервисы вызывают внутренние эндпоинты; пустой закрывает их
+	ServiceToken string `yaml:"service-token" env:"SERVICE_TOKEN"`
+
+	// SweepInterval как часто досылать события об удаленных аккаунтах, которые не ушли в kafka,
+	// и удалять истекшие коды авторизации OIDC
+	SweepInterval time.Duration `yaml:"sweep-interval" env:"SWEEP_INTERVAL" env-default:"1m"`
+
+	Lockout  LockoutConfig  `yaml:"lockout"`
+	OIDC     OIDCConfig     `yaml:"oidc"`
+	Password PasswordConfig `yaml:"password"`
+}
+
+// PasswordConfig хэширование паролей и требования к новым паролям
+type PasswordConfig struct {
+	// Algorithm argon2id или bcrypt; хэши другого алгоритма пересчитываются при входе
+	Algorithm string `yaml:"algorithm" env:"PASSWORD_ALGORITHM" env-default:"argon2id"`
+	// Argon2Memory в KiB, значения по умолчанию — рекомендация OWASP
+	Argon2Memory      uint32 `yaml:"argon2-memory" env:"PASSWORD_ARGON2_MEMORY" env-default:"19456"`
+	Argon2Iterations  uint32 `yaml:"argon2-iterations" env:"PASSWORD_ARGON2_ITERATIONS" env-default:"2"`
+	Argon2Parallelism uint8  `yaml:"argon2-parallelism" env:"PASSWORD_ARGON2_PARALLELISM" env-default:"1"`
+	BcryptCost        int    `yaml:"bcrypt-cost" env:"PASSWORD_BCRYPT_COST" env-default:"10"`
+
+	MinLength int `yaml:"min-length" env:"PASSWORD_MIN_LENGTH" env-default:"10"`
+	MaxLength int `yaml:"max-length" env:"PASSWORD_MAX_LENGTH" env-default:"128"`
+	// MinCharacterClasses сколько из классов (строчные, заглавные, цифры, символы) должно быть в пароле
+	MinCharacterClasses int `yaml:"min-character-classes" env:"PASSWORD_MIN_CHARACTER_CLASSES" env-default:"2"`
+	// BreachedPasswordsFile список утекших паролей, по одному в строке; пустая строка отключает проверку
+	BreachedPasswordsFile string `yaml:"breached-passwords-file" env:"PASSWORD_BREACHED_FILE" env-default:"configs/breached-passwords.txt"`
+}
+
+// OIDCConfig auth сервис как OpenID Connect провайдер для внутренних инструментов
+type OIDCConfig struct {
+	// Issuer внешний адрес auth сервиса, от него строятся адреса в discovery документе
+	Issuer  string        `yaml:"issuer" env:"OIDC_ISSUER" env-default:"http://localhost:8081"`
+	CodeTTL time.Duration `yaml:"code-ttl" env:"OIDC_CODE_TTL" env-default:"1m"`
+}
+
+// LockoutConfig защита /auth/login от перебора паролей
+type LockoutConfig struct {
+	// FreeAttempts неудачных попыток по одному логину до первой блокировки
+	FreeAttempts int `yaml:"free-attempts" env:"LOCKOUT_FREE_ATTEMPTS" env-default:"5"`
+	// IPFreeAttempts неудачных попыток с одного IP до первой блокировки
+	IPFreeAttempts int `yaml:"ip-free-attempts" env:"LOCKOUT_IP_FREE_ATTEMPTS" env-default:"50"`
+	// BaseDelay первая блокировка, каждая следующая вдвое дольше, но не больше MaxDelay
+	BaseDelay time.Duration `yaml:"base-delay" env:"LOCKOUT_BASE_DELAY" env-default:"30s"`
+	MaxDelay  time.Duration `yaml:"max-delay" env:"LOCKOUT_MAX_DELAY" env-default:"1h"`
+	// Window после стольких минут без неудач счетчик сбрасывается
+	Window time.Duration `yaml:"window" env:"LOCKOUT_WINDOW" env-default:"1h"`
 }
 
 type Config struct {
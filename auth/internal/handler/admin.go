@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ListUsersHandler список пользователей с поиском, фильтрами и постраничным выводом
+func (h *AuthHandler) ListUsersHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.service.ListUsers(ctx, filter)
+	if errors.Is(err, service.ErrInvalidUserFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, suspended or deleted"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *AuthHandler) SuspendUserHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	// причина необязательна
+	var req models.SuspendUserRequest
+	if c.Request.ContentLength > 0 {
+		if err = c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims, _ := jwt.ClaimsFromContext(c)
+	err = h.service.SuspendUser(ctx, userID, claims.UserId, req.Reason)
+	switch {
+	case errors.Is(err, service.ErrCannotSuspendSelf), errors.Is(err, service.ErrSuspendReasonTooLong):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserAlreadySuspended):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user suspended"})
+}
+
+func (h *AuthHandler) ReactivateUserHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	claims, _ := jwt.ClaimsFromContext(c)
+	err = h.service.ReactivateUser(ctx, userID, claims.UserId)
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotSuspended):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user reactivated"})
+}
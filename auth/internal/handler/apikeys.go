@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// CreateAPIKeyHandler выпускает API ключ; сам ключ есть только в этом ответе
+func (h *AuthHandler) CreateAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(ctx, claims.UserId, req)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *AuthHandler) ListAPIKeysHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	keys, err := h.service.ListAPIKeys(ctx, claims.UserId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (h *AuthHandler) RevokeAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key ID"})
+		return
+	}
+
+	err = h.service.RevokeAPIKey(ctx, claims.UserId, keyID)
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
+
+// IntrospectAPIKeyHandler проверяет ключ для остальных сервисов (jwt.APIKeyIntrospector)
+// и возвращает те же claims, что были бы в JWT
+func (h *AuthHandler) IntrospectAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.IntrospectAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := h.service.ResolveAPIKey(ctx, req.APIKey)
+	if errors.Is(err, jwt.ErrInvalidAPIKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, claims)
+}
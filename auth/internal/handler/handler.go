@@ -1,21 +1,36 @@
 package handler
 
 import (
-	"github.com/gin-gonic/gin"
-	"net/http"
+	"errors"
 	"eventify/auth/internal/models"
+	"eventify/auth/internal/password"
 	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
 )
 
+// длиннее user agent в сессии не сохраняется
+const maxUserAgentLength = 512
+
 type AuthHandler struct {
-	service *service.AuthService
-	router  *gin.Engine
+	service  *service.AuthService
+	router   *gin.Engine
+	keys     *jwt.KeyRing
+	denylist *jwt.Denylist
+	// serviceToken секрет для внутренних эндпоинтов, которые вызывают остальные сервисы
+	serviceToken string
 }
 
-func NewAuthHandler(service *service.AuthService, router *gin.Engine) *AuthHandler {
+func NewAuthHandler(service *service.AuthService, router *gin.Engine, keys *jwt.KeyRing, denylist *jwt.Denylist, serviceToken string) *AuthHandler {
 	return &AuthHandler{
-		service: service,
-		router:  router,
+		service:      service,
+		router:       router,
+		keys:         keys,
+		denylist:     denylist,
+		serviceToken: serviceToken,
 	}
 }
 func (h *AuthHandler) RegisterHandler(c *gin.Context) {
@@ -28,11 +43,16 @@ func (h *AuthHandler) RegisterHandler(c *gin.Context) {
 		return
 	}
 	err := h.service.RegisterUser(ctx, req)
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		writePolicyError(c, policyErr)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "User registered"})
+	c.JSON(http.StatusOK, gin.H{"message": "User registered, check your email to verify the address"})
 }
 
 func (h *AuthHandler) LoginHandler(c *gin.Context) {
@@ -42,17 +62,432 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	token, err := h.service.LoginUser(ctx, req)
+	tokens, challenge, err := h.service.LoginUser(ctx, req, clientInfo(c))
+
+	var lockout *service.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		writeLockout(c, lockout)
+		return
+	case errors.Is(err, service.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrEmailNotVerified), errors.Is(err, service.ErrAccountSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// clientInfo адрес и user agent клиента для сессии и ограничения попыток входа.
+// X-Forwarded-For учитывается только от прокси из trusted-proxies
+func clientInfo(c *gin.Context) models.ClientInfo {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return models.ClientInfo{IP: c.ClientIP(), UserAgent: userAgent}
+}
+
+// writeLockout отвечает 429 и подсказывает клиенту, когда можно повторить попытку
+func writeLockout(c *gin.Context, lockout *service.LockoutError) {
+	c.Header("Retry-After", retryAfter(lockout))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": lockout.Error()})
+}
+
+// writePolicyError перечисляет все нарушенные правила, чтобы клиент показал их разом
+func writePolicyError(c *gin.Context, policyErr *password.PolicyError) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "password does not meet the policy",
+		"violations": policyErr.Violations,
+	})
+}
+
+func retryAfter(lockout *service.LockoutError) string {
+	return strconv.Itoa(int(time.Until(lockout.Until).Seconds()) + 1)
+}
+
+// RefreshHandler обменивает refresh токен на новую пару токенов
+func (h *AuthHandler) RefreshHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.service.RefreshTokens(ctx, req.RefreshToken, clientInfo(c))
+	if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrAccountSuspended) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LogoutHandler отзывает токен, с которым пришел запрос
+func (h *AuthHandler) LogoutHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// тело необязательно: без refresh токена отзывается только access токен
+	var req models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims, _ := jwt.ClaimsFromContext(c)
+	if err := h.service.Logout(ctx, claims, req.RefreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// VerifyEmailHandler подтверждает email по ссылке из письма
+func (h *AuthHandler) VerifyEmailHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	err := h.service.VerifyEmail(ctx, token)
+	if errors.Is(err, service.ErrInvalidVerifyToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// ResendVerificationHandler повторно отправляет ссылку подтверждения
+func (h *AuthHandler) ResendVerificationHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.ResendVerification(ctx, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists and is not verified, a verification link has been sent"})
+}
+
+// ForgotPasswordHandler отправляет ссылку на сброс пароля, ответ не зависит от того, существует ли пользователь
+func (h *AuthHandler) ForgotPasswordHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(ctx, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a password reset link has been sent"})
+}
+
+// ResetPasswordHandler устанавливает новый пароль по токену из письма
+func (h *AuthHandler) ResetPasswordHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.ResetPassword(ctx, req.Token, req.Password)
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		writePolicyError(c, policyErr)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+}
+
+// ChangeRoleHandler назначает роль пользователю, требует права user:manage
+func (h *AuthHandler) ChangeRoleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req models.ChangeRoleRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, _ := jwt.ClaimsFromContext(c)
+	err = h.service.ChangeUserRole(ctx, userID, req.Role, claims.UserId)
+	switch {
+	case errors.Is(err, service.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "role updated"})
+}
+
+// GetMeHandler профиль текущего пользователя
+func (h *AuthHandler) GetMeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var profile models.Profile
+	err := h.service.GetProfile(ctx, claims.UserId, &profile)
+	if errors.Is(err, service.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateMeHandler частично обновляет профиль текущего пользователя
+func (h *AuthHandler) UpdateMeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var profile models.Profile
+	err := h.service.UpdateProfile(ctx, claims.UserId, req, &profile)
+	switch {
+	case errors.Is(err, service.ErrInvalidProfile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetUserHandler публичный профиль пользователя
+func (h *AuthHandler) GetUserHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var profile models.PublicProfile
+	err = h.service.GetPublicProfile(ctx, userID, &profile)
+	if errors.Is(err, service.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteMeHandler удаляет аккаунт текущего пользователя
+func (h *AuthHandler) DeleteMeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	err := h.service.DeleteAccount(ctx, claims, req)
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "account deleted"})
+}
+
+// ExportMeHandler отдает архив всех данных пользователя одним JSON файлом
+func (h *AuthHandler) ExportMeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	export, err := h.service.ExportData(ctx, claims, c.GetHeader("Authorization"))
+	switch {
+	case errors.Is(err, service.ErrExportUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="eventify-export.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// JWKSHandler отдает открытые ключи, которыми остальные сервисы проверяют токены
+func (h *AuthHandler) JWKSHandler(c *gin.Context) {
+	set, err := h.keys.JWKS()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+// RevocationsHandler действующие отзывы токенов для denylist остальных сервисов при их старте
+func (h *AuthHandler) RevocationsHandler(c *gin.Context) {
+	revoked, err := h.service.ActiveRevocations(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, revoked)
 }
 
 func (h *AuthHandler) RegisterRoutes() {
+	h.router.GET("/.well-known/jwks.json", h.JWKSHandler)
+
 	auth := h.router.Group("/auth")
 	auth.POST("/register", h.RegisterHandler)
 	auth.POST("/login", h.LoginHandler)
+	auth.POST("/login/mfa", h.MFALoginHandler)
+	auth.POST("/refresh", h.RefreshHandler)
+	auth.POST("/logout", jwt.AuthMiddleware(h.keys, h.denylist, nil), h.LogoutHandler)
+	auth.GET("/verify", h.VerifyEmailHandler)
+	auth.POST("/verify/resend", h.ResendVerificationHandler)
+	auth.POST("/password/forgot", h.ForgotPasswordHandler)
+	auth.POST("/password/reset", h.ResetPasswordHandler)
+	auth.GET("/revocations", jwt.RequireServiceToken(h.serviceToken), h.RevocationsHandler)
+
+	// профиль
+	me := auth.Group("/me")
+	me.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil))
+	me.GET("", h.GetMeHandler)
+	me.PATCH("", h.UpdateMeHandler)
+	me.DELETE("", h.DeleteMeHandler)
+	me.GET("/export", h.ExportMeHandler)
+
+	h.router.GET("/users/:id", h.GetUserHandler)
+
+	// управление ролями
+	admin := auth.Group("/users")
+	admin.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil), jwt.RequirePermission(jwt.PermUserManage))
+	admin.PUT("/:id/role", h.ChangeRoleHandler)
+
+	// справочник пользователей для администраторов
+	directory := auth.Group("/admin/users")
+	directory.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil), jwt.RequirePermission(jwt.PermUserManage))
+	directory.GET("", h.ListUsersHandler)
+	directory.POST("/:id/suspend", h.SuspendUserHandler)
+	directory.POST("/:id/reactivate", h.ReactivateUserHandler)
+
+	// двухфакторная аутентификация; enroll и verify доступны и с mfa_token, если роль требует MFA
+	mfa := auth.Group("/mfa")
+	mfa.POST("/totp/enroll", jwt.MFAPendingMiddleware(h.keys, h.denylist), h.EnrollTOTPHandler)
+	mfa.POST("/totp/verify", jwt.MFAPendingMiddleware(h.keys, h.denylist), h.VerifyTOTPHandler)
+	mfa.POST("/totp/disable", jwt.AuthMiddleware(h.keys, h.denylist, nil), h.DisableTOTPHandler)
+	mfa.POST("/recovery-codes", jwt.AuthMiddleware(h.keys, h.denylist, nil), h.RegenerateRecoveryCodesHandler)
+
+	roles := auth.Group("/roles")
+	roles.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil), jwt.RequirePermission(jwt.PermUserManage))
+	roles.PUT("/:role/mfa", h.SetRoleMFAHandler)
+
+	// API ключами управляют только с JWT, чтобы утекший ключ не мог выпускать новые
+	apiKeys := auth.Group("/api-keys")
+	// проверка ключа только для остальных сервисов, иначе по ней можно перебирать ключи
+	apiKeys.POST("/introspect", jwt.RequireServiceToken(h.serviceToken), h.IntrospectAPIKeyHandler)
+	apiKeys.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil))
+	apiKeys.POST("", h.CreateAPIKeyHandler)
+	apiKeys.GET("", h.ListAPIKeysHandler)
+	apiKeys.DELETE("/:id", h.RevokeAPIKeyHandler)
+
+	// активные входы пользователя
+	sessions := auth.Group("/sessions")
+	sessions.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil))
+	sessions.GET("", h.ListSessionsHandler)
+	sessions.DELETE("", h.RevokeOtherSessionsHandler)
+	sessions.DELETE("/:id", h.RevokeSessionHandler)
+
+	// OpenID Connect провайдер для внутренних инструментов
+	h.router.GET("/.well-known/openid-configuration", h.DiscoveryHandler)
+	oauth2 := h.router.Group("/oauth2")
+	oauth2.GET("/authorize", h.AuthorizeHandler)
+	oauth2.POST("/authorize", h.AuthorizeHandler)
+	oauth2.POST("/token", h.TokenHandler)
+	oauth2.GET("/userinfo", jwt.OIDCMiddleware(h.keys, h.denylist), h.UserInfoHandler)
+	oauth2.POST("/userinfo", jwt.OIDCMiddleware(h.keys, h.denylist), h.UserInfoHandler)
+
+	oidcClients := auth.Group("/admin/oidc-clients")
+	oidcClients.Use(jwt.AuthMiddleware(h.keys, h.denylist, nil), jwt.RequirePermission(jwt.PermUserManage))
+	oidcClients.POST("", h.CreateOIDCClientHandler)
+	oidcClients.GET("", h.ListOIDCClientsHandler)
+	oidcClients.DELETE("/:id", h.DeleteOIDCClientHandler)
 }
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// MFALoginHandler второй шаг входа: mfa_token из /auth/login и код из приложения или код восстановления
+func (h *AuthHandler) MFALoginHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := req.Code
+	if code == "" {
+		code = req.RecoveryCode
+	}
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	claims, err := jwt.ParseToken(req.MFAToken, h.keys)
+	if err != nil || !claims.MFAPending || h.denylist.Revoked(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrInvalidMFAToken.Error()})
+		return
+	}
+
+	tokens, err := h.service.CompleteMFALogin(ctx, claims, code, clientInfo(c))
+	var lockout *service.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		writeLockout(c, lockout)
+		return
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrAccountSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTOTPHandler выдает новый TOTP секрет и otpauth ссылку для QR кода
+func (h *AuthHandler) EnrollTOTPHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	resp, err := h.service.EnrollTOTP(ctx, claims)
+	if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// VerifyTOTPHandler включает MFA по первому коду из приложения
+func (h *AuthHandler) VerifyTOTPHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.VerifyTOTP(ctx, claims, req.Code, clientInfo(c))
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DisableTOTPHandler выключает MFA, нужен действующий код или код восстановления
+func (h *AuthHandler) DisableTOTPHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.DisableTOTP(ctx, claims, req.Code)
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMFARequiredByRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "mfa disabled"})
+}
+
+// RegenerateRecoveryCodesHandler заменяет коды восстановления новыми
+func (h *AuthHandler) RegenerateRecoveryCodesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(ctx, claims, req.Code)
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// SetRoleMFAHandler делает MFA обязательным или необязательным для роли, требует права user:manage
+func (h *AuthHandler) SetRoleMFAHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.RoleMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.SetRoleMFARequired(ctx, c.Param("role"), *req.Required)
+	if errors.Is(err, service.ErrUnknownRole) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"role": c.Param("role"), "mfa_required": *req.Required})
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"net/http"
+)
+
+// loginPage форма входа провайдера; параметры запроса авторизации передаются скрытыми полями
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Вход через Eventify</title>
+</head>
+<body>
+<h1>Вход в {{.Client}} через Eventify</h1>
+{{if .Error}}<p style="color: #b00020">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth2/authorize">
+<input type="hidden" name="response_type" value="{{.Req.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Req.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Req.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Req.Scope}}">
+<input type="hidden" name="state" value="{{.Req.State}}">
+<input type="hidden" name="nonce" value="{{.Req.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Req.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Req.CodeChallengeMethod}}">
+<p><label>Логин или email <input name="login" value="{{.Req.Login}}" autocomplete="username" required></label></p>
+<p><label>Пароль <input type="password" name="password" autocomplete="current-password" required></label></p>
+<p><label>Код MFA (если включен) <input name="code" autocomplete="one-time-code"></label></p>
+<p><button type="submit">Войти</button></p>
+</form>
+</body>
+</html>
+`))
+
+// AuthorizeHandler GET показывает форму входа, POST проверяет ее и отправляет пользователя обратно к клиенту с кодом
+func (h *AuthHandler) AuthorizeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// форму нельзя встраивать в чужие страницы
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+
+	client, err := h.service.CheckAuthorizeRequest(ctx, req)
+	if errors.Is(err, service.ErrInvalidOIDCClient) || errors.Is(err, service.ErrInvalidRedirectURI) {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.Redirect(http.StatusFound, service.AuthorizeErrorRedirect(req, oauthErr))
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if c.Request.Method == http.MethodGet {
+		h.renderLogin(c, http.StatusOK, client, req, "")
+		return
+	}
+
+	redirect, err := h.service.Authorize(ctx, req, clientInfo(c))
+	var lockout *service.LockoutError
+	switch {
+	case err == nil:
+		c.Redirect(http.StatusFound, redirect)
+	case errors.As(err, &lockout):
+		c.Header("Retry-After", retryAfter(lockout))
+		h.renderLogin(c, http.StatusTooManyRequests, client, req, lockout.Error())
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidMFACode),
+		errors.Is(err, service.ErrMFACodeRequired):
+		h.renderLogin(c, http.StatusUnauthorized, client, req, err.Error())
+	case errors.Is(err, service.ErrEmailNotVerified), errors.Is(err, service.ErrMFAEnrollmentNeeded),
+		errors.Is(err, service.ErrAccountSuspended):
+		h.renderLogin(c, http.StatusForbidden, client, req, err.Error())
+	default:
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *AuthHandler) renderLogin(c *gin.Context, status int, client models.OIDCClient, req models.AuthorizeRequest, message string) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	_ = loginPage.Execute(c.Writer, map[string]interface{}{
+		"Client": client.Name,
+		"Req":    req,
+		"Error":  message,
+	})
+}
+
+// TokenHandler обменивает код авторизации на токены. Клиент передает секрет через Basic или в теле запроса.
+func (h *AuthHandler) TokenHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Cache-Control", "no-store")
+
+	var req models.OIDCTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	tokens, err := h.service.ExchangeCode(ctx, req)
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := http.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// UserInfoHandler claims пользователя по access токену, выданному OIDC клиенту
+func (h *AuthHandler) UserInfoHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	info, err := h.service.UserInfo(ctx, claims)
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := http.StatusUnauthorized
+		if oauthErr.Code == "insufficient_scope" {
+			status = http.StatusForbidden
+		}
+		c.Header("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+func (h *AuthHandler) DiscoveryHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Discovery())
+}
+
+// CreateOIDCClientHandler регистрирует клиента; секрет есть только в этом ответе
+func (h *AuthHandler) CreateOIDCClientHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	var req models.CreateOIDCClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := h.service.CreateOIDCClient(ctx, claims.UserId, req)
+	if errors.Is(err, service.ErrInvalidClientConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, client)
+}
+
+func (h *AuthHandler) ListOIDCClientsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	clients, err := h.service.ListOIDCClients(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+func (h *AuthHandler) DeleteOIDCClientHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	err := h.service.DeleteOIDCClient(ctx, c.Param("id"))
+	if errors.Is(err, service.ErrOIDCClientNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "oidc client deleted"})
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"eventify/auth/internal/service"
+	"eventify/common/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ListSessionsHandler устройства, с которых пользователь сейчас залогинен
+func (h *AuthHandler) ListSessionsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	sessions, err := h.service.ListSessions(ctx, claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSessionHandler завершает одну сессию; ее токены перестают приниматься всеми сервисами
+func (h *AuthHandler) RevokeSessionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	err := h.service.RevokeSession(ctx, claims.UserId, c.Param("id"))
+	if errors.Is(err, service.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// RevokeOtherSessionsHandler выход на всех устройствах, кроме текущего
+func (h *AuthHandler) RevokeOtherSessionsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	revoked, err := h.service.RevokeOtherSessions(ctx, claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
@@ -1,14 +1,336 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Email    string `json:"email"`
 }
 
+// RegisterRequest роль при регистрации не принимается, ее назначает администратор
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Email    string `json:"email"`
-	Role     string `json:"role"`
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// MFALoginRequest второй шаг входа: код из приложения или один из кодов восстановления
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RoleMFARequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+// CreateAPIKeyRequest scopes — подмножество прав роли владельца; без expires_at ключ бессрочный
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type IntrospectAPIKeyRequest struct {
+	APIKey string `json:"api_key" binding:"required"`
+}
+
+// DeleteAccountRequest удаление аккаунта подтверждается паролем, а при включенном MFA еще и кодом
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+type TokenResp struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// MFAChallenge ответ /auth/login, когда для входа нужен второй фактор.
+// Если EnrollmentRequired, роль требует MFA, а пользователь его еще не настроил:
+// mfa_token подходит для /auth/mfa/totp/enroll и /auth/mfa/totp/verify.
+type MFAChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+type MFAEnrollResp struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFAVerifyResp коды восстановления показываются один раз. Tokens заполнен, если TOTP
+// подтверждался во время входа по mfa_token.
+type MFAVerifyResp struct {
+	RecoveryCodes []string   `json:"recovery_codes"`
+	Tokens        *TokenResp `json:"tokens,omitempty"`
+}
+
+// Profile профиль пользователя, который он видит сам через /auth/me
+type Profile struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	Bio         string    `json:"bio"`
+	Locale      string    `json:"locale"`
+	TimeZone    string    `json:"time_zone"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PublicProfile часть профиля, доступная всем
+type PublicProfile struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	Bio         string    `json:"bio"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UpdateProfileRequest частичное обновление профиля: nil поля не меняются
+type UpdateProfileRequest struct {
+	Username    *string `json:"username"`
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Bio         *string `json:"bio"`
+	Locale      *string `json:"locale"`
+	TimeZone    *string `json:"time_zone"`
+}
+
+type User struct {
+	ID            int
+	Username      string
+	Email         string
+	PasswordHash  string
+	Role          string
+	EmailVerified bool
+	Status        string
+}
+
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
+
+// APIKey персональный ключ без самого секрета: он показывается только при создании
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKey ответ на создание ключа, Key больше нигде не возвращается
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Session вход с одного устройства
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// ClientInfo откуда пришел запрос на вход или refresh
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// DeletedUser удаленный аккаунт, о котором еще не узнали остальные сервисы
+type DeletedUser struct {
+	ID           int
+	DeletedAt    time.Time
+	RevokeBefore time.Time
+}
+
+type RoleChange struct {
+	OldRole   string    `json:"old_role"`
+	NewRole   string    `json:"new_role"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// DataExport все, что платформа хранит о пользователе. Events и Interactions собираются
+// из event и user-interaction сервисов как есть.
+type DataExport struct {
+	ExportedAt   time.Time       `json:"exported_at"`
+	Account      Profile         `json:"account"`
+	MFAEnabled   bool            `json:"mfa_enabled"`
+	RoleChanges  []RoleChange    `json:"role_changes"`
+	Sessions     []Session       `json:"sessions"`
+	APIKeys      []APIKey        `json:"api_keys"`
+	Events       json.RawMessage `json:"events"`
+	Interactions json.RawMessage `json:"interactions"`
+}
+
+type MFA struct {
+	UserID       int
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// OIDCClient клиент OpenID Connect; секрет хранится только хэшем
+type OIDCClient struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type CreateOIDCClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required"`
+	// Public клиент без секрета (SPA, CLI), вход только с PKCE
+	Public bool `json:"public"`
+}
+
+// CreatedOIDCClient ответ на регистрацию клиента, секрет показывается один раз
+type CreatedOIDCClient struct {
+	OIDCClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AuthorizeRequest параметры /oauth2/authorize; при POST к ним добавляются поля формы входа
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+
+	Login    string `form:"login"`
+	Password string `form:"password"`
+	Code     string `form:"code"`
+}
+
+type OIDCTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+}
+
+type OIDCTokenResp struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// OIDCAuthCode выданный, но еще не обменянный код авторизации
+type OIDCAuthCode struct {
+	ClientID      string
+	UserID        int
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+}
+
+// статусы пользователя; deleted вычисляется по deleted_at и в базе в status не хранится
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusDeleted   = "deleted"
+)
+
+// AdminUser пользователь в списке для администратора
+type AdminUser struct {
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
+	// Status active, suspended или deleted
+	Status        string     `json:"status"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	SuspendReason string     `json:"suspend_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// UserFilter параметры GET /auth/admin/users
+type UserFilter struct {
+	Query         string     `form:"q"`
+	Role          string     `form:"role"`
+	Status        string     `form:"status"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02"`
+	Page          int        `form:"page"`
+	PageSize      int        `form:"page_size"`
+}
+
+type UserList struct {
+	Users    []AdminUser `json:"users"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
 }
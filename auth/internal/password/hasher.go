@@ -0,0 +1,61 @@
+package password
+
+import (
+	"eventify/auth/internal/config"
+	"fmt"
+)
+
+// Hasher один алгоритм хэширования паролей
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	// Recognizes сообщает, что хэш записан в формате этого алгоритма
+	Recognizes(encoded string) bool
+	// NeedsRehash true, если хэш сделан с параметрами слабее текущих
+	NeedsRehash(encoded string) bool
+}
+
+// Hashers новые пароли хэшируются основным алгоритмом, а старые хэши проверяются тем,
+// который их распознает. После успешной проверки старый хэш стоит пересчитать основным.
+type Hashers struct {
+	primary Hasher
+	all     []Hasher
+}
+
+func NewHashers(primary Hasher, legacy ...Hasher) *Hashers {
+	return &Hashers{primary: primary, all: append([]Hasher{primary}, legacy...)}
+}
+
+// FromConfig argon2id и bcrypt; основной выбирается в конфиге, второй остается для проверки старых хэшей
+func FromConfig(cfg config.PasswordConfig) (*Hashers, error) {
+	argon := NewArgon2id(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	bcrypt := NewBcrypt(cfg.BcryptCost)
+
+	switch cfg.Algorithm {
+	case "argon2id":
+		return NewHashers(argon, bcrypt), nil
+	case "bcrypt":
+		return NewHashers(bcrypt, argon), nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+}
+
+func (h *Hashers) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+// Verify проверяет пароль; rehash true, если пароль верный, но хэш пора пересчитать
+func (h *Hashers) Verify(encoded, password string) (ok, rehash bool, err error) {
+	for _, hasher := range h.all {
+		if !hasher.Recognizes(encoded) {
+			continue
+		}
+		ok, err = hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, hasher != h.primary || hasher.NeedsRehash(encoded), nil
+	}
+	return false, false, nil
+}
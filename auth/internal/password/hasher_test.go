@@ -0,0 +1,207 @@
+package password
+
+import (
+	"eventify/auth/internal/config"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// дешевые параметры, чтобы тесты не тратили время на хэширование
+var (
+	weakArgon    = NewArgon2id(64, 1, 1)
+	argon        = NewArgon2id(128, 2, 1)
+	weakBcrypt   = NewBcrypt(bcrypt.MinCost)
+	strongBcrypt = NewBcrypt(bcrypt.MinCost + 1)
+)
+
+func mustHash(t *testing.T, h Hasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+		prefix string
+	}{
+		{name: "argon2id", hasher: argon, prefix: "$argon2id$v=19$m=128,t=2,p=1$"},
+		{name: "bcrypt", hasher: strongBcrypt, prefix: "$2a$05$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := mustHash(t, tt.hasher, "correct-horse")
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("Hash() = %q, want prefix %q", encoded, tt.prefix)
+			}
+			if !tt.hasher.Recognizes(encoded) {
+				t.Errorf("Recognizes(%q) = false", encoded)
+			}
+			if tt.hasher.NeedsRehash(encoded) {
+				t.Errorf("NeedsRehash(%q) = true for current parameters", encoded)
+			}
+
+			for password, want := range map[string]bool{"correct-horse": true, "correct-horsE": false, "": false} {
+				ok, err := tt.hasher.Verify(encoded, password)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != want {
+					t.Errorf("Verify(%q) = %v, want %v", password, ok, want)
+				}
+			}
+
+			// соль случайная: одинаковые пароли дают разные хэши
+			if again := mustHash(t, tt.hasher, "correct-horse"); again == encoded {
+				t.Error("two hashes of the same password are equal")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	tests := []struct {
+		name    string
+		hasher  Hasher
+		encoded string
+		want    bool
+	}{
+		{name: "argon2id weaker memory", hasher: argon, encoded: mustHash(t, NewArgon2id(64, 2, 1), "x"), want: true},
+		{name: "argon2id weaker iterations", hasher: argon, encoded: mustHash(t, NewArgon2id(128, 1, 1), "x"), want: true},
+		{name: "argon2id stronger", hasher: weakArgon, encoded: mustHash(t, argon, "x"), want: false},
+		{name: "argon2id garbage", hasher: argon, encoded: "$argon2id$garbage", want: true},
+		{name: "bcrypt lower cost", hasher: strongBcrypt, encoded: mustHash(t, weakBcrypt, "x"), want: true},
+		{name: "bcrypt same cost", hasher: weakBcrypt, encoded: mustHash(t, weakBcrypt, "x"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgon2idErrors(t *testing.T) {
+	valid := mustHash(t, argon, "x")
+	parts := strings.Split(valid, "$")
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "empty", encoded: ""},
+		{name: "bcrypt hash", encoded: mustHash(t, weakBcrypt, "x")},
+		{name: "missing hash", encoded: strings.Join(parts[:5], "$")},
+		{name: "other algorithm", encoded: strings.Replace(valid, "$argon2id$", "$argon2i$", 1)},
+		{name: "other version", encoded: strings.Replace(valid, "$v=19$", "$v=16$", 1)},
+		{name: "bad parameters", encoded: strings.Replace(valid, "m=128,t=2,p=1", "m=128;t=2", 1)},
+		{name: "bad salt", encoded: strings.Join([]string{"", parts[1], parts[2], parts[3], "!!!", parts[5]}, "$")},
+		{name: "bad hash", encoded: strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], "!!!"}, "$")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := parseArgon2id(tt.encoded); err == nil {
+				t.Errorf("parseArgon2id(%q) succeeded", tt.encoded)
+			}
+			if ok, err := argon.Verify(tt.encoded, "x"); ok || err == nil {
+				t.Errorf("Verify(%q) = %v, %v; want false and an error", tt.encoded, ok, err)
+			}
+		})
+	}
+}
+
+func TestHashersVerify(t *testing.T) {
+	hashers := NewHashers(argon, strongBcrypt)
+
+	tests := []struct {
+		name       string
+		encoded    string
+		password   string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{name: "primary", encoded: mustHash(t, argon, "secret-1"), password: "secret-1", wantOK: true},
+		{name: "primary wrong password", encoded: mustHash(t, argon, "secret-1"), password: "secret-2"},
+		{name: "primary weaker parameters", encoded: mustHash(t, weakArgon, "secret-1"), password: "secret-1", wantOK: true, wantRehash: true},
+		// хэш старого алгоритма проверяется им и пересчитывается основным
+		{name: "legacy", encoded: mustHash(t, strongBcrypt, "secret-1"), password: "secret-1", wantOK: true, wantRehash: true},
+		{name: "legacy wrong password", encoded: mustHash(t, strongBcrypt, "secret-1"), password: "secret-2"},
+		{name: "unknown format", encoded: "plain:secret-1", password: "secret-1"},
+		{name: "empty hash of a deleted account", encoded: "", password: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := hashers.Verify(tt.encoded, tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("Verify() = %v, %v; want %v, %v", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+
+	encoded, err := hashers.Hash("secret-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !argon.Recognizes(encoded) {
+		t.Errorf("Hash() = %q, want the primary argon2id format", encoded)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := config.PasswordConfig{Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1, BcryptCost: bcrypt.MinCost}
+
+	tests := []struct {
+		algorithm string
+		primary   Hasher
+		wantErr   bool
+	}{
+		{algorithm: "argon2id", primary: weakArgon},
+		{algorithm: "bcrypt", primary: weakBcrypt},
+		{algorithm: "md5", wantErr: true},
+		{algorithm: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			cfg.Algorithm = tt.algorithm
+			hashers, err := FromConfig(cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FromConfig(%q) succeeded", tt.algorithm)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := hashers.Hash("secret-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.primary.Recognizes(encoded) {
+				t.Errorf("FromConfig(%q) hashes as %q", tt.algorithm, encoded)
+			}
+			// второй алгоритм остается для проверки старых хэшей
+			for _, h := range []Hasher{weakArgon, weakBcrypt} {
+				ok, _, err := hashers.Verify(mustHash(t, h, "secret-1"), "secret-1")
+				if err != nil || !ok {
+					t.Errorf("FromConfig(%q) does not verify %T hashes: %v, %v", tt.algorithm, h, ok, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package password
+
+import (
+	"bufio"
+	"eventify/auth/internal/config"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation одно нарушенное правило; Code стабилен и годится для перевода на клиенте
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError пароль не прошел политику, Violations перечисляет все нарушенные правила сразу
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// Policy требования к новым паролям; к паролям при входе не применяется
+type Policy struct {
+	minLength  int
+	maxLength  int
+	minClasses int
+	breached   map[string]struct{}
+}
+
+// NewPolicy читает список утекших паролей: по одному в строке, строки с # пропускаются
+func NewPolicy(cfg config.PasswordConfig) (*Policy, error) {
+	p := &Policy{
+		minLength:  cfg.MinLength,
+		maxLength:  cfg.MaxLength,
+		minClasses: cfg.MinCharacterClasses,
+		breached:   map[string]struct{}{},
+	}
+	if cfg.BreachedPasswordsFile == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(cfg.BreachedPasswordsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open breached passwords list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read breached passwords list: %w", err)
+	}
+	return p, nil
+}
+
+// Validate проверяет пароль. personal — username, email и другие данные пользователя,
+// которые не должны входить в пароль.
+func (p *Policy) Validate(password string, personal ...string) error {
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		add("too_short", "password must be at least %d characters", p.minLength)
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		add("too_long", "password must be at most %d characters", p.maxLength)
+	}
+	if classes := characterClasses(password); classes < p.minClasses {
+		add("too_few_character_classes",
+			"password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.minClasses)
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.breached[lower]; ok {
+		add("breached", "password is on the list of known leaked passwords")
+	}
+	for _, value := range personal {
+		// email сравнивается по части до @
+		value, _, _ = strings.Cut(strings.ToLower(value), "@")
+		if len(value) >= 3 && strings.Contains(lower, value) {
+			add("contains_personal_data", "password must not contain your username or email")
+			break
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
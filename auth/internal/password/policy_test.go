@@ -0,0 +1,149 @@
+package password
+
+import (
+	"errors"
+	"eventify/auth/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "# утекшие пароли\n\nPassword123\n  qwerty12345  \n"
+	if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(config.PasswordConfig{
+		MinLength:             10,
+		MaxLength:             20,
+		MinCharacterClasses:   2,
+		BreachedPasswordsFile: path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// codes коды нарушений в порядке проверки; nil, если пароль подходит
+func codes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("error %v is not a *PolicyError", err)
+	}
+	var result []string
+	for _, v := range policyErr.Violations {
+		result = append(result, v.Code)
+	}
+	return result
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p := newTestPolicy(t)
+
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		want     []string
+	}{
+		{name: "valid", password: "correct-horse"},
+		{name: "exactly min length", password: "abcdefghi1"},
+		{name: "exactly max length", password: "abcdefghij0123456789"},
+		{name: "too short", password: "abc123", want: []string{"too_short"}},
+		{name: "too long", password: "abcdefghij0123456789x", want: []string{"too_long"}},
+		// длина считается в символах, а не в байтах
+		{name: "cyrillic counted in runes", password: "пароль1234"},
+		{name: "one character class", password: "abcdefghijkl", want: []string{"too_few_character_classes"}},
+		{name: "all violations at once", password: "abc", want: []string{"too_short", "too_few_character_classes"}},
+		// список сравнивается без учета регистра, пробелы по краям строк файла отбрасываются
+		{name: "breached", password: "password123", want: []string{"breached"}},
+		{name: "breached with spaces in list", password: "QWERTY12345", want: []string{"breached"}},
+		{name: "comment is not a password", password: "# утекшие пароли"},
+		{
+			name:     "contains username",
+			password: "Ivan_Petrov-2025",
+			personal: []string{"ivan_petrov", "ivan@example.com"},
+			want:     []string{"contains_personal_data"},
+		},
+		{
+			// email сравнивается по части до @
+			name:     "contains email local part",
+			password: "my-mailbox-99",
+			personal: []string{"someone", "MailBox@example.com"},
+			want:     []string{"contains_personal_data"},
+		},
+		{
+			name:     "email domain is allowed",
+			password: "example-2025",
+			personal: []string{"someone", "ivan@example.com"},
+		},
+		{
+			// слишком короткие данные не проверяются
+			name:     "short username is ignored",
+			password: "al-password-1",
+			personal: []string{"al"},
+		},
+		{
+			name:     "personal data reported once",
+			password: "ivan-ivan-2025",
+			personal: []string{"ivan", "ivan@example.com"},
+			want:     []string{"contains_personal_data"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codes(t, p.Validate(tt.password, tt.personal...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%q, %q) violations = %v, want %v", tt.password, tt.personal, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyWithoutBreachedList(t *testing.T) {
+	p, err := NewPolicy(config.PasswordConfig{MinLength: 1, MinCharacterClasses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Validate("password123"); err != nil {
+		t.Errorf("Validate() = %v, want nil without a breached list", err)
+	}
+
+	_, err = NewPolicy(config.PasswordConfig{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	if err == nil {
+		t.Error("NewPolicy() with a missing file succeeded")
+	}
+}
+
+func TestCharacterClasses(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{password: "", want: 0},
+		{password: "abc", want: 1},
+		{password: "abcABC", want: 2},
+		{password: "abcABC123", want: 3},
+		{password: "abcABC123!", want: 4},
+		{password: "пароль", want: 1},
+		{password: "ПарольПароль", want: 2},
+		// пробел и эмодзи — символы
+		{password: "a 🎉", want: 2},
+	}
+
+	for _, tt := range tests {
+		if got := characterClasses(tt.password); got != tt.want {
+			t.Errorf("characterClasses(%q) = %d, want %d", tt.password, got, tt.want)
+		}
+	}
+}
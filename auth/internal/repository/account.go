@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"eventify/auth/internal/models"
+	"time"
+)
+
+// DeleteUser мягко удаляет аккаунт: строка остается, но без персональных данных, username и email
+// освобождаются, а все способы входа (сессии, refresh токены, API ключи, MFA, ссылки из писем) отзываются
+func (r *AuthRepository) DeleteUser(ctx context.Context, userID int, revokeBefore time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// счетчики неудачных входов хранят логин в ключе
+	if _, err = tx.Exec(ctx, `
+		DELETE FROM schema_name.login_failures l
+		USING schema_name.users u
+		WHERE u.id = $1 AND l.key IN ('login:' || lower(u.username), 'login:' || lower(u.email))`, userID); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE schema_name.users
+		SET deleted_at = now(),
+		    username = 'deleted-' || id,
+		    email = 'deleted-' || id || '@deleted.invalid',
+		    password_hash = '',
+		    email_verified_at = NULL,
+		    display_name = NULL,
+		    avatar_url = NULL,
+		    bio = NULL,
+		    locale = NULL,
+		    time_zone = NULL,
+		    tokens_valid_after = $2
+		WHERE id = $1 AND deleted_at IS NULL`, userID, revokeBefore)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	queries := []string{
+		`UPDATE schema_name.sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`UPDATE schema_name.refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`UPDATE schema_name.api_keys SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`DELETE FROM schema_name.mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM schema_name.user_mfa WHERE user_id = $1`,
+		`DELETE FROM schema_name.password_reset_tokens WHERE user_id = $1`,
+		`DELETE FROM schema_name.email_verification_tokens WHERE user_id = $1`,
+	}
+	for _, q := range queries {
+		if _, err = tx.Exec(ctx, q, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetUnpublishedDeletions удаленные аккаунты, события о которых еще не отправлены
+func (r *AuthRepository) GetUnpublishedDeletions(ctx context.Context, users *[]models.DeletedUser) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, deleted_at, tokens_valid_after
+		FROM schema_name.users
+		WHERE deleted_at IS NOT NULL AND deletion_published_at IS NULL
+		ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.DeletedUser
+		if err = rows.Scan(&u.ID, &u.DeletedAt, &u.RevokeBefore); err != nil {
+			return err
+		}
+		*users = append(*users, u)
+	}
+	return rows.Err()
+}
+
+// MarkDeletionPublished отмечает, что события об удалении аккаунта отправлены
+func (r *AuthRepository) MarkDeletionPublished(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE schema_name.users SET deletion_published_at = now()
+		WHERE id = $1 AND deletion_published_at IS NULL`, userID)
+	return err
+}
+
+// GetRoleChanges журнал смены ролей пользователя, от новых к старым
+func (r *AuthRepository) GetRoleChanges(ctx context.Context, userID int, changes *[]models.RoleChange) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT COALESCE(old_role, ''), new_role, created_at
+		FROM schema_name.role_changes
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.RoleChange
+		if err = rows.Scan(&c.OldRole, &c.NewRole, &c.ChangedAt); err != nil {
+			return err
+		}
+		*changes = append(*changes, c)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserAlreadySuspended = errors.New("user already suspended")
+	ErrUserNotSuspended     = errors.New("user is not suspended")
+)
+
+// ListUsers страница пользователей по фильтру, от новых к старым, и общее число подходящих
+func (r *AuthRepository) ListUsers(ctx context.Context, filter models.UserFilter, list *models.UserList) error {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Query != "" {
+		// % и _ в строке поиска ищутся буквально
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Query) + "%"
+		p := arg(pattern)
+		conditions = append(conditions, "(u.username ILIKE "+p+" OR u.email ILIKE "+p+")")
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "u.role = "+arg(filter.Role))
+	}
+	switch filter.Status {
+	case "":
+	case "deleted":
+		conditions = append(conditions, "u.deleted_at IS NOT NULL")
+	default:
+		conditions = append(conditions, "u.deleted_at IS NULL AND u.status = "+arg(filter.Status))
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "u.created_at >= "+arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "u.created_at < "+arg(*filter.CreatedBefore))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	if err := r.db.QueryRow(ctx, `SELECT count(*) FROM schema_name.users u `+where, args...).Scan(&list.Total); err != nil {
+		return fmt.Errorf("could not count users: %w", err)
+	}
+
+	query := `
+		SELECT u.id, u.username, u.email, COALESCE(u.role, ''), u.email_verified_at IS NOT NULL,
+		       m.enabled_at IS NOT NULL,
+		       CASE WHEN u.deleted_at IS NOT NULL THEN 'deleted' ELSE u.status END,
+		       u.suspended_at, COALESCE(u.suspend_reason, ''), u.created_at
+		FROM schema_name.users u
+		LEFT JOIN schema_name.user_mfa m ON m.user_id = u.id
+		` + where + `
+		ORDER BY u.created_at DESC, u.id DESC
+		LIMIT ` + arg(filter.PageSize) + ` OFFSET ` + arg((filter.Page-1)*filter.PageSize)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not list users: %w", err)
+	}
+	defer rows.Close()
+
+	list.Users = []models.AdminUser{}
+	for rows.Next() {
+		var u models.AdminUser
+		if err = rows.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.EmailVerified, &u.MFAEnabled,
+			&u.Status, &u.SuspendedAt, &u.SuspendReason, &u.CreatedAt); err != nil {
+			return err
+		}
+		list.Users = append(list.Users, u)
+	}
+	return rows.Err()
+}
+
+// SuspendUser приостанавливает пользователя: его токены, выпущенные до revokeBefore, перестают действовать,
+// а сессии и refresh токены отзываются. API ключи остаются и снова заработают после восстановления.
+func (r *AuthRepository) SuspendUser(ctx context.Context, userID, adminID int, reason string, revokeBefore time.Time, user *models.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = scanUser(tx.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM schema_name.users
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`, userID), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if user.Status == models.StatusSuspended {
+		return ErrUserAlreadySuspended
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.users
+		SET status = 'suspended', suspended_at = now(), suspended_by = $2, suspend_reason = NULLIF($3, ''),
+		    tokens_valid_after = $4
+		WHERE id = $1`, userID, adminID, reason, revokeBefore); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `UPDATE schema_name.sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `UPDATE schema_name.refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ReactivateUser снимает приостановку; войти пользователь сможет заново, старые сессии не возвращаются
+func (r *AuthRepository) ReactivateUser(ctx context.Context, userID int, user *models.User) error {
+	err := scanUser(r.db.QueryRow(ctx, `
+		UPDATE schema_name.users
+		SET status = 'active', suspended_at = NULL, suspended_by = NULL, suspend_reason = NULL
+		WHERE id = $1 AND deleted_at IS NULL AND status = 'suspended'
+		RETURNING `+userColumns, userID), user)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	var exists bool
+	if err = r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM schema_name.users WHERE id = $1 AND deleted_at IS NULL)`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	return ErrUserNotSuspended
+}
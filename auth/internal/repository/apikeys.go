@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+func (r *AuthRepository) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO schema_name.api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		key.UserID, key.Name, key.Prefix, keyHash, key.Scopes, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAPIKeys возвращает неотозванные ключи пользователя, в том числе истекшие
+func (r *AuthRepository) GetAPIKeys(ctx context.Context, userID int, keys *[]models.APIKey) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM schema_name.api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k models.APIKey
+		if err = rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scopes, &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt); err != nil {
+			return err
+		}
+		*keys = append(*keys, k)
+	}
+	return rows.Err()
+}
+
+// GetActiveAPIKey ищет неотозванный и не истекший ключ по хэшу. Ключи, выпущенные до отзыва
+// всех токенов пользователя (tokens_valid_after), тоже не действуют
+func (r *AuthRepository) GetActiveAPIKey(ctx context.Context, keyHash string, key *models.APIKey) error {
+	err := r.db.QueryRow(ctx, `
+		SELECT k.id, k.user_id, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at, k.created_at
+		FROM schema_name.api_keys k
+		JOIN schema_name.users u ON u.id = k.user_id
+		WHERE k.key_hash = $1
+		  AND k.revoked_at IS NULL
+		  AND (k.expires_at IS NULL OR k.expires_at > now())
+		  AND (u.tokens_valid_after IS NULL OR k.created_at >= u.tokens_valid_after)`, keyHash).Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+func (r *AuthRepository) TouchAPIKey(ctx context.Context, keyID int) error {
+	_, err := r.db.Exec(ctx, `UPDATE schema_name.api_keys SET last_used_at = now() WHERE id = $1`, keyID)
+	return err
+}
+
+// RevokeAPIKey отзывает ключ, только если он принадлежит userID
+func (r *AuthRepository) RevokeAPIKey(ctx context.Context, keyID, userID int) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE schema_name.api_keys
+		SET revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, keyID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrMFANotFound       = errors.New("mfa not configured")
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrRoleNotFound      = errors.New("role not found")
+)
+
+// GetMFA возвращает TOTP настройки пользователя, в том числе неподтвержденные
+func (r *AuthRepository) GetMFA(ctx context.Context, userID int, mfa *models.MFA) error {
+	err := r.db.QueryRow(ctx, `
+		SELECT user_id, secret, enabled_at IS NOT NULL, last_used_step
+		FROM schema_name.user_mfa
+		WHERE user_id = $1`, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMFANotFound
+	}
+	return err
+}
+
+// SaveMFASecret сохраняет новый неподтвержденный секрет. Включенный TOTP не перезаписывается.
+func (r *AuthRepository) SaveMFASecret(ctx context.Context, userID int, secret string) error {
+	tag, err := r.db.Exec(ctx, `
+		INSERT INTO schema_name.user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+		WHERE user_mfa.enabled_at IS NULL`, userID, secret)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableMFA подтверждает секрет и заменяет коды восстановления
+func (r *AuthRepository) EnableMFA(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE schema_name.user_mfa
+		SET enabled_at = now(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFANotFound
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep отмечает шаг TOTP использованным. false, если этот или более поздний шаг уже принимался.
+func (r *AuthRepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE schema_name.user_mfa
+		SET last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UseRecoveryCode гасит код восстановления. false, если кода нет или он уже использован.
+func (r *AuthRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE schema_name.mfa_recovery_codes
+		SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *AuthRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_name.mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO schema_name.mfa_recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])`, userID, codeHashes)
+	return err
+}
+
+// DeleteMFA выключает TOTP и удаляет коды восстановления
+func (r *AuthRepository) DeleteMFA(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `DELETE FROM schema_name.mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM schema_name.user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *AuthRepository) RoleRequiresMFA(ctx context.Context, role string, required *bool) error {
+	err := r.db.QueryRow(ctx, `SELECT mfa_required FROM schema_name.roles WHERE name = $1`, role).Scan(required)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRoleNotFound
+	}
+	return err
+}
+
+func (r *AuthRepository) SetRoleMFARequired(ctx context.Context, role string, required bool) error {
+	tag, err := r.db.Exec(ctx, `UPDATE schema_name.roles SET mfa_required = $2 WHERE name = $1`, role, required)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
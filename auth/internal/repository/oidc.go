@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrOIDCClientNotFound = errors.New("oidc client not found")
+	ErrAuthCodeNotFound   = errors.New("authorization code not found")
+)
+
+func (r *AuthRepository) CreateOIDCClient(ctx context.Context, client *models.OIDCClient, secretHash *string, createdBy int) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO schema_name.oidc_clients (id, name, secret_hash, redirect_uris, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`,
+		client.ID, client.Name, secretHash, client.RedirectURIs, createdBy,
+	).Scan(&client.CreatedAt)
+}
+
+// GetOIDCClient возвращает клиента и хэш его секрета (nil у публичных клиентов)
+func (r *AuthRepository) GetOIDCClient(ctx context.Context, clientID string, client *models.OIDCClient, secretHash **string) error {
+	err := r.db.QueryRow(ctx, `
+		SELECT id, name, redirect_uris, secret_hash IS NULL, created_at, secret_hash
+		FROM schema_name.oidc_clients
+		WHERE id = $1`, clientID).Scan(
+		&client.ID, &client.Name, &client.RedirectURIs, &client.Public, &client.CreatedAt, secretHash,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOIDCClientNotFound
+	}
+	return err
+}
+
+func (r *AuthRepository) GetOIDCClients(ctx context.Context, clients *[]models.OIDCClient) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, name, redirect_uris, secret_hash IS NULL, created_at
+		FROM schema_name.oidc_clients
+		ORDER BY created_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.OIDCClient
+		if err = rows.Scan(&c.ID, &c.Name, &c.RedirectURIs, &c.Public, &c.CreatedAt); err != nil {
+			return err
+		}
+		*clients = append(*clients, c)
+	}
+	return rows.Err()
+}
+
+func (r *AuthRepository) DeleteOIDCClient(ctx context.Context, clientID string) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM schema_name.oidc_clients WHERE id = $1`, clientID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOIDCClientNotFound
+	}
+	return nil
+}
+
+func (r *AuthRepository) CreateAuthCode(ctx context.Context, codeHash string, code models.OIDCAuthCode) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO schema_name.oidc_auth_codes
+		    (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		codeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.Nonce,
+		code.CodeChallenge, code.AuthTime, code.ExpiresAt,
+	)
+	return err
+}
+
+// UseAuthCode гасит код и возвращает его данные. Код действует один раз и только до expires_at.
+func (r *AuthRepository) UseAuthCode(ctx context.Context, codeHash string, code *models.OIDCAuthCode) error {
+	err := r.db.QueryRow(ctx, `
+		UPDATE schema_name.oidc_auth_codes
+		SET used_at = now()
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at`, codeHash).Scan(
+		&code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &code.Nonce,
+		&code.CodeChallenge, &code.AuthTime, &code.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAuthCodeNotFound
+	}
+	return err
+}
+
+// DeleteExpiredAuthCodes удаляет истекшие коды, в том числе уже использованные
+func (r *AuthRepository) DeleteExpiredAuthCodes(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM schema_name.oidc_auth_codes WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -3,9 +3,28 @@ package repository
 import (
 	"context"
 	"errors"
+	"eventify/auth/internal/models"
+	"eventify/common/jwt"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
 )
 
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+	ErrResetTokenNotFound   = errors.New("password reset token not found")
+
+	ErrVerificationTokenNotFound = errors.New("email verification token not found")
+	ErrUserNotFound              = errors.New("user not found")
+	ErrUsernameTaken             = errors.New("username already taken")
+)
+
+// код ошибки postgres unique_violation
+const uniqueViolation = "23505"
+
 type AuthRepository struct {
 	db *pgxpool.Pool
 }
@@ -28,8 +47,9 @@ func (r *AuthRepository) UserExists(ctx context.Context, username, email string)
 	return count > 0, nil
 }
 
-func (r *AuthRepository) CreateUser(ctx context.Context, username, email, hash, role string) error {
-	_, err := r.db.Exec(ctx, "INSERT INTO schema_name.users (username, email, password_hash, role) VALUES ($1, $2, $3, $4)", username, email, hash, role)
+// CreateUser создает пользователя и записывает его id в userID
+func (r *AuthRepository) CreateUser(ctx context.Context, username, email, hash, role string, userID *int) error {
+	err := r.db.QueryRow(ctx, "INSERT INTO schema_name.users (username, email, password_hash, role) VALUES ($1, $2, $3, $4) RETURNING id", username, email, hash, role).Scan(userID)
 
 	if err != nil {
 		return errors.New("could not create user")
@@ -37,22 +57,459 @@ func (r *AuthRepository) CreateUser(ctx context.Context, username, email, hash,
 	return nil
 }
 
-func (r *AuthRepository) GetUser(ctx context.Context, username string, hashedPassword *string, userId *int, role *string) error {
+// userColumns колонки, которые читает scanUser
+const userColumns = `id, username, email, password_hash, role, email_verified_at IS NOT NULL, status`
+
+func scanUser(row pgx.Row, user *models.User) error {
+	return row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.EmailVerified, &user.Status)
+}
+
+// GetUser ищет пользователя по username или email; удаленные аккаунты не находятся
+func (r *AuthRepository) GetUser(ctx context.Context, login string, user *models.User) error {
 	query := `
-		SELECT id, password_hash, role
+		SELECT ` + userColumns + `
 		FROM schema_name.users
-		WHERE username = $1 OR email = $1
+		WHERE (username = $1 OR email = $1) AND deleted_at IS NULL
 		LIMIT 1
 	`
 
-	// Выполняем запрос
-	row := r.db.QueryRow(ctx, query, username)
+	// Выполняем запрос и сканируем результат в переданную структуру
+	err := scanUser(r.db.QueryRow(ctx, query, login), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get user: %w", err)
+	}
+
+	return nil
+}
+
+func (r *AuthRepository) GetUserByID(ctx context.Context, userID int, user *models.User) error {
+	err := scanUser(r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM schema_name.users
+		WHERE id = $1 AND deleted_at IS NULL
+	`, userID), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get user: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken помечает токен oldHash использованным и выпускает вместо него newHash
+// в том же семействе, обновляя время и адрес последней активности сессии.
+// Если oldHash уже был ротирован, все семейство и его сессия отзываются.
+func (r *AuthRepository) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time, client models.ClientInfo, token *models.RefreshToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// блокируем строку, чтобы два параллельных refresh не ротировали один токен дважды
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, family_id, expires_at, rotated_at, revoked_at
+		FROM schema_name.refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`, oldHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.RotatedAt, &token.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// токен уже обменивали: кто-то использует украденную копию
+	if token.RotatedAt != nil {
+		if _, err = tx.Exec(ctx, `
+			UPDATE schema_name.refresh_tokens
+			SET revoked_at = now()
+			WHERE family_id = $1 AND revoked_at IS NULL`, token.FamilyID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx, `
+			UPDATE schema_name.sessions
+			SET revoked_at = now()
+			WHERE id = $1 AND revoked_at IS NULL`, token.FamilyID); err != nil {
+			return err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return ErrRefreshTokenNotFound
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE schema_name.refresh_tokens SET rotated_at = now() WHERE id = $1`, token.ID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO schema_name.refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		token.UserID, token.FamilyID, newHash, expiresAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.sessions
+		SET last_seen_at = now(), ip = $2, user_agent = $3
+		WHERE id = $1`, token.FamilyID, client.IP, client.UserAgent); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeToken сохраняет jti access токена в списке отозванных
+func (r *AuthRepository) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO schema_name.revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`,
+		jti, userID, expiresAt,
+	)
+	return err
+}
+
+// RevokeRefreshTokenFamily отзывает все refresh токены того же входа, что и tokenHash
+func (r *AuthRepository) RevokeRefreshTokenFamily(ctx context.Context, tokenHash string, userID int) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE schema_name.refresh_tokens
+		SET revoked_at = now()
+		WHERE revoked_at IS NULL AND family_id = (
+			SELECT family_id FROM schema_name.refresh_tokens
+			WHERE token_hash = $1 AND user_id = $2
+		)`, tokenHash, userID)
+	return err
+}
+
+// GetActiveRevokedTokens возвращает отозванные токены, срок действия которых еще не истек
+func (r *AuthRepository) GetActiveRevokedTokens(ctx context.Context, revoked *[]jwt.RevocationMessage) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT jti, user_id, expires_at
+		FROM schema_name.revoked_tokens
+		WHERE expires_at > now()`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m jwt.RevocationMessage
+		if err = rows.Scan(&m.JTI, &m.UserID, &m.ExpiresAt); err != nil {
+			return err
+		}
+		*revoked = append(*revoked, m)
+	}
+	return rows.Err()
+}
+
+// GetActiveUserRevocations возвращает пользователей, у которых отозваны все токены, выпущенные после since
+func (r *AuthRepository) GetActiveUserRevocations(ctx context.Context, since time.Time, revoked *[]jwt.RevocationMessage) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, tokens_valid_after
+		FROM schema_name.users
+		WHERE tokens_valid_after > $1`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			m            jwt.RevocationMessage
+			issuedBefore time.Time
+		)
+		if err = rows.Scan(&m.UserID, &issuedBefore); err != nil {
+			return err
+		}
+		m.IssuedBefore = &issuedBefore
+		*revoked = append(*revoked, m)
+	}
+	return rows.Err()
+}
+
+func (r *AuthRepository) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO schema_name.password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`,
+		userID, tokenHash, expiresAt,
+	)
+	return err
+}
+
+// GetUserByResetToken владелец действующего токена сброса; токен не гасится
+func (r *AuthRepository) GetUserByResetToken(ctx context.Context, tokenHash string, user *models.User) error {
+	err := scanUser(r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM schema_name.users
+		WHERE deleted_at IS NULL AND id = (
+			SELECT user_id FROM schema_name.password_reset_tokens
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now())
+	`, tokenHash), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrResetTokenNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get user: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword гасит токен сброса, меняет пароль и отзывает все сессии пользователя.
+// Токены, выпущенные раньше revokeBefore, перестают действовать.
+func (r *AuthRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string, revokeBefore time.Time, userID *int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// UPDATE ... RETURNING атомарно гасит токен: второй запрос с тем же токеном ничего не найдет
+	err = tx.QueryRow(ctx, `
+		UPDATE schema_name.password_reset_tokens
+		SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id`, tokenHash).Scan(userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrResetTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// остальные выданные ссылки на сброс тоже больше не нужны
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.password_reset_tokens
+		SET used_at = now()
+		WHERE user_id = $1 AND used_at IS NULL`, *userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.users
+		SET password_hash = $1, tokens_valid_after = $2
+		WHERE id = $3`, passwordHash, revokeBefore, *userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.sessions
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL`, *userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL`, *userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *AuthRepository) CreateEmailVerificationToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO schema_name.email_verification_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`,
+		userID, tokenHash, expiresAt,
+	)
+	return err
+}
 
-	// Сканируем результат в переданные указатели
-	err := row.Scan(userId, hashedPassword, role)
+// VerifyEmail гасит токен подтверждения и отмечает email пользователя подтвержденным
+func (r *AuthRepository) VerifyEmail(ctx context.Context, tokenHash string, userID *int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE schema_name.email_verification_tokens
+		SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id`, tokenHash).Scan(userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrVerificationTokenNotFound
+	}
 	if err != nil {
-		return errors.New("could not get user")
+		return err
 	}
 
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.users
+		SET email_verified_at = COALESCE(email_verified_at, now())
+		WHERE id = $1`, *userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ChangeUserRole меняет роль пользователя, пишет запись в журнал role_changes
+// и отзывает токены, выпущенные раньше revokeBefore, чтобы старая роль перестала действовать
+func (r *AuthRepository) ChangeUserRole(ctx context.Context, userID int, newRole string, changedBy int, revokeBefore time.Time, oldRole *string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `SELECT role FROM schema_name.users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, userID).Scan(oldRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.users
+		SET role = $1, tokens_valid_after = $2
+		WHERE id = $3`, newRole, revokeBefore, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO schema_name.role_changes (user_id, old_role, new_role, changed_by)
+		VALUES ($1, $2, $3, $4)`, userID, *oldRole, newRole, changedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *AuthRepository) RoleExists(ctx context.Context, role string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_name.roles WHERE name = $1)`, role).Scan(&exists)
+	return exists, err
+}
+
+// GetRolePermissions возвращает права роли; у неизвестной роли прав нет
+func (r *AuthRepository) GetRolePermissions(ctx context.Context, role string, permissions *[]string) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT permission
+		FROM schema_name.role_permissions
+		WHERE role = $1
+		ORDER BY permission`, role)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p string
+		if err = rows.Scan(&p); err != nil {
+			return err
+		}
+		*permissions = append(*permissions, p)
+	}
+	return rows.Err()
+}
+
+func (r *AuthRepository) GetProfile(ctx context.Context, userID int, p *models.Profile) error {
+	err := r.db.QueryRow(ctx, `
+		SELECT id, username, email, role,
+		       COALESCE(display_name, ''), COALESCE(avatar_url, ''), COALESCE(bio, ''),
+		       COALESCE(locale, ''), COALESCE(time_zone, ''), created_at
+		FROM schema_name.users
+		WHERE id = $1 AND deleted_at IS NULL`, userID).Scan(
+		&p.ID, &p.Username, &p.Email, &p.Role,
+		&p.DisplayName, &p.AvatarURL, &p.Bio,
+		&p.Locale, &p.TimeZone, &p.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// UpdateProfile меняет только переданные (не nil) поля профиля
+func (r *AuthRepository) UpdateProfile(ctx context.Context, userID int, req models.UpdateProfileRequest) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE schema_name.users
+		SET username = COALESCE($2, username),
+		    display_name = COALESCE($3, display_name),
+		    avatar_url = COALESCE($4, avatar_url),
+		    bio = COALESCE($5, bio),
+		    locale = COALESCE($6, locale),
+		    time_zone = COALESCE($7, time_zone)
+		WHERE id = $1 AND deleted_at IS NULL`,
+		userID, req.Username, req.DisplayName, req.AvatarURL, req.Bio, req.Locale, req.TimeZone,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
 	return nil
 }
+
+// GetLockedUntil возвращает самую позднюю из действующих блокировок по ключам keys
+func (r *AuthRepository) GetLockedUntil(ctx context.Context, keys []string, lockedUntil *time.Time) (bool, error) {
+	var until *time.Time
+	err := r.db.QueryRow(ctx, `
+		SELECT MAX(locked_until)
+		FROM schema_name.login_failures
+		WHERE key = ANY($1) AND locked_until > now()`, keys).Scan(&until)
+	if err != nil || until == nil {
+		return false, err
+	}
+	*lockedUntil = *until
+	return true, nil
+}
+
+// RegisterLoginFailure увеличивает счетчик неудач по ключу и возвращает его новое значение.
+// Если последняя неудача была раньше resetBefore, счет начинается заново.
+func (r *AuthRepository) RegisterLoginFailure(ctx context.Context, key string, resetBefore time.Time, failures *int) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO schema_name.login_failures (key, failures, last_failure_at)
+		VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+		        WHEN login_failures.last_failure_at < $2 THEN 1
+		        ELSE login_failures.failures + 1
+		    END,
+		    last_failure_at = now()
+		RETURNING failures`, key, resetBefore).Scan(failures)
+}
+
+func (r *AuthRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := r.db.Exec(ctx, `UPDATE schema_name.login_failures SET locked_until = $2 WHERE key = $1`, key, until)
+	return err
+}
+
+func (r *AuthRepository) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM schema_name.login_failures WHERE key = $1`, key)
+	return err
+}
+
+// UpdatePasswordHash заменяет хэш, только если он не поменялся с момента чтения,
+// чтобы пересчет хэша при входе не затер одновременный сброс пароля
+func (r *AuthRepository) UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE schema_name.users
+		SET password_hash = $3
+		WHERE id = $1 AND password_hash = $2`, userID, oldHash, newHash)
+	return err
+}
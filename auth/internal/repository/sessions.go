@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/common/jwt"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession начинает сессию и выпускает ее первый refresh токен; family_id токена равен id сессии
+func (r *AuthRepository) CreateSession(ctx context.Context, userID int, session models.Session, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO schema_name.sessions (id, user_id, user_agent, ip)
+		VALUES ($1, $2, $3, $4)`,
+		session.ID, userID, session.UserAgent, session.IP,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO schema_name.refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		userID, session.ID, tokenHash, expiresAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetActiveSessions возвращает сессии, в которых еще есть действующий refresh токен
+func (r *AuthRepository) GetActiveSessions(ctx context.Context, userID int, sessions *[]models.Session) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT s.id, s.user_agent, s.ip, s.created_at, s.last_seen_at
+		FROM schema_name.sessions s
+		WHERE s.user_id = $1
+		  AND s.revoked_at IS NULL
+		  AND EXISTS (
+		      SELECT 1 FROM schema_name.refresh_tokens t
+		      WHERE t.family_id = s.id
+		        AND t.revoked_at IS NULL
+		        AND t.rotated_at IS NULL
+		        AND t.expires_at > now()
+		  )
+		ORDER BY s.last_seen_at DESC`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Session
+		if err = rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return err
+		}
+		*sessions = append(*sessions, s)
+	}
+	return rows.Err()
+}
+
+// RevokeSessions отзывает сессии пользователя и их refresh токены. Если sessionID пуст, отзываются все сессии,
+// кроме keepID. В revoked записываются id действительно отозванных сессий.
+func (r *AuthRepository) RevokeSessions(ctx context.Context, userID int, sessionID, keepID string, revoked *[]string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE schema_name.sessions
+		SET revoked_at = now()
+		WHERE user_id = $1
+		  AND revoked_at IS NULL
+		  AND ($2 = '' OR id = $2)
+		  AND id <> $3
+		RETURNING id`, userID, sessionID, keepID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		*revoked = append(*revoked, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// refresh токены входов, сделанных до появления сессий, тоже относятся к "остальным"
+	if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1
+		  AND revoked_at IS NULL
+		  AND ($2 = '' OR family_id = $2)
+		  AND family_id <> $3`, userID, sessionID, keepID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetActiveSessionRevocations возвращает сессии, отозванные после since
+func (r *AuthRepository) GetActiveSessionRevocations(ctx context.Context, since time.Time, revoked *[]jwt.RevocationMessage) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, revoked_at
+		FROM schema_name.sessions
+		WHERE revoked_at > $1`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m jwt.RevocationMessage
+		if err = rows.Scan(&m.SessionID, &m.UserID, &m.ExpiresAt); err != nil {
+			return err
+		}
+		*revoked = append(*revoked, m)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/repository"
+	"eventify/common/jwt"
+	"eventify/common/kafka"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+var ErrExportUnavailable = errors.New("could not collect data from other services")
+
+// DeleteAccount удаляет аккаунт после проверки пароля (и кода, если включен MFA), отзывает все токены
+// и публикует user.deleted, по которому остальные сервисы удаляют или обезличивают данные пользователя
+func (s *AuthService) DeleteAccount(ctx context.Context, claims *jwt.CustomClaims, req models.DeleteAccountRequest) error {
+	var user models.User
+	err := s.repo.GetUserByID(ctx, claims.UserId, &user)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	ok, _, err := s.passwords.Verify(user.PasswordHash, req.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	var mfa models.MFA
+	err = s.repo.GetMFA(ctx, user.ID, &mfa)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		return err
+	}
+	if err == nil && mfa.Enabled {
+		if err = s.requireSecondFactor(ctx, user.ID, req.Code); err != nil {
+			return err
+		}
+	}
+
+	revokeBefore := time.Now().Truncate(time.Second)
+	if err = s.repo.DeleteUser(ctx, user.ID, revokeBefore); err != nil {
+		return err
+	}
+
+	// аккаунт уже удален: повтор запроса получит 404, поэтому неотправленные события досылает RunSweeper
+	if err = s.publishDeletion(ctx, models.DeletedUser{ID: user.ID, DeletedAt: revokeBefore, RevokeBefore: revokeBefore}); err != nil {
+		log.Printf("failed to publish deletion of user %d, will retry: %v", user.ID, err)
+	}
+	return nil
+}
+
+// PublishPendingDeletions досылает события об удаленных аккаунтах, которые не ушли в kafka
+func (s *AuthService) PublishPendingDeletions(ctx context.Context) error {
+	var users []models.DeletedUser
+	if err := s.repo.GetUnpublishedDeletions(ctx, &users); err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := s.publishDeletion(ctx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishDeletion отзывает токены удаленного пользователя во всех сервисах, публикует user.deleted
+// и отмечает, что события отправлены. Повторная отправка безопасна.
+func (s *AuthService) publishDeletion(ctx context.Context, user models.DeletedUser) error {
+	if err := s.publishRevocation(ctx, jwt.RevocationMessage{
+		UserID:       user.ID,
+		IssuedBefore: &user.RevokeBefore,
+		ExpiresAt:    time.Now().Add(s.accessTTL),
+	}); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":    user.ID,
+		"deleted_at": user.DeletedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if err = s.producer.SendMessage(ctx, kafka.UserDeleted, payload); err != nil {
+		return err
+	}
+	return s.repo.MarkDeletionPublished(ctx, user.ID)
+}
+
+// RunSweeper раз в interval досылает неотправленные события и удаляет истекшие коды авторизации OIDC,
+// пока не отменен ctx
+func (s *AuthService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.PublishPendingDeletions(ctx); err != nil {
+				log.Printf("failed to publish pending deletions: %v", err)
+			}
+			if _, err := s.repo.DeleteExpiredAuthCodes(ctx); err != nil {
+				log.Printf("failed to delete expired authorization codes: %v", err)
+			}
+		}
+	}
+}
+
+// ExportData собирает все данные пользователя. authorization — заголовок исходного запроса,
+// с ним event и user-interaction сервисы отдают данные того же пользователя.
+func (s *AuthService) ExportData(ctx context.Context, claims *jwt.CustomClaims, authorization string) (models.DataExport, error) {
+	export := models.DataExport{ExportedAt: time.Now().UTC()}
+
+	if err := s.GetProfile(ctx, claims.UserId, &export.Account); err != nil {
+		return models.DataExport{}, err
+	}
+
+	var mfa models.MFA
+	err := s.repo.GetMFA(ctx, claims.UserId, &mfa)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		return models.DataExport{}, err
+	}
+	export.MFAEnabled = err == nil && mfa.Enabled
+
+	export.RoleChanges = []models.RoleChange{}
+	if err = s.repo.GetRoleChanges(ctx, claims.UserId, &export.RoleChanges); err != nil {
+		return models.DataExport{}, err
+	}
+	if export.Sessions, err = s.ListSessions(ctx, claims); err != nil {
+		return models.DataExport{}, err
+	}
+	if export.APIKeys, err = s.ListAPIKeys(ctx, claims.UserId); err != nil {
+		return models.DataExport{}, err
+	}
+
+	if export.Events, err = s.fetchExport(ctx, s.exportEventsURL, authorization); err != nil {
+		return models.DataExport{}, err
+	}
+	if export.Interactions, err = s.fetchExport(ctx, s.exportInteractionsURL, authorization); err != nil {
+		return models.DataExport{}, err
+	}
+
+	return export, nil
+}
+
+// fetchExport забирает часть выгрузки из другого сервиса от имени пользователя
+func (s *AuthService) fetchExport(ctx context.Context, url, authorization string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExportUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %d", ErrExportUnavailable, url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExportUnavailable, err)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%w: %s returned invalid JSON", ErrExportUnavailable, url)
+	}
+	return body, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/repository"
+	"eventify/common/jwt"
+	"eventify/common/kafka"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrAccountSuspended     = errors.New("account suspended")
+	ErrCannotSuspendSelf    = errors.New("you cannot suspend your own account")
+	ErrUserAlreadySuspended = errors.New("user already suspended")
+	ErrUserNotSuspended     = errors.New("user is not suspended")
+	ErrInvalidUserFilter    = errors.New("invalid user filter")
+	ErrSuspendReasonTooLong = errors.New("suspend reason must be at most 500 characters")
+)
+
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+	maxSuspendReasonLen  = 500
+)
+
+// ListUsers список пользователей для администратора с поиском по username и email
+func (s *AuthService) ListUsers(ctx context.Context, filter models.UserFilter) (models.UserList, error) {
+	switch filter.Status {
+	case "", models.StatusActive, models.StatusSuspended, models.StatusDeleted:
+	default:
+		return models.UserList{}, ErrInvalidUserFilter
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = defaultUsersPageSize
+	}
+	if filter.PageSize > maxUsersPageSize {
+		filter.PageSize = maxUsersPageSize
+	}
+
+	list := models.UserList{Page: filter.Page, PageSize: filter.PageSize}
+	if err := s.repo.ListUsers(ctx, filter, &list); err != nil {
+		return models.UserList{}, err
+	}
+	return list, nil
+}
+
+// SuspendUser приостанавливает пользователя: вход запрещается, все его токены отзываются
+// во всех сервисах, API ключи перестают приниматься.
+func (s *AuthService) SuspendUser(ctx context.Context, userID, adminID int, reason string) error {
+	if userID == adminID {
+		return ErrCannotSuspendSelf
+	}
+	if utf8.RuneCountInString(reason) > maxSuspendReasonLen {
+		return ErrSuspendReasonTooLong
+	}
+
+	revokeBefore := time.Now().Truncate(time.Second)
+
+	var user models.User
+	err := s.repo.SuspendUser(ctx, userID, adminID, reason, revokeBefore, &user)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return ErrUserNotFound
+	case errors.Is(err, repository.ErrUserAlreadySuspended):
+		return ErrUserAlreadySuspended
+	case err != nil:
+		return err
+	}
+
+	// API ключи проверяются с iat = момент проверки, поэтому отзыв по времени
+	// отсекает и закэшированные в сервисах результаты проверки ключей
+	if err = s.publishRevocation(ctx, jwt.RevocationMessage{
+		UserID:       userID,
+		IssuedBefore: &revokeBefore,
+		ExpiresAt:    revokeBefore.Add(s.accessTTL),
+	}); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":      user.ID,
+		"username":     user.Username,
+		"email":        user.Email,
+		"reason":       reason,
+		"suspended_by": adminID,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.UserSuspended, payload)
+}
+
+// ReactivateUser снимает приостановку, после чего пользователь может снова войти
+func (s *AuthService) ReactivateUser(ctx context.Context, userID, adminID int) error {
+	var user models.User
+	err := s.repo.ReactivateUser(ctx, userID, &user)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return ErrUserNotFound
+	case errors.Is(err, repository.ErrUserNotSuspended):
+		return ErrUserNotSuspended
+	case err != nil:
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":        user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"reactivated_by": adminID,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.UserReactivated, payload)
+}
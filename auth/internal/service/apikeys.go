@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/repository"
+	"eventify/common/jwt"
+	"fmt"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key request")
+)
+
+const (
+	apiKeyPrefix = "evk_"
+	// сколько символов ключа хранится открыто, чтобы пользователь узнал ключ в списке
+	apiKeyVisibleChars = 12
+	// сколько живет запись об отзыве ключа в denylist; должно быть больше api-key-cache-ttl остальных сервисов
+	apiKeyRevocationTTL = time.Hour
+)
+
+// CreateAPIKey выпускает ключ с правами scopes. Права ключа не могут превышать права роли владельца.
+func (s *AuthService) CreateAPIKey(ctx context.Context, userID int, req models.CreateAPIKeyRequest) (models.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return models.CreatedAPIKey{}, fmt.Errorf("%w: name must be 1-100 characters", ErrInvalidAPIKey)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return models.CreatedAPIKey{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKey)
+	}
+
+	var user models.User
+	if err := s.repo.GetUserByID(ctx, userID, &user); err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	var permissions []string
+	if err := s.repo.GetRolePermissions(ctx, user.Role, &permissions); err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !contains(permissions, scope) {
+			return models.CreatedAPIKey{}, fmt.Errorf("%w: scope %q is not granted to your role", ErrInvalidAPIKey, scope)
+		}
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return models.CreatedAPIKey{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	key := apiKeyPrefix + secret
+
+	created := models.CreatedAPIKey{
+		APIKey: models.APIKey{
+			UserID:    userID,
+			Name:      name,
+			Prefix:    key[:apiKeyVisibleChars],
+			Scopes:    scopes,
+			ExpiresAt: req.ExpiresAt,
+		},
+		Key: key,
+	}
+	if err = s.repo.CreateAPIKey(ctx, &created.APIKey, hashToken(key)); err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	return created, nil
+}
+
+func (s *AuthService) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if err := s.repo.GetAPIKeys(ctx, userID, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ и рассылает отзыв, чтобы сервисы не ждали истечения своего кэша
+func (s *AuthService) RevokeAPIKey(ctx context.Context, userID, keyID int) error {
+	err := s.repo.RevokeAPIKey(ctx, keyID, userID)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.publishRevocation(ctx, jwt.RevocationMessage{
+		JTI:       apiKeyJTI(keyID),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(apiKeyRevocationTTL),
+	})
+}
+
+// ResolveAPIKey реализует jwt.APIKeyResolver. Права ключа пересчитываются при каждой проверке:
+// это scopes ключа, которые все еще есть у роли владельца.
+func (s *AuthService) ResolveAPIKey(ctx context.Context, key string) (*jwt.CustomClaims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, jwt.ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	err := s.repo.GetActiveAPIKey(ctx, hashToken(key), &apiKey)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, jwt.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err = s.repo.GetUserByID(ctx, apiKey.UserID, &user); err != nil {
+		return nil, err
+	}
+	if user.Status == models.StatusSuspended {
+		return nil, jwt.ErrInvalidAPIKey
+	}
+	var rolePermissions []string
+	if err = s.repo.GetRolePermissions(ctx, user.Role, &rolePermissions); err != nil {
+		return nil, err
+	}
+	permissions := make([]string, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		if contains(rolePermissions, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	if err = s.repo.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		return nil, err
+	}
+
+	claims := &jwt.CustomClaims{
+		UserId:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Permissions:   permissions,
+		APIKeyID:      apiKey.ID,
+	}
+	claims.ID = apiKeyJTI(apiKey.ID)
+	// iat — создание ключа, поэтому отзыв всех токенов пользователя в denylist отключает и его ключи
+	claims.IssuedAt = gojwt.NewNumericDate(apiKey.CreatedAt)
+	if apiKey.ExpiresAt != nil {
+		claims.ExpiresAt = gojwt.NewNumericDate(*apiKey.ExpiresAt)
+	}
+	return claims, nil
+}
+
+// apiKeyJTI идентификатор ключа в denylist
+func apiKeyJTI(keyID int) string {
+	return "apikey:" + strconv.Itoa(keyID)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/repository"
+	"eventify/common/kafka"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LockoutError вход временно заблокирован после серии неудачных попыток
+type LockoutError struct {
+	Until time.Time
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again after %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// authenticate проверяет логин и пароль с учетом блокировок по логину и по IP.
+// На любую ошибку в логине или пароле возвращает ErrInvalidCredentials.
+func (s *AuthService) authenticate(ctx context.Context, login, password, ip string, user *models.User) error {
+	// блокировка по логину, а не по id, одинаково работает и для несуществующих пользователей
+	loginKey := "login:" + strings.ToLower(login)
+	ipKey := "ip:" + ip
+
+	var lockedUntil time.Time
+	locked, err := s.repo.GetLockedUntil(ctx, []string{loginKey, ipKey}, &lockedUntil)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return &LockoutError{Until: lockedUntil}
+	}
+
+	err = s.repo.GetUser(ctx, login, user)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+	exists := err == nil
+
+	hash := s.dummyHash
+	if exists {
+		hash = user.PasswordHash
+	}
+	ok, rehash, err := s.passwords.Verify(hash, password)
+	if err != nil {
+		return err
+	}
+	if ok && exists {
+		if err = s.repo.ResetLoginFailures(ctx, loginKey); err != nil {
+			return err
+		}
+		if user.Status == models.StatusSuspended {
+			return ErrAccountSuspended
+		}
+		if rehash {
+			s.upgradePasswordHash(ctx, *user, password)
+		}
+		return nil
+	}
+
+	if _, err = s.registerLoginFailure(ctx, ipKey, s.lockout.IPFreeAttempts); err != nil {
+		return err
+	}
+	until, err := s.registerLoginFailure(ctx, loginKey, s.lockout.FreeAttempts)
+	if err != nil {
+		return err
+	}
+	if !until.IsZero() && exists {
+		if err = s.publishLocked(ctx, *user, until); err != nil {
+			return err
+		}
+	}
+
+	return ErrInvalidCredentials
+}
+
+// upgradePasswordHash пересчитывает устаревший хэш (bcrypt или слабые параметры) текущим алгоритмом.
+// Пароль известен только в момент входа, поэтому другого шанса обновить хэш нет. Ошибка не мешает
+// входу: хэш останется старым и обновится при следующем входе.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user models.User, password string) {
+	hash, err := s.passwords.Hash(password)
+	if err != nil {
+		return
+	}
+	_ = s.repo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, hash)
+}
+
+// registerLoginFailure учитывает неудачу по ключу. После freeAttempts неудач ключ блокируется,
+// и каждая следующая неудача удваивает блокировку вплоть до MaxDelay.
+// Возвращает время окончания блокировки или нулевое время, если блокировки нет.
+func (s *AuthService) registerLoginFailure(ctx context.Context, key string, freeAttempts int) (time.Time, error) {
+	var failures int
+	if err := s.repo.RegisterLoginFailure(ctx, key, time.Now().Add(-s.lockout.Window), &failures); err != nil {
+		return time.Time{}, err
+	}
+	if failures <= freeAttempts {
+		return time.Time{}, nil
+	}
+
+	delay := s.lockout.BaseDelay
+	for i := freeAttempts + 1; i < failures && delay < s.lockout.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.lockout.MaxDelay {
+		delay = s.lockout.MaxDelay
+	}
+
+	until := time.Now().Add(delay)
+	return until, s.repo.LockLogin(ctx, key, until)
+}
+
+// publishLocked публикует user.locked, чтобы notification сервис предупредил владельца аккаунта
+func (s *AuthService) publishLocked(ctx context.Context, user models.User, until time.Time) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":      user.ID,
+		"username":     user.Username,
+		"email":        user.Email,
+		"locked_until": until,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.UserLocked, payload)
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/repository"
+	"eventify/common/jwt"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid mfa token")
+	ErrMFANotEnrolled    = errors.New("mfa enrollment not started")
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnabled     = errors.New("mfa not enabled")
+	ErrMFARequiredByRole = errors.New("mfa is required for your role")
+)
+
+// сколько кодов восстановления выдается при включении MFA
+const recoveryCodesCount = 10
+
+// mfaChallenge решает, нужен ли пользователю второй фактор. Если нужен, возвращает
+// mfa_pending токен вместо пары токенов.
+func (s *AuthService) mfaChallenge(ctx context.Context, user models.User) (*models.MFAChallenge, error) {
+	var mfa models.MFA
+	err := s.repo.GetMFA(ctx, user.ID, &mfa)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		return nil, err
+	}
+	enabled := err == nil && mfa.Enabled
+
+	var required bool
+	if !enabled {
+		if err = s.repo.RoleRequiresMFA(ctx, user.Role, &required); err != nil && !errors.Is(err, repository.ErrRoleNotFound) {
+			return nil, err
+		}
+	}
+	if !enabled && !required {
+		return nil, nil
+	}
+
+	token, err := jwt.GenerateToken(s.signingKey, jwt.CustomClaims{
+		UserId:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		MFAPending:    true,
+	}, s.mfaTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFAChallenge{
+		MFARequired:        true,
+		MFAToken:           token,
+		EnrollmentRequired: !enabled,
+		ExpiresIn:          int(s.mfaTTL.Seconds()),
+	}, nil
+}
+
+// CompleteMFALogin второй шаг входа: обменивает mfa_pending токен и код на пару токенов.
+// Неверные коды считаются так же, как неверные пароли, и приводят к блокировке.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, claims *jwt.CustomClaims, code string, client models.ClientInfo) (models.TokenResp, error) {
+	if !claims.MFAPending {
+		return models.TokenResp{}, ErrInvalidMFAToken
+	}
+
+	key := "mfa:" + strconv.Itoa(claims.UserId)
+	var lockedUntil time.Time
+	locked, err := s.repo.GetLockedUntil(ctx, []string{key}, &lockedUntil)
+	if err != nil {
+		return models.TokenResp{}, err
+	}
+	if locked {
+		return models.TokenResp{}, &LockoutError{Until: lockedUntil}
+	}
+
+	ok, err := s.checkSecondFactor(ctx, claims.UserId, code)
+	if err != nil {
+		return models.TokenResp{}, err
+	}
+	if !ok {
+		if _, err = s.registerLoginFailure(ctx, key, s.lockout.FreeAttempts); err != nil {
+			return models.TokenResp{}, err
+		}
+		return models.TokenResp{}, ErrInvalidMFACode
+	}
+	if err = s.repo.ResetLoginFailures(ctx, key); err != nil {
+		return models.TokenResp{}, err
+	}
+
+	return s.finishMFALogin(ctx, claims, client)
+}
+
+// EnrollTOTP создает новый секрет. Пока он не подтвержден кодом через VerifyTOTP, вход работает по-старому.
+func (s *AuthService) EnrollTOTP(ctx context.Context, claims *jwt.CustomClaims) (models.MFAEnrollResp, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return models.MFAEnrollResp{}, err
+	}
+
+	err = s.repo.SaveMFASecret(ctx, claims.UserId, secret)
+	if errors.Is(err, repository.ErrMFAAlreadyEnabled) {
+		return models.MFAEnrollResp{}, ErrMFAAlreadyEnabled
+	}
+	if err != nil {
+		return models.MFAEnrollResp{}, err
+	}
+
+	return models.MFAEnrollResp{
+		Secret:     secret,
+		OTPAuthURI: totpURI(s.mfaIssuer, claims.Username, secret),
+	}, nil
+}
+
+// VerifyTOTP включает MFA после проверки первого кода и выдает коды восстановления.
+// Если пользователь настраивал MFA во время входа, заодно завершает вход.
+func (s *AuthService) VerifyTOTP(ctx context.Context, claims *jwt.CustomClaims, code string, client models.ClientInfo) (models.MFAVerifyResp, error) {
+	var mfa models.MFA
+	err := s.repo.GetMFA(ctx, claims.UserId, &mfa)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		return models.MFAVerifyResp{}, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return models.MFAVerifyResp{}, err
+	}
+	if mfa.Enabled {
+		return models.MFAVerifyResp{}, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := matchTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return models.MFAVerifyResp{}, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return models.MFAVerifyResp{}, err
+	}
+	err = s.repo.EnableMFA(ctx, claims.UserId, step, hashes)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		// секрет успели перевыпустить или включить параллельным запросом
+		return models.MFAVerifyResp{}, ErrInvalidMFACode
+	}
+	if err != nil {
+		return models.MFAVerifyResp{}, err
+	}
+
+	resp := models.MFAVerifyResp{RecoveryCodes: codes}
+	if claims.MFAPending {
+		tokens, err := s.finishMFALogin(ctx, claims, client)
+		if err != nil {
+			return models.MFAVerifyResp{}, err
+		}
+		resp.Tokens = &tokens
+	}
+	return resp, nil
+}
+
+// DisableTOTP выключает MFA по действующему коду. Если роль требует MFA, выключить нельзя.
+func (s *AuthService) DisableTOTP(ctx context.Context, claims *jwt.CustomClaims, code string) error {
+	var user models.User
+	if err := s.repo.GetUserByID(ctx, claims.UserId, &user); err != nil {
+		return err
+	}
+	var required bool
+	if err := s.repo.RoleRequiresMFA(ctx, user.Role, &required); err != nil && !errors.Is(err, repository.ErrRoleNotFound) {
+		return err
+	}
+	if required {
+		return ErrMFARequiredByRole
+	}
+
+	if err := s.requireSecondFactor(ctx, claims.UserId, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteMFA(ctx, claims.UserId)
+}
+
+// RegenerateRecoveryCodes выдает новый набор кодов восстановления, старые перестают действовать
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, claims *jwt.CustomClaims, code string) ([]string, error) {
+	if err := s.requireSecondFactor(ctx, claims.UserId, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.repo.ReplaceRecoveryCodes(ctx, claims.UserId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// SetRoleMFARequired включает или выключает обязательный MFA для роли.
+// Пользователи роли без MFA настроят его при следующем входе.
+func (s *AuthService) SetRoleMFARequired(ctx context.Context, role string, required bool) error {
+	err := s.repo.SetRoleMFARequired(ctx, role, required)
+	if errors.Is(err, repository.ErrRoleNotFound) {
+		return ErrUnknownRole
+	}
+	return err
+}
+
+func (s *AuthService) requireSecondFactor(ctx context.Context, userID int, code string) error {
+	var mfa models.MFA
+	err := s.repo.GetMFA(ctx, userID, &mfa)
+	if errors.Is(err, repository.ErrMFANotFound) || (err == nil && !mfa.Enabled) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.checkSecondFactor(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// checkSecondFactor принимает код из приложения или код восстановления; каждый код действует один раз
+func (s *AuthService) checkSecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	var mfa models.MFA
+	err := s.repo.GetMFA(ctx, userID, &mfa)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		return false, nil
+	}
+	if err != nil || !mfa.Enabled {
+		return false, err
+	}
+
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(mfa.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return s.repo.UseTOTPStep(ctx, userID, step)
+	}
+	return s.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// finishMFALogin гасит mfa_pending токен и начинает обычную сессию
+func (s *AuthService) finishMFALogin(ctx context.Context, claims *jwt.CustomClaims, client models.ClientInfo) (models.TokenResp, error) {
+	if err := s.revokeAccessToken(ctx, claims); err != nil {
+		return models.TokenResp{}, err
+	}
+
+	// роль могла поменяться, пока пользователь вводил код
+	var user models.User
+	if err := s.repo.GetUserByID(ctx, claims.UserId, &user); err != nil {
+		return models.TokenResp{}, err
+	}
+	return s.startSession(ctx, user, client)
+}
+
+// newRecoveryCodes возвращает коды для пользователя и их хэши для базы
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
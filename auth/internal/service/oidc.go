@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/auth/internal/repository"
+	"eventify/common/jwt"
+	"fmt"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrOIDCClientNotFound  = errors.New("oidc client not found")
+	ErrInvalidOIDCClient   = errors.New("invalid oidc client")
+	ErrInvalidClientConfig = errors.New("invalid client configuration")
+	ErrInvalidRedirectURI  = errors.New("redirect_uri is not registered for this client")
+	ErrMFACodeRequired     = errors.New("mfa code required")
+	ErrMFAEnrollmentNeeded = errors.New("your role requires mfa, enable it in Eventify before signing in to other tools")
+)
+
+// области, которые понимает провайдер; openid обязательна
+var supportedScopes = []string{"openid", "profile", "email"}
+
+// OAuthError ошибка в формате RFC 6749: error — код из спецификации, error_description — пояснение
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// CreateOIDCClient регистрирует клиента. Секрет выдается только конфиденциальным клиентам и только в этом ответе.
+func (s *AuthService) CreateOIDCClient(ctx context.Context, adminID int, req models.CreateOIDCClientRequest) (models.CreatedOIDCClient, error) {
+	if len(req.RedirectURIs) == 0 {
+		return models.CreatedOIDCClient{}, fmt.Errorf("%w: at least one redirect_uri is required", ErrInvalidClientConfig)
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return models.CreatedOIDCClient{}, err
+		}
+	}
+
+	id, err := newOpaqueToken()
+	if err != nil {
+		return models.CreatedOIDCClient{}, err
+	}
+	created := models.CreatedOIDCClient{OIDCClient: models.OIDCClient{
+		ID:           id,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Public:       req.Public,
+	}}
+
+	var secretHash *string
+	if !req.Public {
+		if created.ClientSecret, err = newOpaqueToken(); err != nil {
+			return models.CreatedOIDCClient{}, err
+		}
+		hash := hashToken(created.ClientSecret)
+		secretHash = &hash
+	}
+
+	if err = s.repo.CreateOIDCClient(ctx, &created.OIDCClient, secretHash, adminID); err != nil {
+		return models.CreatedOIDCClient{}, err
+	}
+	return created, nil
+}
+
+func (s *AuthService) ListOIDCClients(ctx context.Context) ([]models.OIDCClient, error) {
+	clients := []models.OIDCClient{}
+	if err := s.repo.GetOIDCClients(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteOIDCClient удаляет клиента вместе с невыданными кодами; уже выпущенные токены живут до истечения
+func (s *AuthService) DeleteOIDCClient(ctx context.Context, clientID string) error {
+	err := s.repo.DeleteOIDCClient(ctx, clientID)
+	if errors.Is(err, repository.ErrOIDCClientNotFound) {
+		return ErrOIDCClientNotFound
+	}
+	return err
+}
+
+// CheckAuthorizeRequest проверяет клиента и redirect_uri. Пока они не проверены, на redirect_uri
+// нельзя отправлять пользователя даже с ошибкой, поэтому такие ошибки возвращаются отдельно от OAuthError.
+func (s *AuthService) CheckAuthorizeRequest(ctx context.Context, req models.AuthorizeRequest) (models.OIDCClient, error) {
+	var client models.OIDCClient
+	var secretHash *string
+	err := s.repo.GetOIDCClient(ctx, req.ClientID, &client, &secretHash)
+	if errors.Is(err, repository.ErrOIDCClientNotFound) {
+		return models.OIDCClient{}, ErrInvalidOIDCClient
+	}
+	if err != nil {
+		return models.OIDCClient{}, err
+	}
+	if !contains(client.RedirectURIs, req.RedirectURI) {
+		return models.OIDCClient{}, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return client, oauthError("unsupported_response_type", "only response_type=code is supported")
+	}
+	if _, ok := parseScope(req.Scope); !ok {
+		return client, oauthError("invalid_scope", "scope must include openid")
+	}
+	// PKCE обязателен для всех клиентов, а не только публичных
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return client, oauthError("invalid_request", "code_challenge with code_challenge_method=S256 is required")
+	}
+	return client, nil
+}
+
+// Authorize проверяет логин, пароль и второй фактор из формы входа и возвращает адрес,
+// на который нужно отправить пользователя с кодом авторизации.
+// Блокировки после неудачных попыток общие с /auth/login.
+func (s *AuthService) Authorize(ctx context.Context, req models.AuthorizeRequest, client models.ClientInfo) (string, error) {
+	if _, err := s.CheckAuthorizeRequest(ctx, req); err != nil {
+		return "", err
+	}
+
+	var user models.User
+	if err := s.authenticate(ctx, req.Login, req.Password, client.IP, &user); err != nil {
+		return "", err
+	}
+	if s.requireEmailVerification && !user.EmailVerified {
+		return "", ErrEmailNotVerified
+	}
+	if err := s.authorizeSecondFactor(ctx, user, req.Code); err != nil {
+		return "", err
+	}
+
+	code, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	scope, _ := parseScope(req.Scope)
+	now := time.Now()
+	err = s.repo.CreateAuthCode(ctx, hashToken(code), models.OIDCAuthCode{
+		ClientID:      req.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(s.oidc.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+// AuthorizeErrorRedirect адрес, по которому клиент узнает об ошибке запроса авторизации
+func AuthorizeErrorRedirect(req models.AuthorizeRequest, e *OAuthError) string {
+	params := url.Values{"error": {e.Code}, "error_description": {e.Description}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params)
+}
+
+// authorizeSecondFactor то же правило, что и при обычном входе: MFA нужен, если он включен
+// у пользователя или обязателен для его роли. Настроить MFA через форму провайдера нельзя.
+func (s *AuthService) authorizeSecondFactor(ctx context.Context, user models.User, code string) error {
+	challenge, err := s.mfaChallenge(ctx, user)
+	if err != nil || challenge == nil {
+		return err
+	}
+	if challenge.EnrollmentRequired {
+		return ErrMFAEnrollmentNeeded
+	}
+	if code == "" {
+		return ErrMFACodeRequired
+	}
+
+	key := "mfa:" + strconv.Itoa(user.ID)
+	var lockedUntil time.Time
+	locked, err := s.repo.GetLockedUntil(ctx, []string{key}, &lockedUntil)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return &LockoutError{Until: lockedUntil}
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user.ID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err = s.registerLoginFailure(ctx, key, s.lockout.FreeAttempts); err != nil {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+	return s.repo.ResetLoginFailures(ctx, key)
+}
+
+// ExchangeCode обменивает код авторизации на access токен и id_token
+func (s *AuthService) ExchangeCode(ctx context.Context, req models.OIDCTokenRequest) (models.OIDCTokenResp, error) {
+	if req.GrantType != "authorization_code" {
+		return models.OIDCTokenResp{}, oauthError("unsupported_grant_type", "only authorization_code is supported")
+	}
+	if err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret); err != nil {
+		return models.OIDCTokenResp{}, err
+	}
+
+	// код гасится до остальных проверок: повторить обмен с другим verifier нельзя
+	var code models.OIDCAuthCode
+	err := s.repo.UseAuthCode(ctx, hashToken(req.Code), &code)
+	if errors.Is(err, repository.ErrAuthCodeNotFound) {
+		return models.OIDCTokenResp{}, oauthError("invalid_grant", "authorization code is invalid, expired or already used")
+	}
+	if err != nil {
+		return models.OIDCTokenResp{}, err
+	}
+	if code.ClientID != req.ClientID || code.RedirectURI != req.RedirectURI {
+		return models.OIDCTokenResp{}, oauthError("invalid_grant", "client_id or redirect_uri does not match the authorization request")
+	}
+	if !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return models.OIDCTokenResp{}, oauthError("invalid_grant", "code_verifier does not match code_challenge")
+	}
+
+	// пользователь мог быть удален или сменить данные, пока код ждал обмена
+	var user models.User
+	err = s.repo.GetUserByID(ctx, code.UserID, &user)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return models.OIDCTokenResp{}, oauthError("invalid_grant", "user no longer exists")
+	}
+	if err != nil {
+		return models.OIDCTokenResp{}, err
+	}
+	if user.Status == models.StatusSuspended {
+		return models.OIDCTokenResp{}, oauthError("invalid_grant", ErrAccountSuspended.Error())
+	}
+
+	subject := strconv.Itoa(user.ID)
+	accessToken, err := jwt.GenerateToken(s.signingKey, jwt.CustomClaims{
+		UserId:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Scope:         code.Scope,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Issuer:   s.oidc.Issuer,
+			Subject:  subject,
+			Audience: gojwt.ClaimStrings{code.ClientID},
+		},
+	}, s.accessTTL)
+	if err != nil {
+		return models.OIDCTokenResp{}, err
+	}
+
+	idClaims := jwt.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: code.AuthTime.Unix(),
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Issuer:   s.oidc.Issuer,
+			Subject:  subject,
+			Audience: gojwt.ClaimStrings{code.ClientID},
+		},
+	}
+	if err = s.fillScopeClaims(ctx, user, code.Scope, &idClaims); err != nil {
+		return models.OIDCTokenResp{}, err
+	}
+	idToken, err := jwt.GenerateIDToken(s.signingKey, idClaims, s.accessTTL)
+	if err != nil {
+		return models.OIDCTokenResp{}, err
+	}
+
+	return models.OIDCTokenResp{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.accessTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       code.Scope,
+	}, nil
+}
+
+// UserInfo claims пользователя по access токену провайдера; набор полей зависит от scope токена
+func (s *AuthService) UserInfo(ctx context.Context, claims *jwt.CustomClaims) (map[string]interface{}, error) {
+	if _, ok := parseScope(claims.Scope); !ok {
+		return nil, oauthError("insufficient_scope", "access token has no openid scope")
+	}
+
+	var user models.User
+	err := s.repo.GetUserByID(ctx, claims.UserId, &user)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, oauthError("invalid_token", "user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var idClaims jwt.IDTokenClaims
+	if err = s.fillScopeClaims(ctx, user, claims.Scope, &idClaims); err != nil {
+		return nil, err
+	}
+
+	info := map[string]interface{}{"sub": strconv.Itoa(user.ID)}
+	if strings.Contains(" "+claims.Scope+" ", " profile ") {
+		info["preferred_username"] = idClaims.PreferredUsername
+		info["name"] = idClaims.Name
+		info["picture"] = idClaims.Picture
+	}
+	if idClaims.EmailVerified != nil {
+		info["email"] = idClaims.Email
+		info["email_verified"] = *idClaims.EmailVerified
+	}
+	return info, nil
+}
+
+// Discovery документ /.well-known/openid-configuration
+func (s *AuthService) Discovery() map[string]interface{} {
+	issuer := strings.TrimRight(s.oidc.Issuer, "/")
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{s.signingKey.Method.Alg()},
+		"scopes_supported":                      supportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"preferred_username", "name", "picture", "email", "email_verified",
+		},
+	}
+}
+
+// authenticateClient проверяет секрет конфиденциального клиента; публичный клиент секрет передавать не должен
+func (s *AuthService) authenticateClient(ctx context.Context, clientID, secret string) error {
+	var client models.OIDCClient
+	var secretHash *string
+	err := s.repo.GetOIDCClient(ctx, clientID, &client, &secretHash)
+	if errors.Is(err, repository.ErrOIDCClientNotFound) {
+		return oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return err
+	}
+
+	if secretHash == nil {
+		if secret != "" {
+			return oauthError("invalid_client", "public client must not send a secret")
+		}
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(*secretHash)) != 1 {
+		return oauthError("invalid_client", "invalid client credentials")
+	}
+	return nil
+}
+
+// fillScopeClaims заполняет claims профиля и email, если их разрешает scope
+func (s *AuthService) fillScopeClaims(ctx context.Context, user models.User, scope string, claims *jwt.IDTokenClaims) error {
+	scopes := strings.Fields(scope)
+	if contains(scopes, "profile") {
+		var profile models.Profile
+		if err := s.repo.GetProfile(ctx, user.ID, &profile); err != nil {
+			return err
+		}
+		claims.PreferredUsername = user.Username
+		claims.Name = profile.DisplayName
+		claims.Picture = profile.AvatarURL
+	}
+	if contains(scopes, "email") {
+		verified := user.EmailVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	return nil
+}
+
+// parseScope оставляет только поддерживаемые области; без openid запрос не является запросом OIDC
+func parseScope(scope string) (string, bool) {
+	var result []string
+	for _, s := range strings.Fields(scope) {
+		if contains(supportedScopes, s) && !contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return strings.Join(result, " "), contains(result, "openid")
+}
+
+// verifyPKCE сравнивает BASE64URL(SHA256(code_verifier)) с code_challenge из запроса авторизации
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validateRedirectURI принимает только абсолютные http(s) адреса без фрагмента, их потом сравниваем побайтно
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("%w: invalid redirect_uri %q", ErrInvalidClientConfig, uri)
+	}
+	return nil
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
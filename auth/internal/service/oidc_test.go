@@ -0,0 +1,133 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func challengeFor(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// пример из RFC 7636, приложение B
+	const (
+		rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+	longest := strings.Repeat("a", 128)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "rfc 7636 example", verifier: rfcVerifier, challenge: rfcChallenge, want: true},
+		{name: "wrong verifier", verifier: strings.Replace(rfcVerifier, "d", "e", 1), challenge: rfcChallenge},
+		// plain не поддерживается: challenge, равный verifier, не подходит
+		{name: "plain method", verifier: rfcVerifier, challenge: rfcVerifier},
+		{name: "challenge with padding", verifier: rfcVerifier, challenge: rfcChallenge + "="},
+		{name: "empty challenge", verifier: rfcVerifier, challenge: ""},
+		{name: "empty verifier", verifier: "", challenge: challengeFor("")},
+		// длина verifier от 43 до 128 символов
+		{name: "42 characters", verifier: rfcVerifier[:42], challenge: challengeFor(rfcVerifier[:42])},
+		{name: "128 characters", verifier: longest, challenge: challengeFor(longest), want: true},
+		{name: "129 characters", verifier: longest + "a", challenge: challengeFor(longest + "a")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		scope      string
+		want       string
+		wantOpenID bool
+	}{
+		{scope: "openid", want: "openid", wantOpenID: true},
+		{scope: "openid profile email", want: "openid profile email", wantOpenID: true},
+		// порядок клиента сохраняется
+		{scope: "email openid", want: "email openid", wantOpenID: true},
+		{scope: "openid openid profile profile", want: "openid profile", wantOpenID: true},
+		{scope: "openid offline_access phone", want: "openid", wantOpenID: true},
+		{scope: "  openid\tprofile\n", want: "openid profile", wantOpenID: true},
+		// без openid это не запрос OIDC
+		{scope: "profile email", want: "profile email"},
+		{scope: "OpenID profile", want: "profile"},
+		{scope: "openidprofile", want: ""},
+		{scope: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		got, openID := parseScope(tt.scope)
+		if got != tt.want || openID != tt.wantOpenID {
+			t.Errorf("parseScope(%q) = %q, %v; want %q, %v", tt.scope, got, openID, tt.want, tt.wantOpenID)
+		}
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{uri: "https://grafana.example.com/login/generic_oauth", valid: true},
+		{uri: "http://localhost:9999/callback?from=eventify", valid: true},
+		{uri: "https://example.com/callback#token"},
+		{uri: "/callback"},
+		{uri: "example.com/callback"},
+		{uri: "javascript:alert(1)"},
+		{uri: "ftp://example.com/callback"},
+		{uri: "https:///callback"},
+		{uri: "http://[::1"},
+		{uri: ""},
+	}
+
+	for _, tt := range tests {
+		err := validateRedirectURI(tt.uri)
+		if tt.valid && err != nil {
+			t.Errorf("validateRedirectURI(%q) = %v, want nil", tt.uri, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidClientConfig) {
+			t.Errorf("validateRedirectURI(%q) = %v, want ErrInvalidClientConfig", tt.uri, err)
+		}
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	tests := []struct {
+		uri    string
+		params url.Values
+		want   string
+	}{
+		{
+			uri:    "http://localhost:9999/callback",
+			params: url.Values{"code": {"abc"}, "state": {"x y"}},
+			want:   "http://localhost:9999/callback?code=abc&state=x+y",
+		},
+		{
+			// параметры redirect_uri клиента сохраняются, одноименные заменяются
+			uri:    "https://example.com/cb?from=eventify&state=old",
+			params: url.Values{"state": {"new"}},
+			want:   "https://example.com/cb?from=eventify&state=new",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := appendQuery(tt.uri, tt.params); got != tt.want {
+			t.Errorf("appendQuery(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
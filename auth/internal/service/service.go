@@ -2,32 +2,105 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"golang.org/x/crypto/bcrypt"
-	"time"
+	"eventify/auth/internal/config"
 	"eventify/auth/internal/models"
+	"eventify/auth/internal/password"
 	"eventify/auth/internal/repository"
 	"eventify/common/jwt"
+	"eventify/common/kafka"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, all sessions of this login are revoked")
+	ErrInvalidResetToken   = errors.New("invalid or expired password reset token")
+	ErrInvalidVerifyToken  = errors.New("invalid or expired email verification token")
+	ErrEmailNotVerified    = errors.New("email not verified")
+	ErrUnknownRole         = errors.New("unknown role")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUsernameTaken       = errors.New("username already taken")
+	ErrInvalidProfile      = errors.New("invalid profile")
 )
 
+// DefaultRole роль, которую получает каждый зарегистрированный пользователь
+const DefaultRole = "user"
+
 type AuthService struct {
-	repo   *repository.AuthRepository
-	secret string
-}
+	repo       *repository.AuthRepository
+	producer   *kafka.Producer
+	denylist   *jwt.Denylist
+	signingKey *jwt.SigningKey
+	passwords  *password.Hashers
+	policy     *password.Policy
+	// dummyHash проверяется вместо хэша несуществующего пользователя, чтобы по времени ответа
+	// нельзя было понять, существует ли логин
+	dummyHash  string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	lockout    config.LockoutConfig
+	mfaTTL     time.Duration
+	mfaIssuer  string
+	resetTTL   time.Duration
+	resetURL   string
+	verifyTTL  time.Duration
+	verifyURL  string
+	oidc       config.OIDCConfig
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	httpClient            *http.Client
+	exportEventsURL       string
+	exportInteractionsURL string
+
+	requireEmailVerification bool
 }
 
-func NewAuthService(repo *repository.AuthRepository, secret string) *AuthService {
+func NewAuthService(repo *repository.AuthRepository, producer *kafka.Producer, denylist *jwt.Denylist, signingKey *jwt.SigningKey,
+	passwords *password.Hashers, policy *password.Policy, cfg config.AuthConfig) *AuthService {
+	dummyHash, _ := passwords.Hash("eventify-dummy-password")
+
 	return &AuthService{
-		repo:   repo,
-		secret: secret,
+		repo:       repo,
+		producer:   producer,
+		denylist:   denylist,
+		signingKey: signingKey,
+		passwords:  passwords,
+		policy:     policy,
+		dummyHash:  dummyHash,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		lockout:    cfg.Lockout,
+		mfaTTL:     cfg.MFATokenTTL,
+		mfaIssuer:  cfg.MFAIssuer,
+		resetTTL:   cfg.ResetTokenTTL,
+		resetURL:   cfg.ResetURL,
+		verifyTTL:  cfg.VerifyTokenTTL,
+		verifyURL:  cfg.VerifyURL,
+		oidc:       cfg.OIDC,
+
+		httpClient:            &http.Client{Timeout: 10 * time.Second},
+		exportEventsURL:       cfg.ExportEventsURL,
+		exportInteractionsURL: cfg.ExportInteractionsURL,
+
+		requireEmailVerification: cfg.RequireEmailVerification,
 	}
 }
 
 func (s *AuthService) RegisterUser(ctx context.Context, req models.RegisterRequest) error {
+	if err := s.policy.Validate(req.Password, req.Username, req.Email); err != nil {
+		return err
+	}
+
 	exitst, err := s.repo.UserExists(ctx, req.Username, req.Email)
 	if err != nil {
 		return err
@@ -35,30 +108,471 @@ func (s *AuthService) RegisterUser(ctx context.Context, req models.RegisterReque
 	if exitst {
 		return errors.New("user already exists")
 	}
-	hash, err := HashPassword(req.Password)
+	hash, err := s.passwords.Hash(req.Password)
 	if err != nil {
 		return err
 	}
 
-	return s.repo.CreateUser(ctx, req.Username, req.Email, hash, req.Role)
+	user := models.User{Username: req.Username, Email: req.Email}
+	if err = s.repo.CreateUser(ctx, req.Username, req.Email, hash, DefaultRole, &user.ID); err != nil {
+		return err
+	}
+
+	return s.sendVerification(ctx, user)
 }
 
-func (s *AuthService) LoginUser(ctx context.Context, req models.LoginRequest) (string, error) {
-	var hashedPassword, role string
-	var userId int
+// ResendVerification повторно отправляет ссылку подтверждения, если email еще не подтвержден.
+// Как и сброс пароля, не раскрывает, существует ли пользователь.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	var user models.User
+	if err := s.repo.GetUser(ctx, email, &user); err != nil || user.Email != email || user.EmailVerified {
+		return nil
+	}
 
-	if err := s.repo.GetUser(ctx, req.Username, &hashedPassword, &userId, &role); err != nil {
-		return "", err
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail подтверждает email по токену из письма
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	var userID int
+	err := s.repo.VerifyEmail(ctx, hashToken(token), &userID)
+	if errors.Is(err, repository.ErrVerificationTokenNotFound) {
+		return ErrInvalidVerifyToken
 	}
+	return err
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
-		return "", err
+// sendVerification создает токен подтверждения и публикует user.registered, notification сервис отправит письмо
+func (s *AuthService) sendVerification(ctx context.Context, user models.User) error {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.verifyTTL)
+	if err = s.repo.CreateEmailVerificationToken(ctx, user.ID, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":          user.ID,
+		"username":         user.Username,
+		"email":            user.Email,
+		"verification_url": s.verifyURL + "?token=" + url.QueryEscape(token),
+		"expires_at":       expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.UserRegistered, payload)
+}
+
+// LoginUser проверяет логин и пароль и выпускает пару токенов. IP клиента нужен для ограничения числа попыток.
+// Если пользователю нужен второй фактор, вместо токенов возвращается MFAChallenge.
+func (s *AuthService) LoginUser(ctx context.Context, req models.LoginRequest, client models.ClientInfo) (models.TokenResp, *models.MFAChallenge, error) {
+	login := req.Username
+	if login == "" {
+		login = req.Email
+	}
+
+	var user models.User
+	if err := s.authenticate(ctx, login, req.Password, client.IP, &user); err != nil {
+		return models.TokenResp{}, nil, err
+	}
+
+	if s.requireEmailVerification && !user.EmailVerified {
+		return models.TokenResp{}, nil, ErrEmailNotVerified
+	}
+
+	challenge, err := s.mfaChallenge(ctx, user)
+	if err != nil || challenge != nil {
+		return models.TokenResp{}, challenge, err
+	}
+
+	tokens, err := s.startSession(ctx, user, client)
+	return tokens, nil, err
+}
+
+// startSession начинает новую сессию после успешного входа
+func (s *AuthService) startSession(ctx context.Context, user models.User, client models.ClientInfo) (models.TokenResp, error) {
+	// каждый вход — новая сессия и новое семейство refresh токенов
+	sessionID, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenResp{}, err
+	}
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenResp{}, err
+	}
+	session := models.Session{ID: sessionID, UserAgent: client.UserAgent, IP: client.IP}
+	if err = s.repo.CreateSession(ctx, user.ID, session, hashToken(refreshToken), time.Now().Add(s.refreshTTL)); err != nil {
+		return models.TokenResp{}, err
+	}
+
+	return s.issueTokens(ctx, user, sessionID, refreshToken)
+}
+
+// RefreshTokens обменивает refresh токен на новую пару токенов, старый refresh токен при этом перестает действовать
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, client models.ClientInfo) (models.TokenResp, error) {
+	newRefreshToken, err := newOpaqueToken()
+	if err != nil {
+		return models.TokenResp{}, err
+	}
+
+	var old models.RefreshToken
+	err = s.repo.RotateRefreshToken(ctx, hashToken(refreshToken), hashToken(newRefreshToken), time.Now().Add(s.refreshTTL), client, &old)
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenReused):
+		// access токены украденной сессии тоже больше не принимаются
+		if err = s.publishSessionRevocation(ctx, old.UserID, old.FamilyID); err != nil {
+			return models.TokenResp{}, err
+		}
+		return models.TokenResp{}, ErrRefreshTokenReused
+	case errors.Is(err, repository.ErrRefreshTokenNotFound):
+		return models.TokenResp{}, ErrInvalidRefreshToken
+	case err != nil:
+		return models.TokenResp{}, err
+	}
+
+	// роль и email могли измениться с прошлого входа, поэтому перечитываем пользователя
+	var user models.User
+	if err = s.repo.GetUserByID(ctx, old.UserID, &user); err != nil {
+		return models.TokenResp{}, err
+	}
+
+	return s.issueTokens(ctx, user, old.FamilyID, newRefreshToken)
+}
+
+// Logout завершает сессию текущего токена. У токенов, выпущенных до появления сессий,
+// отзывается сам access токен и, если передан, refresh токен вместе со всем его семейством.
+func (s *AuthService) Logout(ctx context.Context, claims *jwt.CustomClaims, refreshToken string) error {
+	if claims.SessionID != "" {
+		err := s.RevokeSession(ctx, claims.UserId, claims.SessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if refreshToken != "" {
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, hashToken(refreshToken), claims.UserId); err != nil {
+			return err
+		}
+	}
+
+	return s.revokeAccessToken(ctx, claims)
+}
+
+// RequestPasswordReset отправляет ссылку на сброс пароля. Если пользователя нет, ничего не происходит,
+// а вызывающий получает тот же ответ, чтобы по нему нельзя было проверить, зарегистрирован ли email.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	var user models.User
+	if err := s.repo.GetUser(ctx, email, &user); err != nil || user.Email != email {
+		return nil
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.resetTTL)
+	if err = s.repo.CreatePasswordResetToken(ctx, user.ID, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"email":      user.Email,
+		"reset_url":  s.resetURL + "?token=" + url.QueryEscape(token),
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.PasswordResetRequested, payload)
+}
+
+// ResetPassword меняет пароль по одноразовому токену и завершает все сессии пользователя
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// пароль не должен содержать username и email владельца ссылки
+	var user models.User
+	err := s.repo.GetUserByResetToken(ctx, hashToken(token), &user)
+	if errors.Is(err, repository.ErrResetTokenNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if err = s.policy.Validate(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	hash, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// iat в токенах хранится с точностью до секунды
+	revokeBefore := time.Now().Truncate(time.Second)
+
+	var userID int
+	err = s.repo.ResetPassword(ctx, hashToken(token), hash, revokeBefore, &userID)
+	if errors.Is(err, repository.ErrResetTokenNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.publishRevocation(ctx, jwt.RevocationMessage{
+		UserID:       userID,
+		IssuedBefore: &revokeBefore,
+		ExpiresAt:    revokeBefore.Add(s.accessTTL),
+	})
+}
+
+// ChangeUserRole назначает пользователю роль от имени администратора adminID.
+// Токены пользователя со старой ролью отзываются, новую роль он получит при следующем refresh.
+func (s *AuthService) ChangeUserRole(ctx context.Context, userID int, role string, adminID int) error {
+	exists, err := s.repo.RoleExists(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUnknownRole
+	}
+
+	revokeBefore := time.Now().Truncate(time.Second)
+
+	var oldRole string
+	err = s.repo.ChangeUserRole(ctx, userID, role, adminID, revokeBefore, &oldRole)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = s.publishRevocation(ctx, jwt.RevocationMessage{
+		UserID:       userID,
+		IssuedBefore: &revokeBefore,
+		ExpiresAt:    revokeBefore.Add(s.accessTTL),
+	}); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":    userID,
+		"old_role":   oldRole,
+		"new_role":   role,
+		"changed_by": adminID,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.UserRoleChanged, payload)
+}
+
+func (s *AuthService) GetProfile(ctx context.Context, userID int, profile *models.Profile) error {
+	err := s.repo.GetProfile(ctx, userID, profile)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (s *AuthService) GetPublicProfile(ctx context.Context, userID int, public *models.PublicProfile) error {
+	var profile models.Profile
+	if err := s.GetProfile(ctx, userID, &profile); err != nil {
+		return err
+	}
+
+	*public = models.PublicProfile{
+		ID:          profile.ID,
+		Username:    profile.Username,
+		DisplayName: profile.DisplayName,
+		AvatarURL:   profile.AvatarURL,
+		Bio:         profile.Bio,
+		CreatedAt:   profile.CreatedAt,
+	}
+	return nil
+}
+
+// UpdateProfile обновляет профиль и публикует user.updated, чтобы остальные сервисы
+// обновили свои копии username
+func (s *AuthService) UpdateProfile(ctx context.Context, userID int, req models.UpdateProfileRequest, profile *models.Profile) error {
+	if err := validateProfile(req); err != nil {
+		return err
+	}
+
+	err := s.repo.UpdateProfile(ctx, userID, req)
+	switch {
+	case errors.Is(err, repository.ErrUsernameTaken):
+		return ErrUsernameTaken
+	case errors.Is(err, repository.ErrUserNotFound):
+		return ErrUserNotFound
+	case err != nil:
+		return err
+	}
+
+	if err = s.GetProfile(ctx, userID, profile); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"user_id":      profile.ID,
+		"username":     profile.Username,
+		"display_name": profile.DisplayName,
+		"avatar_url":   profile.AvatarURL,
+	})
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.UserUpdated, payload)
+}
+
+func validateProfile(req models.UpdateProfileRequest) error {
+	if req.Username != nil {
+		*req.Username = strings.TrimSpace(*req.Username)
+		if *req.Username == "" || utf8.RuneCountInString(*req.Username) > 255 {
+			return fmt.Errorf("%w: username must be 1-255 characters", ErrInvalidProfile)
+		}
+	}
+	if req.DisplayName != nil && utf8.RuneCountInString(*req.DisplayName) > 100 {
+		return fmt.Errorf("%w: display_name must be at most 100 characters", ErrInvalidProfile)
+	}
+	if req.Bio != nil && utf8.RuneCountInString(*req.Bio) > 1000 {
+		return fmt.Errorf("%w: bio must be at most 1000 characters", ErrInvalidProfile)
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: avatar_url must be an http(s) URL", ErrInvalidProfile)
+		}
+	}
+	if req.Locale != nil && len(*req.Locale) > 20 {
+		return fmt.Errorf("%w: locale must be at most 20 characters", ErrInvalidProfile)
+	}
+	if req.TimeZone != nil && *req.TimeZone != "" {
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil {
+			return fmt.Errorf("%w: unknown time_zone %q", ErrInvalidProfile, *req.TimeZone)
+		}
+	}
+	return nil
+}
+
+// LoadRevokedTokens заполняет denylist отозванными токенами из базы, используется при старте сервиса
+func (s *AuthService) LoadRevokedTokens(ctx context.Context) error {
+	revoked, err := s.ActiveRevocations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range revoked {
+		s.denylist.Apply(m)
+	}
+	return nil
+}
+
+// ActiveRevocations отзывы токенов, которые еще не истекли. По ним denylist заполняется при старте
+// этого и остальных сервисов: kafka доставляет только отзывы, случившиеся после подключения.
+func (s *AuthService) ActiveRevocations(ctx context.Context) ([]jwt.RevocationMessage, error) {
+	revoked := []jwt.RevocationMessage{}
+	if err := s.repo.GetActiveRevokedTokens(ctx, &revoked); err != nil {
+		return nil, err
+	}
+
+	// отзыв всех токенов пользователя актуален, пока живут выпущенные до него access токены
+	var users []jwt.RevocationMessage
+	if err := s.repo.GetActiveUserRevocations(ctx, time.Now().Add(-s.accessTTL), &users); err != nil {
+		return nil, err
+	}
+	for _, m := range users {
+		m.ExpiresAt = m.IssuedBefore.Add(s.accessTTL)
+		revoked = append(revoked, m)
+	}
+
+	var sessions []jwt.RevocationMessage
+	if err := s.repo.GetActiveSessionRevocations(ctx, time.Now().Add(-s.accessTTL), &sessions); err != nil {
+		return nil, err
+	}
+	for _, m := range sessions {
+		// в ExpiresAt репозиторий кладет момент отзыва
+		m.ExpiresAt = m.ExpiresAt.Add(s.accessTTL)
+		revoked = append(revoked, m)
+	}
+	return revoked, nil
+}
+
+// revokeAccessToken сохраняет отзыв в базе и рассылает его остальным сервисам через kafka
+func (s *AuthService) revokeAccessToken(ctx context.Context, claims *jwt.CustomClaims) error {
+	msg := jwt.RevocationMessage{
+		JTI:       claims.ID,
+		UserID:    claims.UserId,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	if err := s.repo.RevokeToken(ctx, msg.JTI, msg.UserID, msg.ExpiresAt); err != nil {
+		return err
 	}
 
-	token, err := jwt.GenerateToken(s.secret, userId, req.Username, req.Email, role, time.Hour*24)
+	return s.publishRevocation(ctx, msg)
+}
+
+// publishRevocation применяет уже сохраненный в базе отзыв локально и рассылает его остальным сервисам
+func (s *AuthService) publishRevocation(ctx context.Context, msg jwt.RevocationMessage) error {
+	s.denylist.Apply(msg)
+
+	payload, err := json.Marshal(msg)
 	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, kafka.TokenRevoked, payload)
+}
+
+// issueTokens выпускает access токен с правами роли пользователя и собирает ответ
+// вместе с уже сохраненным refresh токеном
+func (s *AuthService) issueTokens(ctx context.Context, user models.User, sessionID, refreshToken string) (models.TokenResp, error) {
+	if user.Status == models.StatusSuspended {
+		return models.TokenResp{}, ErrAccountSuspended
+	}
+
+	var permissions []string
+	if err := s.repo.GetRolePermissions(ctx, user.Role, &permissions); err != nil {
+		return models.TokenResp{}, err
+	}
+
+	accessToken, err := jwt.GenerateToken(s.signingKey, jwt.CustomClaims{
+		UserId:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Permissions:   permissions,
+		SessionID:     sessionID,
+	}, s.accessTTL)
+	if err != nil {
+		return models.TokenResp{}, err
+	}
+
+	return models.TokenResp{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+	}, nil
+}
+
+// newOpaqueToken генерирует случайный токен, который не несет в себе никаких данных
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return token, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
+// hashToken хэш для хранения токена в базе; токены случайные, поэтому соль не нужна
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
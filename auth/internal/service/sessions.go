@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"eventify/auth/internal/models"
+	"eventify/common/jwt"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions активные сессии пользователя; текущая помечена Current
+func (s *AuthService) ListSessions(ctx context.Context, claims *jwt.CustomClaims) ([]models.Session, error) {
+	sessions := []models.Session{}
+	if err := s.repo.GetActiveSessions(ctx, claims.UserId, &sessions); err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает одну сессию пользователя, в том числе текущую
+func (s *AuthService) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	var revoked []string
+	if err := s.repo.RevokeSessions(ctx, userID, sessionID, "", &revoked); err != nil {
+		return err
+	}
+	if len(revoked) == 0 {
+		return ErrSessionNotFound
+	}
+	return s.publishSessionRevocation(ctx, userID, sessionID)
+}
+
+// RevokeOtherSessions завершает все сессии пользователя, кроме текущей, и возвращает их число
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, claims *jwt.CustomClaims) (int, error) {
+	var revoked []string
+	if err := s.repo.RevokeSessions(ctx, claims.UserId, "", claims.SessionID, &revoked); err != nil {
+		return 0, err
+	}
+	for _, id := range revoked {
+		if err := s.publishSessionRevocation(ctx, claims.UserId, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(revoked), nil
+}
+
+// publishSessionRevocation отзывает access токены сессии во всех сервисах; запись живет,
+// пока не истекут выпущенные в сессии access токены
+func (s *AuthService) publishSessionRevocation(ctx context.Context, userID int, sessionID string) error {
+	return s.publishRevocation(ctx, jwt.RevocationMessage{
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(s.accessTTL),
+	})
+}
@@ -0,0 +1,129 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader заголовок, в котором машинные клиенты передают персональный API ключ
+const APIKeyHeader = "X-API-Key"
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyResolver превращает API ключ в те же claims, что и у JWT, чтобы обработчикам
+// было все равно, как аутентифицирован клиент. Неизвестный, истекший или отозванный ключ — ErrInvalidAPIKey.
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (*CustomClaims, error)
+}
+
+// при переполнении кэша из него выбрасываются истекшие записи
+const apiKeyCacheSweepSize = 10000
+
+type cachedAPIKey struct {
+	claims    *CustomClaims
+	expiresAt time.Time
+}
+
+// APIKeyIntrospector APIKeyResolver для сервисов без доступа к базе auth: спрашивает auth сервис
+// с секретом serviceToken и кэширует ответ на ttl. Отзыв ключа до истечения кэша доходит через denylist.
+type APIKeyIntrospector struct {
+	url          string
+	serviceToken string
+	ttl          time.Duration
+	client       *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+func NewAPIKeyIntrospector(url, serviceToken string, ttl time.Duration) *APIKeyIntrospector {
+	return &APIKeyIntrospector{
+		url:          url,
+		serviceToken: serviceToken,
+		ttl:          ttl,
+		client:       &http.Client{Timeout: 5 * time.Second},
+		cache:        make(map[string]cachedAPIKey),
+	}
+}
+
+func (i *APIKeyIntrospector) ResolveAPIKey(ctx context.Context, key string) (*CustomClaims, error) {
+	// в памяти держим только хэши ключей
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	i.mu.Lock()
+	cached, ok := i.cache[cacheKey]
+	i.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		if cached.claims == nil {
+			return nil, ErrInvalidAPIKey
+		}
+		return cached.claims, nil
+	}
+
+	claims, err := i.introspect(ctx, key)
+	if err != nil && !errors.Is(err, ErrInvalidAPIKey) {
+		return nil, err
+	}
+
+	// неверные ключи тоже кэшируем, чтобы перебор не нагружал auth сервис
+	expiresAt := time.Now().Add(i.ttl)
+	if claims != nil && claims.ExpiresAt != nil && claims.ExpiresAt.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	i.mu.Lock()
+	if len(i.cache) >= apiKeyCacheSweepSize {
+		now := time.Now()
+		for k, v := range i.cache {
+			if now.After(v.expiresAt) {
+				delete(i.cache, k)
+			}
+		}
+	}
+	i.cache[cacheKey] = cachedAPIKey{claims: claims, expiresAt: expiresAt}
+	i.mu.Unlock()
+
+	return claims, err
+}
+
+func (i *APIKeyIntrospector) introspect(ctx context.Context, key string) (*CustomClaims, error) {
+	body, err := json.Marshal(map[string]string{"api_key": key})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ServiceTokenHeader, i.serviceToken)
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrInvalidAPIKey
+	default:
+		return nil, fmt.Errorf("api key introspection: unexpected status %d", resp.StatusCode)
+	}
+
+	var claims CustomClaims
+	if err = json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
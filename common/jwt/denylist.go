@@ -0,0 +1,211 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"eventify/common/kafka"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationMessage payload сообщения user.token_revoked.
+// Отзывается либо один токен (JTI), либо все токены одной сессии (SessionID),
+// либо все токены пользователя, выпущенные раньше IssuedBefore.
+// ExpiresAt — момент, после которого запись можно забыть: отозванные токены к нему истекут сами.
+type RevocationMessage struct {
+	JTI          string     `json:"jti,omitempty"`
+	SessionID    string     `json:"session_id,omitempty"`
+	UserID       int        `json:"user_id"`
+	IssuedBefore *time.Time `json:"issued_before,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+type userRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+// Denylist хранит в памяти отозванные, но еще не истекшие токены
+type Denylist struct {
+	mu        sync.RWMutex
+	tokens    map[string]time.Time
+	sessions  map[string]time.Time
+	users     map[int]userRevocation
+	lastSweep time.Time
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{
+		tokens:    make(map[string]time.Time),
+		sessions:  make(map[string]time.Time),
+		users:     make(map[int]userRevocation),
+		lastSweep: time.Now(),
+	}
+}
+
+// Add запоминает jti до момента, когда токен истечет сам
+func (d *Denylist) Add(jti string, expiresAt time.Time) {
+	if jti == "" || time.Now().After(expiresAt) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tokens[jti] = expiresAt
+	d.sweep()
+}
+
+// AddSession отзывает все токены сессии до момента, когда истекут выпущенные в ней access токены
+func (d *Denylist) AddSession(sessionID string, expiresAt time.Time) {
+	if sessionID == "" || time.Now().After(expiresAt) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sessions[sessionID] = expiresAt
+	d.sweep()
+}
+
+// AddUser отзывает все токены пользователя, выпущенные раньше issuedBefore
+func (d *Denylist) AddUser(userID int, issuedBefore, expiresAt time.Time) {
+	if time.Now().After(expiresAt) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if current, ok := d.users[userID]; ok && current.issuedBefore.After(issuedBefore) {
+		return
+	}
+	d.users[userID] = userRevocation{issuedBefore: issuedBefore, expiresAt: expiresAt}
+	d.sweep()
+}
+
+func (d *Denylist) Contains(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.tokens[jti]
+	return ok
+}
+
+// Revoked проверяет отзыв конкретного токена, его сессии и всех токенов пользователя
+func (d *Denylist) Revoked(claims *CustomClaims) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, ok := d.tokens[claims.ID]; ok {
+		return true
+	}
+	if claims.SessionID != "" {
+		if _, ok := d.sessions[claims.SessionID]; ok {
+			return true
+		}
+	}
+	if r, ok := d.users[claims.UserId]; ok {
+		return claims.IssuedAt == nil || claims.IssuedAt.Before(r.issuedBefore)
+	}
+	return false
+}
+
+// Apply применяет сообщение об отзыве
+func (d *Denylist) Apply(msg RevocationMessage) {
+	if msg.IssuedBefore != nil {
+		d.AddUser(msg.UserID, *msg.IssuedBefore, msg.ExpiresAt)
+		return
+	}
+	if msg.SessionID != "" {
+		d.AddSession(msg.SessionID, msg.ExpiresAt)
+		return
+	}
+	d.Add(msg.JTI, msg.ExpiresAt)
+}
+
+// Load заполняет denylist действующими отзывами из auth сервиса (GET /auth/revocations).
+// Вызывается при старте после подписки на kafka: иначе отзывы, случившиеся до старта, не дойдут.
+// Пока auth сервис недоступен, запрос повторяется retries раз через delay.
+func (d *Denylist) Load(ctx context.Context, url, serviceToken string, retries int, delay time.Duration) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	var err error
+	for i := 0; i < retries; i++ {
+		if err = d.load(ctx, client, url, serviceToken); err == nil {
+			return nil
+		}
+		log.Printf("waiting for revoked tokens from auth service: %v", err)
+		time.Sleep(delay)
+	}
+	return fmt.Errorf("could not load revoked tokens after %d retries: %w", retries, err)
+}
+
+func (d *Denylist) load(ctx context.Context, client *http.Client, url, serviceToken string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(ServiceTokenHeader, serviceToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revocations: unexpected status %d", resp.StatusCode)
+	}
+
+	var revoked []RevocationMessage
+	if err = json.NewDecoder(resp.Body).Decode(&revoked); err != nil {
+		return err
+	}
+	for _, m := range revoked {
+		d.Apply(m)
+	}
+	return nil
+}
+
+// HandleMessage обработчик для kafka.Consumer, остальные типы сообщений игнорируются
+func (d *Denylist) HandleMessage(key, value []byte) {
+	if string(key) != kafka.TokenRevoked {
+		return
+	}
+
+	var msg RevocationMessage
+	if err := json.Unmarshal(value, &msg); err != nil {
+		log.Printf("invalid %s payload: %v", kafka.TokenRevoked, err)
+		return
+	}
+	d.Apply(msg)
+}
+
+// sweep выбрасывает истекшие записи: такие токены и так отклоняются при проверке подписи.
+// Вызывается под d.mu.
+func (d *Denylist) sweep() {
+	if time.Since(d.lastSweep) < time.Minute {
+		return
+	}
+
+	now := time.Now()
+	for id, exp := range d.tokens {
+		if now.After(exp) {
+			delete(d.tokens, id)
+		}
+	}
+	for id, exp := range d.sessions {
+		if now.After(exp) {
+			delete(d.sessions, id)
+		}
+	}
+	for id, r := range d.users {
+		if now.After(r.expiresAt) {
+			delete(d.users, id)
+		}
+	}
+	d.lastSweep = now
+}
@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// минимальный интервал между внеплановыми запросами JWKS при встрече незнакомого kid
+const jwksMissRefreshInterval = 10 * time.Second
+
+// JWKS KeySet, который скачивает открытые ключи auth сервиса и кэширует их на ttl.
+// Незнакомый kid вызывает внеочередное обновление, поэтому ротация ключей не требует перезапуска сервисов.
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// refreshing закрывается, когда идущее обновление закончится; nil — обновления нет
+	refreshing chan struct{}
+}
+
+func NewJWKS(url string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// PublicKey ключ по kid. Запрос к auth сервису идет без блокировки: устаревшие ключи
+// отдаются сразу и обновляются в фоне, а ждут обновления только токены с незнакомым kid.
+func (j *JWKS) PublicKey(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	age := time.Since(j.fetchedAt)
+	switch {
+	case ok && age < j.ttl:
+		j.mu.Unlock()
+		return key, nil
+	case ok:
+		j.startRefresh()
+		j.mu.Unlock()
+		return key, nil
+	case age < jwksMissRefreshInterval && j.refreshing == nil:
+		// не даем токенам с выдуманным kid заставлять нас дергать auth сервис на каждый запрос
+		j.mu.Unlock()
+		return nil, ErrUnknownKey
+	}
+	done := j.startRefresh()
+	j.mu.Unlock()
+
+	<-done
+
+	j.mu.Lock()
+	key, ok = j.keys[kid]
+	j.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// startRefresh запускает обновление ключей, если оно еще не идет, и возвращает канал его завершения.
+// Вызывается под mu.
+func (j *JWKS) startRefresh() chan struct{} {
+	if j.refreshing != nil {
+		return j.refreshing
+	}
+	done := make(chan struct{})
+	j.refreshing = done
+	// время фиксируем и при ошибке, чтобы не повторять запрос чаще jwksMissRefreshInterval
+	j.fetchedAt = time.Now()
+
+	go func() {
+		keys, err := j.fetch()
+
+		j.mu.Lock()
+		if err != nil {
+			// пока auth сервис недоступен, продолжаем пользоваться закэшированными ключами
+			log.Printf("failed to refresh JWKS: %v", err)
+		} else {
+			j.keys = keys
+		}
+		j.refreshing = nil
+		j.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (j *JWKS) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("skipping JWK %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
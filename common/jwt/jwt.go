@@ -1,47 +1,93 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"time"
 )
 
-var ErrInvalidToken = errors.New("invalid token")
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrMFARequired  = errors.New("mfa required")
+	ErrOIDCToken    = errors.New("oidc access token is only valid for userinfo")
+)
+
+// TokenTypeAccess тип access токенов; id_token OIDC подписан тем же ключом, но типа у него нет,
+// поэтому как access токен он не принимается
+const TokenTypeAccess = "access"
 
 type CustomClaims struct {
-	UserId   int    `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+	UserId        int      `json:"user_id"`
+	Username      string   `json:"username"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Role          string   `json:"role"`
+	Permissions   []string `json:"permissions"`
+	// SessionID сессия (вход с устройства), в которой выпущен токен
+	SessionID string `json:"sid,omitempty"`
+	// MFAPending токен выдан после проверки пароля, но до второго фактора.
+	// С ним доступны только эндпоинты второго шага входа и настройки MFA.
+	MFAPending bool `json:"mfa_pending,omitempty"`
+	// Scope заполнен у access токенов, выданных OIDC клиентам; такие токены годятся только для /oauth2/userinfo
+	Scope string `json:"scope,omitempty"`
+	// APIKeyID заполнен, если клиент пришел с API ключом, а не с JWT
+	APIKeyID int `json:"api_key_id,omitempty"`
+	// TokenType тип токена, у access токенов — TokenTypeAccess
+	TokenType string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(secret string, userID int, username, email, role string, ttl time.Duration) (string, error) {
-	claims := CustomClaims{
-		UserId:   userID,
-		Username: username,
-		Email:    email,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// GenerateToken подписывает access токен ключом key. typ, jti, iat и exp заполняются здесь,
+// jti уникален и позволяет отозвать токен до истечения срока.
+func GenerateToken(key *SigningKey, claims CustomClaims, ttl time.Duration) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	now := time.Now()
+	claims.TokenType = TokenTypeAccess
+	claims.ID = jti
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	// по kid проверяющая сторона находит нужный ключ в JWKS
+	token.Header["kid"] = key.KID
 
-	return token.SignedString([]byte(secret))
+	return token.SignedString(key.Private)
 }
 
-func ParseToken(tokenString string, secret []byte) (*CustomClaims, error) {
+// ParseToken проверяет подпись и срок действия токена и возвращает его claims
+func ParseToken(tokenString string, keys KeySet) (*CustomClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		return keys.PublicKey(kid)
+	},
+		// принимаем только асимметричные алгоритмы, чтобы открытый ключ нельзя было использовать как HMAC секрет
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
 	}
 	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
 		return claims, nil
 	}
 	return nil, ErrInvalidToken
 }
+
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
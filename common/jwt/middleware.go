@@ -1,42 +1,127 @@
 package jwt
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// ClaimsKey ключ, под которым middleware кладет claims в gin.Context
+const ClaimsKey = "claims"
+
+// AuthMiddleware проверяет Bearer токен или, если передан resolver, API ключ из X-API-Key,
+// и кладет claims в контекст. Токены из denylist и токены без пройденного второго фактора отклоняются;
+// denylist и apiKeys могут быть nil.
+func AuthMiddleware(keys KeySet, denylist *Denylist, apiKeys APIKeyResolver) gin.HandlerFunc {
+	return authMiddleware(keys, denylist, apiKeys, false)
+}
+
+// MFAPendingMiddleware как AuthMiddleware, но пропускает и mfa_pending токены.
+// Нужен только эндпоинтам, через которые пользователь настраивает MFA во время входа; API ключи не принимаются.
+func MFAPendingMiddleware(keys KeySet, denylist *Denylist) gin.HandlerFunc {
+	return authMiddleware(keys, denylist, nil, true)
+}
+
+func authMiddleware(keys KeySet, denylist *Denylist, apiKeys APIKeyResolver, allowMFAPending bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.Request.Header.Get("Authorization")
-		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+		var claims *CustomClaims
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" && apiKeys != nil {
+			var err error
+			claims, err = apiKeys.ResolveAPIKey(c.Request.Context(), apiKey)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "could not verify api key"})
+				return
+			}
+		} else {
+			tokenString, ok := bearerToken(c)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+				return
+			}
+
+			var err error
+			claims, err = ParseToken(tokenString, keys)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if claims.MFAPending && !allowMFAPending {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrMFARequired.Error()})
+				return
+			}
+			if claims.Scope != "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrOIDCToken.Error()})
+				return
+			}
+			// токены для сторонних клиентов (с aud), id_token и токены, которые нельзя отозвать, не принимаются
+			if !firstPartyAccessToken(claims) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+				return
+			}
+		}
+		if denylist != nil && denylist.Revoked(claims) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrTokenRevoked.Error()})
 			return
 		}
 
+		c.Set(ClaimsKey, claims)
 		c.Next()
 	}
 }
 
-func AuthMiddlewareAdmin(secret string) gin.HandlerFunc {
+// firstPartyAccessToken access токен, выпущенный самим сервисом: с типом, jti и пользователем и без audience
+func firstPartyAccessToken(claims *CustomClaims) bool {
+	return claims.TokenType == TokenTypeAccess && claims.ID != "" && claims.UserId != 0 && len(claims.Audience) == 0
+}
+
+// RequirePermission пропускает только токены с правом permission, ставится после AuthMiddleware
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.Request.Header.Get("Authorization")
-		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+		claims, ok := ClaimsFromContext(c)
+		if !ok || !claims.HasPermission(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
 			return
 		}
-		claims, err := ParseToken(tokenString, []byte(secret))
 
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			return
-		}
+		c.Next()
+	}
+}
 
-		role := claims.Role
-		if role != "admin" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Permission denied"})
+// RequireVerifiedEmail пропускает только пользователей с подтвержденным email,
+// ставится после AuthMiddleware
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c)
+		if !ok || !claims.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified"})
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// ClaimsFromContext возвращает claims, положенные AuthMiddleware
+func ClaimsFromContext(c *gin.Context) (*CustomClaims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*CustomClaims)
+	return claims, ok
+}
+
+// bearerToken достает токен из заголовка "Authorization: Bearer <token>"
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,62 @@
+package jwt
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"time"
+)
+
+// IDTokenClaims id_token OpenID Connect; sub — id пользователя, aud — client_id
+type IDTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken подписывает id_token тем же ключом, что и access токены, поэтому
+// клиент проверяет его по тому же JWKS
+func GenerateIDToken(key *SigningKey, claims IDTokenClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.KID
+
+	return token.SignedString(key.Private)
+}
+
+// OIDCMiddleware обратная сторона AuthMiddleware: пропускает только access токены,
+// выпущенные OIDC клиентам (со scope). Ошибки отдаются в формате RFC 6750.
+func OIDCMiddleware(keys KeySet, denylist *Denylist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := bearerToken(c)
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "error_description": "bearer token missing"})
+			return
+		}
+
+		claims, err := ParseToken(tokenString, keys)
+		if err == nil && (claims.Scope == "" || claims.TokenType != TokenTypeAccess || claims.ID == "") {
+			err = ErrInvalidToken
+		}
+		if err == nil && denylist != nil && denylist.Revoked(claims) {
+			err = ErrTokenRevoked
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "error_description": err.Error()})
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
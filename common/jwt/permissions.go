@@ -0,0 +1,22 @@
+package jwt
+
+// Права, которые auth сервис кладет в токен в зависимости от роли (таблица role_permissions)
+const (
+	PermEventCreate     = "event:create"
+	PermEventUpdate     = "event:update"
+	PermEventModerate   = "event:moderate"
+	PermEventRegister   = "event:register"
+	PermReviewWrite     = "review:write"
+	PermReviewDeleteAny = "review:delete:any"
+	PermUserManage      = "user:manage"
+)
+
+// HasPermission проверяет, есть ли право в токене
+func (c *CustomClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package jwt
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ServiceTokenHeader заголовок с общим секретом сервисов для внутренних эндпоинтов
+const ServiceTokenHeader = "X-Service-Token"
+
+// RequireServiceToken пропускает только запросы других сервисов с секретом token.
+// Пустой token закрывает эндпоинт для всех.
+func RequireServiceToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(ServiceTokenHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "service token required"})
+			return
+		}
+
+		c.Next()
+	}
+}
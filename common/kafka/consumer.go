@@ -72,7 +72,8 @@ func (c *Consumer) StartListening(ctx context.Context, handler func(key, value [
 			log.Printf("error reading message: %v", err)
 			continue
 		}
-		log.Printf("received message key=%s value=%s", string(m.Key), string(m.Value))
+		// тело не логируем: в нем бывают ссылки с токенами
+		log.Printf("received message topic=%s key=%s", m.Topic, string(m.Key))
 		handler(m.Key, m.Value)
 	}
 }
@@ -1,10 +1,26 @@
 package kafka
 
 const (
-	EventCreated        = "event.created"
-	RegistrationCreated = "registration.created"
-	RegistrationDeleted = "registration.deleted"
-	ReviewCreated       = "review.created"
-	ReviewUpdated       = "review.updated"
-	ReviewDeleted       = "review.deleted"
+	EventCreated             = "event.created"
+	EventUpdated             = "event.updated"
+	EventCancelled           = "event.cancelled"
+	EventDeleted             = "event.deleted"
+	RegistrationCreated      = "registration.created"
+	RegistrationDeleted      = "registration.deleted"
+	RegistrationRejectedFull = "registration.rejected_full"
+	WaitlistJoined           = "waitlist.joined"
+	WaitlistPromoted         = "waitlist.promoted"
+	WaitlistExpired          = "waitlist.expired"
+	ReviewCreated            = "review.created"
+	ReviewUpdated            = "review.updated"
+	ReviewDeleted            = "review.deleted"
+	TokenRevoked             = "user.token_revoked"
+	PasswordResetRequested   = "user.password_reset_requested"
+	UserRegistered           = "user.registered"
+	UserRoleChanged          = "user.role_changed"
+	UserUpdated              = "user.updated"
+	UserLocked               = "user.locked"
+	UserDeleted              = "user.deleted"
+	UserSuspended            = "user.suspended"
+	UserReactivated          = "user.reactivated"
 )
@@ -56,7 +56,10 @@ func WaitForPostgres(ctx context.Context, cfg Config, retries int, delay time.Du
 }
 
 func Migrate(ctx context.Context, cfg Config, migrationsPath string) error {
-	connString := cfg.GetConnString()
+	// у каждого сервиса своя таблица версий, иначе номера миграций разных сервисов конфликтуют.
+	// База, которая жила с общей schema_migrations, проходит миграции сервиса заново с первой версии,
+	// поэтому миграции должны выдерживать повторный запуск (if not exists)
+	connString := cfg.GetConnString() + "&x-migrations-table=" + migrationsTable(migrationsPath)
 	m, err := migrate.New(
 		migrationsPath,
 		connString,
@@ -92,6 +95,13 @@ func Migrate(ctx context.Context, cfg Config, migrationsPath string) error {
 	return nil
 }
 
+// migrationsTable строит имя таблицы версий из каталога миграций, например
+// "file://migrations/user-interact" -> "schema_migrations_user_interact"
+func migrationsTable(migrationsPath string) string {
+	name := migrationsPath[strings.LastIndex(migrationsPath, "/")+1:]
+	return "schema_migrations_" + strings.ReplaceAll(name, "-", "_")
+}
+
 func (c *Config) GetConnString() string {
 	connString := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
 		c.Username,
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"eventify/common/jwt"
 	"eventify/common/kafka"
 	"eventify/common/logger"
 	"eventify/common/postgres"
 	"eventify/event/internal/config"
+	"eventify/event/internal/geo"
 	"eventify/event/internal/handler"
 	"eventify/event/internal/repository"
 	"eventify/event/internal/service"
@@ -13,7 +15,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
 	"time"
+	// часовые пояса повторяющихся событий не зависят от системной базы tzdata
+	_ "time/tzdata"
 )
 
 func main() {
@@ -37,11 +42,42 @@ func main() {
 	producer := kafka.NewProducer([]string{"kafka:9092"}, "events")
 	defer producer.Close()
 
-	eventService := service.NewEventService(eventRepo, producer)
-	eventHandler := handler.NewEventHandler(eventService, router)
+	// у каждого экземпляра своя группа, чтобы отзывы токенов доходили до всех экземпляров
+	denylist := jwt.NewDenylist()
+	hostname, _ := os.Hostname()
+	revocations := kafka.NewConsumer([]string{"kafka:9092"}, "events", "event-service-denylist-"+hostname)
+	defer revocations.Close()
+	go revocations.StartListening(ctx, denylist.HandleMessage)
+	// kafka доставляет только новые отзывы, отозванные до старта токены берем у auth сервиса
+	if err = denylist.Load(ctx, cfg.Event.RevocationsURL, cfg.Event.ServiceToken, 30, 2*time.Second); err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "failed to load revoked tokens", zap.Error(err))
+	}
+
+	gazetteer, err := geo.LoadGazetteer(cfg.Event.GazetteerFile)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "failed to load gazetteer", zap.Error(err))
+	}
+	eventService := service.NewEventService(eventRepo, producer, gazetteer, cfg.Event.OccurrenceHorizon, cfg.Event.CalendarURL)
+	go eventService.RunOccurrenceMaterializer(ctx, cfg.Event.OccurrenceRefreshInterval)
+
+	// события без координат, например созданные до их появления, получают координаты из справочника
+	located, err := eventService.GeocodeEvents(ctx)
+	if err != nil {
+		logger.GetLoggerFromCtx(ctx).Error(ctx, "failed to geocode events", zap.Error(err))
+	} else if located > 0 {
+		logger.GetLoggerFromCtx(ctx).Info(ctx, "geocoded events", zap.Int("count", located))
+	}
+	keys := jwt.NewJWKS(cfg.Event.JWKSURL, cfg.Event.JWKSCacheTTL)
+	apiKeys := jwt.NewAPIKeyIntrospector(cfg.Event.APIKeyIntrospectionURL, cfg.Event.ServiceToken, cfg.Event.APIKeyCacheTTL)
+	eventHandler := handler.NewEventHandler(eventService, router, keys, denylist, apiKeys, cfg.Event.RequireEmailVerification)
 
 	eventHandler.RegisterRoutes()
 
+	// изменения пользователей из auth сервиса, одна группа на все экземпляры сервиса
+	users := kafka.NewConsumer([]string{"kafka:9092"}, "events", "event-service")
+	defer users.Close()
+	go users.StartListening(ctx, eventHandler.HandleMessage)
+
 	go func() {
 		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Event.Port), router); err != nil {
 			logger.GetLoggerFromCtx(ctx).Fatal(ctx, "auth service failed to start", zap.Error(err))
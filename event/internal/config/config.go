@@ -4,11 +4,31 @@ import (
 	"eventify/common/postgres"
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"time"
 )
 
 type EventConfig struct {
-	Port          int    `yaml:"port" env:"PORT"`
-	MigrationPath string `yaml:"migration-path" env:"MIGRATION_PATH"`
+	Port          int           `yaml:"port" env:"PORT"`
+	MigrationPath string        `yaml:"migration-path" env:"MIGRATION_PATH"`
+	JWKSURL       string        `yaml:"jwks-url" env:"JWKS_URL" env-default:"http://auth-service:8081/.well-known/jwks.json"`
+	JWKSCacheTTL  time.Duration `yaml:"jwks-cache-ttl" env:"JWKS_CACHE_TTL" env-default:"10m"`
+	// APIKeyIntrospectionURL эндпоинт auth сервиса, который проверяет X-API-Key
+	APIKeyIntrospectionURL string        `yaml:"api-key-introspection-url" env:"API_KEY_INTROSPECTION_URL" env-default:"http://auth-service:8081/auth/api-keys/introspect"`
+	APIKeyCacheTTL         time.Duration `yaml:"api-key-cache-ttl" env:"API_KEY_CACHE_TTL" env-default:"1m"`
+	// RevocationsURL эндпоинт auth сервиса с действующими отзывами токенов, читается при старте
+	RevocationsURL string `yaml:"revocations-url" env:"REVOCATIONS_URL" env-default:"http://auth-service:8081/auth/revocations"`
+	// ServiceToken общий секрет сервисов для внутренних эндпоинтов auth сервиса
+	ServiceToken string `yaml:"service-token" env:"SERVICE_TOKEN"`
+	// RequireEmailVerification разрешает создавать события только с подтвержденным email
+	RequireEmailVerification bool `yaml:"require-email-verification" env:"REQUIRE_EMAIL_VERIFICATION" env-default:"true"`
+	// GazetteerFile CSV с координатами городов и площадок для событий без координат
+	GazetteerFile string `yaml:"gazetteer-file" env:"GAZETTEER_FILE" env-default:"configs/gazetteer.csv"`
+	// OccurrenceHorizon на сколько вперед создаются вхождения повторяющихся событий
+	OccurrenceHorizon time.Duration `yaml:"occurrence-horizon" env:"OCCURRENCE_HORIZON" env-default:"2160h"`
+	// OccurrenceRefreshInterval как часто горизонт сдвигается вперед
+	OccurrenceRefreshInterval time.Duration `yaml:"occurrence-refresh-interval" env:"OCCURRENCE_REFRESH_INTERVAL" env-default:"1h"`
+	// CalendarURL внешний адрес лент календаря GET /calendar/{token}.ics, без токена
+	CalendarURL string `yaml:"calendar-url" env:"CALENDAR_URL" env-default:"http://localhost/calendar"`
 }
 
 type Config struct {
@@ -0,0 +1,99 @@
+package geo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Point координаты в градусах
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Valid проверяет, что координаты в допустимых пределах; NaN не проходит
+func Valid(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// Gazetteer справочник координат городов и площадок для геокодирования без внешних сервисов
+type Gazetteer struct {
+	cities map[string]Point
+	venues map[string]Point
+}
+
+// LoadGazetteer читает CSV: city,venue,latitude,longitude. Строка с пустым venue — центр города,
+// строки с # пропускаются. Пустой path — пустой справочник.
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	g := &Gazetteer{cities: map[string]Point{}, venues: map[string]Point{}}
+	if path == "" {
+		return g, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open gazetteer: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 4
+	r.TrimLeadingSpace = true
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read gazetteer: %w", err)
+		}
+		if record[0] == "city" {
+			// заголовок
+			continue
+		}
+
+		lat, errLat := strconv.ParseFloat(record[2], 64)
+		lon, errLon := strconv.ParseFloat(record[3], 64)
+		if errLat != nil || errLon != nil || !Valid(lat, lon) {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("invalid coordinates in gazetteer line %d", line)
+		}
+
+		city, venue := normalize(record[0]), normalize(record[1])
+		if venue == "" {
+			g.cities[city] = Point{Lat: lat, Lon: lon}
+		} else {
+			g.venues[city+"|"+venue] = Point{Lat: lat, Lon: lon}
+		}
+	}
+	return g, nil
+}
+
+// Lookup координаты площадки, а если ее нет в справочнике — центра города
+func (g *Gazetteer) Lookup(city, venue string) (Point, bool) {
+	city = normalize(city)
+	if p, ok := g.venues[city+"|"+normalize(venue)]; ok && venue != "" {
+		return p, true
+	}
+	p, ok := g.cities[city]
+	return p, ok
+}
+
+// normalize приводит название к ключу справочника: регистр, ё, кавычки и лишние пробелы не важны
+func normalize(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
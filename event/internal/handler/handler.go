@@ -1,22 +1,44 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventify/common/jwt"
+	"eventify/common/kafka"
 	"eventify/event/internal/models"
 	"eventify/event/internal/service"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// calendarContentType тип ответов в формате iCalendar
+const calendarContentType = "text/calendar; charset=utf-8"
+
 type EventHandler struct {
-	service *service.EventService
-	router  *gin.Engine
+	service  *service.EventService
+	router   *gin.Engine
+	keys     jwt.KeySet
+	denylist *jwt.Denylist
+	apiKeys  jwt.APIKeyResolver
+
+	requireEmailVerification bool
 }
 
-func NewEventHandler(service *service.EventService, router *gin.Engine) *EventHandler {
+func NewEventHandler(service *service.EventService, router *gin.Engine, keys jwt.KeySet, denylist *jwt.Denylist, apiKeys jwt.APIKeyResolver, requireEmailVerification bool) *EventHandler {
 	return &EventHandler{
-		service: service,
-		router:  gin.Default(),
+		service:  service,
+		router:   router,
+		keys:     keys,
+		denylist: denylist,
+		apiKeys:  apiKeys,
+
+		requireEmailVerification: requireEmailVerification,
 	}
 }
 
@@ -32,6 +54,14 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 		return
 	}
 
+	// организатор берется из токена, а не из тела запроса
+	claims, _ := jwt.ClaimsFromContext(c)
+	req.Organizer = models.Organizer{
+		ID:       uint(claims.UserId),
+		Username: claims.Username,
+		Email:    claims.Email,
+	}
+
 	if err := h.service.CreateEvent(ctx, req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -40,19 +70,72 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "event created"})
 }
 
-// GetEvents получаем все ивенты
+// GetEvents страница событий с фильтрами и сортировкой
 func (h *EventHandler) GetEvents(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	// получаем все event
-	var events []models.EventResp
+	var filter models.EventFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := h.service.GetEvents(ctx, &events); err != nil {
+	page, err := h.service.ListEvents(ctx, filter)
+	if errors.Is(err, service.ErrInvalidFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be start_time, created_at or popularity and order asc or desc"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchEvents полнотекстовый поиск событий по ?q=
+func (h *EventHandler) SearchEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	results, err := h.service.SearchEvents(ctx, c.Query("q"), limit, offset)
+	if errors.Is(err, service.ErrInvalidSearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// NearbyEvents события рядом с точкой ?lat=&lon=&radius_km=
+func (h *EventHandler) NearbyEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var filter models.NearbyFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := h.service.NearbyEvents(ctx, filter)
+	if errors.Is(err, service.ErrInvalidLocation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
 }
 
 // GetEventById получение ивента по id
@@ -69,19 +152,377 @@ func (h *EventHandler) GetEventById(c *gin.Context) {
 	// запрашиваем event по ID
 	var e models.EventResp
 
-	if err = h.service.GetEventByID(ctx, eventID, &e); err != nil {
+	err = h.service.GetEventByID(ctx, eventID, &e)
+	if errors.Is(err, service.ErrEventNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, e)
+
+}
+
+// UpdateEvent частичное изменение события организатором или модератором
+func (h *EventHandler) UpdateEvent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	var req models.EventUpdateReq
+	if err = c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	claims, anyEvent, ok := eventManager(c)
+	if !ok {
+		return
+	}
+
+	e, err := h.service.UpdateEvent(ctx, eventID, claims.UserId, anyEvent, req)
+	if writeEventError(c, err) {
+		return
+	}
 	c.JSON(http.StatusOK, e)
+}
+
+// CancelEvent отменяет событие, тело с причиной необязательно
+func (h *EventHandler) CancelEvent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	var req models.CancelEventReq
+	if c.Request.ContentLength > 0 {
+		if err = c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims, anyEvent, ok := eventManager(c)
+	if !ok {
+		return
+	}
 
+	err = h.service.CancelEvent(ctx, eventID, claims.UserId, anyEvent, req.Reason)
+	if writeEventError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "event cancelled"})
+}
+
+func (h *EventHandler) DeleteEvent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	claims, anyEvent, ok := eventManager(c)
+	if !ok {
+		return
+	}
+
+	err = h.service.DeleteEvent(ctx, eventID, claims.UserId, anyEvent)
+	if writeEventError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "event deleted"})
+}
+
+// GetOccurrences вхождения события, ?from= и ?to= по времени начала
+func (h *EventHandler) GetOccurrences(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	var filter models.OccurrenceFilter
+	if err = c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	occurrences, err := h.service.ListOccurrences(ctx, eventID, filter)
+	if writeEventError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"occurrences": occurrences})
+}
+
+// UpdateOccurrence изменение вхождения: ?scope=this — только его, ?scope=following — его и следующих
+func (h *EventHandler) UpdateOccurrence(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+	occurrenceID, err := strconv.Atoi(c.Param("occurrence_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid occurrence ID"})
+		return
+	}
+	scope := c.DefaultQuery("scope", models.ScopeThis)
+	if scope != models.ScopeThis && scope != models.ScopeFollowing {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be this or following"})
+		return
+	}
+
+	var req models.EventUpdateReq
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, anyEvent, ok := eventManager(c)
+	if !ok {
+		return
+	}
+
+	if scope == models.ScopeFollowing {
+		e, err := h.service.UpdateFollowing(ctx, eventID, occurrenceID, claims.UserId, anyEvent, req)
+		if writeEventError(c, err) {
+			return
+		}
+		c.JSON(http.StatusOK, e)
+		return
+	}
+
+	o, err := h.service.UpdateOccurrence(ctx, eventID, occurrenceID, claims.UserId, anyEvent, req)
+	if writeEventError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// CancelOccurrence отменяет одно вхождение, тело с причиной необязательно
+func (h *EventHandler) CancelOccurrence(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+	occurrenceID, err := strconv.Atoi(c.Param("occurrence_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid occurrence ID"})
+		return
+	}
+
+	var req models.CancelEventReq
+	if c.Request.ContentLength > 0 {
+		if err = c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims, anyEvent, ok := eventManager(c)
+	if !ok {
+		return
+	}
+
+	err = h.service.CancelOccurrence(ctx, eventID, occurrenceID, claims.UserId, anyEvent, req.Reason)
+	if writeEventError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "occurrence cancelled"})
+}
+
+// GetEventCalendar событие в формате iCalendar для импорта в календарь
+func (h *EventHandler) GetEventCalendar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	data, err := h.service.EventCalendar(ctx, eventID)
+	if writeEventError(c, err) {
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d.ics"`, eventID))
+	c.Data(http.StatusOK, calendarContentType, data)
+}
+
+// GetCalendarFeed лента записей пользователя для подписки, доступ по токену в адресе вместо авторизации
+func (h *EventHandler) GetCalendarFeed(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrCalendarNotFound.Error()})
+		return
+	}
+
+	data, err := h.service.CalendarFeed(ctx, token)
+	if errors.Is(err, service.ErrCalendarNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, calendarContentType, data)
+}
+
+// CreateCalendarToken выпускает токен подписки на календарь текущего пользователя, прежний отзывается
+func (h *EventHandler) CreateCalendarToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	resp, err := h.service.CreateCalendarToken(ctx, claims.UserId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// RevokeCalendarToken отзывает токен подписки текущего пользователя
+func (h *EventHandler) RevokeCalendarToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	err := h.service.RevokeCalendarToken(ctx, claims.UserId)
+	if errors.Is(err, service.ErrCalendarNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "calendar token revoked"})
+}
+
+// eventManager менять можно свои события с правом event:update, а с event:moderate — любые
+func eventManager(c *gin.Context) (*jwt.CustomClaims, bool, bool) {
+	claims, _ := jwt.ClaimsFromContext(c)
+	anyEvent := claims.HasPermission(jwt.PermEventModerate)
+	if !anyEvent && !claims.HasPermission(jwt.PermEventUpdate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		return nil, false, false
+	}
+	return claims, anyEvent, true
+}
+
+// writeEventError отвечает на ошибку изменения события, возвращает false, если ошибки нет
+func writeEventError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, service.ErrEventNotFound), errors.Is(err, service.ErrOccurrenceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRecurrence), errors.Is(err, service.ErrOccurrenceField):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotOrganizer):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEventCancelled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidEvent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event: title must not be empty, end_time must be after start_time and latitude with longitude must be set together and be in range"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+// ExportMyData данные текущего пользователя для выгрузки через /auth/me/export
+func (h *EventHandler) ExportMyData(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	export, err := h.service.ExportUserData(ctx, claims.UserId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, export)
 }
 
 // RegisterRoutes собираем все хендлеры в одну функцию
 func (h *EventHandler) RegisterRoutes() {
 	events := h.router.Group("/events")
-	events.POST("/", h.CreateEvent)
+
+	// создавать события можно только с подтвержденным email, если это включено в конфиге
+	create := []gin.HandlerFunc{jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), jwt.RequirePermission(jwt.PermEventCreate)}
+	if h.requireEmailVerification {
+		create = append(create, jwt.RequireVerifiedEmail())
+	}
+
+	events.POST("/", append(create, h.CreateEvent)...)
 	events.GET("/", h.GetEvents)
+	events.GET("/search", h.SearchEvents)
+	events.GET("/nearby", h.NearbyEvents)
 	events.GET("/:id", h.GetEventById)
+	events.PATCH("/:id", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.UpdateEvent)
+	events.POST("/:id/cancel", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.CancelEvent)
+	events.DELETE("/:id", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.DeleteEvent)
+	events.GET("/:id/occurrences", h.GetOccurrences)
+	events.PATCH("/:id/occurrences/:occurrence_id", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.UpdateOccurrence)
+	events.POST("/:id/occurrences/:occurrence_id/cancel", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.CancelOccurrence)
+	events.GET("/:id/ics", h.GetEventCalendar)
+	events.POST("/me/calendar", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.CreateCalendarToken)
+	events.DELETE("/me/calendar", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.RevokeCalendarToken)
+	events.GET("/me/export", jwt.AuthMiddleware(h.keys, h.denylist, h.apiKeys), h.ExportMyData)
+
+	// лента календаря для подписки: календарные приложения не умеют авторизоваться, доступ по токену в адресе
+	h.router.GET("/calendar/:file", h.GetCalendarFeed)
+}
+
+// HandleMessage обработчик сообщений kafka от других сервисов
+func (h *EventHandler) HandleMessage(key, value []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch string(key) {
+	case kafka.UserUpdated:
+		var payload struct {
+			UserID   int    `json:"user_id"`
+			Username string `json:"username"`
+		}
+		if err := json.Unmarshal(value, &payload); err != nil {
+			log.Printf("invalid %s payload: %v", kafka.UserUpdated, err)
+			return
+		}
+		if err := h.service.UpdateUsername(ctx, payload.UserID, payload.Username); err != nil {
+			log.Printf("failed to update username of user %d: %v", payload.UserID, err)
+		}
+	case kafka.UserDeleted:
+		var payload struct {
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(value, &payload); err != nil {
+			log.Printf("invalid %s payload: %v", kafka.UserDeleted, err)
+			return
+		}
+		if err := h.service.DeleteUserData(ctx, payload.UserID); err != nil {
+			log.Printf("failed to delete data of user %d: %v", payload.UserID, err)
+		}
+	}
 }
@@ -0,0 +1,293 @@
+// Package ical формирует календари iCalendar (RFC 5545) для импорта и подписки в календарных приложениях
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	utcLayout   = "20060102T150405Z"
+	localLayout = "20060102T150405"
+	// maxLineOctets длина строки без CRLF, длиннее строки переносятся
+	maxLineOctets = 75
+	// zoneSpan на сколько после последнего события описываются переходы часового пояса,
+	// чтобы повторения без конца попадали в правильные смещения
+	zoneSpan = 3 * 365 * 24 * time.Hour
+)
+
+// Event VEVENT. Время пишется в часовом поясе Location с его VTIMEZONE, без него и для UTC — в UTC.
+type Event struct {
+	UID      string
+	Sequence int
+	Start    time.Time
+	End      time.Time
+	Location *time.Location
+	// RecurrenceID исходное начало измененного вхождения серии с тем же UID
+	RecurrenceID *time.Time
+	// RRule правило повторения без префикса "RRULE:"
+	RRule   string
+	ExDates []time.Time
+
+	Summary     string
+	Description string
+	Place       string
+	Latitude    *float64
+	Longitude   *float64
+
+	OrganizerName  string
+	OrganizerEmail string
+
+	Cancelled    bool
+	Created      time.Time
+	LastModified *time.Time
+}
+
+// Calendar VCALENDAR. RefreshInterval — как часто подписанному календарю перечитывать ленту, 0 — не указывать.
+type Calendar struct {
+	Name            string
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// Encode пишет календарь в w; stamp — DTSTAMP событий, время формирования календаря
+func (c Calendar) Encode(w io.Writer, stamp time.Time) error {
+	var b writer
+	b.line("BEGIN", "VCALENDAR")
+	b.line("VERSION", "2.0")
+	b.line("PRODID", "-//Eventify//Eventify Calendar//RU")
+	b.line("CALSCALE", "GREGORIAN")
+	b.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		b.line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	if c.RefreshInterval > 0 {
+		b.line("REFRESH-INTERVAL;VALUE=DURATION", formatDuration(c.RefreshInterval))
+		b.line("X-PUBLISHED-TTL", formatDuration(c.RefreshInterval))
+	}
+
+	for _, z := range c.zones(stamp) {
+		b.timezone(z.loc, z.from, z.to)
+	}
+	for _, e := range c.Events {
+		b.event(e, stamp)
+	}
+
+	b.line("END", "VCALENDAR")
+	_, err := w.Write(b.buf.Bytes())
+	return err
+}
+
+type zone struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// zones часовые пояса событий и промежутки, на которые нужны их переходы
+func (c Calendar) zones(stamp time.Time) []zone {
+	byName := map[string]*zone{}
+	for _, e := range c.Events {
+		if isUTC(e.Location) {
+			continue
+		}
+		times := append([]time.Time{e.Start, e.End}, e.ExDates...)
+		if e.RecurrenceID != nil {
+			times = append(times, *e.RecurrenceID)
+		}
+
+		z, ok := byName[e.Location.String()]
+		if !ok {
+			z = &zone{loc: e.Location, from: e.Start, to: stamp}
+			byName[e.Location.String()] = z
+		}
+		for _, t := range times {
+			if t.Before(z.from) {
+				z.from = t
+			}
+			if t.After(z.to) {
+				z.to = t
+			}
+		}
+	}
+
+	zones := make([]zone, 0, len(byName))
+	for _, z := range byName {
+		z.to = z.to.Add(zoneSpan)
+		zones = append(zones, *z)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].loc.String() < zones[j].loc.String() })
+	return zones
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+// line пишет свойство name:value, длинные строки переносятся по RFC 5545
+func (w *writer) line(name, value string) {
+	line := name + ":" + value
+	n := 0
+	for i := 0; i < len(line); {
+		// перенос только между символами, чтобы не разрезать UTF-8
+		_, size := utf8.DecodeRuneInString(line[i:])
+		if n+size > maxLineOctets {
+			w.buf.WriteString("\r\n ")
+			n = 1
+		}
+		w.buf.WriteString(line[i : i+size])
+		n += size
+		i += size
+	}
+	w.buf.WriteString("\r\n")
+}
+
+// time пишет свойство-время в часовом поясе loc
+func (w *writer) time(name string, t time.Time, loc *time.Location) {
+	if isUTC(loc) {
+		w.line(name, t.UTC().Format(utcLayout))
+		return
+	}
+	w.line(name+";TZID="+loc.String(), t.In(loc).Format(localLayout))
+}
+
+func (w *writer) event(e Event, stamp time.Time) {
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", e.UID)
+	w.line("DTSTAMP", stamp.UTC().Format(utcLayout))
+	w.line("SEQUENCE", strconv.Itoa(e.Sequence))
+	if e.RecurrenceID != nil {
+		w.time("RECURRENCE-ID", *e.RecurrenceID, e.Location)
+	}
+	w.time("DTSTART", e.Start, e.Location)
+	w.time("DTEND", e.End, e.Location)
+	if e.RRule != "" {
+		w.line("RRULE", e.RRule)
+	}
+	if len(e.ExDates) > 0 {
+		dates := make([]string, len(e.ExDates))
+		for i, t := range e.ExDates {
+			if isUTC(e.Location) {
+				dates[i] = t.UTC().Format(utcLayout)
+			} else {
+				dates[i] = t.In(e.Location).Format(localLayout)
+			}
+		}
+		name := "EXDATE"
+		if !isUTC(e.Location) {
+			name += ";TZID=" + e.Location.String()
+		}
+		w.line(name, strings.Join(dates, ","))
+	}
+
+	w.line("SUMMARY", escapeText(e.Summary))
+	if e.Description != "" {
+		w.line("DESCRIPTION", escapeText(e.Description))
+	}
+	if e.Place != "" {
+		w.line("LOCATION", escapeText(e.Place))
+	}
+	if e.Latitude != nil && e.Longitude != nil {
+		w.line("GEO", strconv.FormatFloat(*e.Latitude, 'f', -1, 64)+";"+strconv.FormatFloat(*e.Longitude, 'f', -1, 64))
+	}
+	if e.OrganizerEmail != "" {
+		name := "ORGANIZER"
+		if e.OrganizerName != "" {
+			// в значении параметра не бывает кавычек
+			name += `;CN="` + strings.ReplaceAll(e.OrganizerName, `"`, "") + `"`
+		}
+		w.line(name, "mailto:"+e.OrganizerEmail)
+	}
+
+	status := "CONFIRMED"
+	if e.Cancelled {
+		status = "CANCELLED"
+	}
+	w.line("STATUS", status)
+	if !e.Created.IsZero() {
+		w.line("CREATED", e.Created.UTC().Format(utcLayout))
+	}
+	if e.LastModified != nil {
+		w.line("LAST-MODIFIED", e.LastModified.UTC().Format(utcLayout))
+	}
+	w.line("END", "VEVENT")
+}
+
+// timezone пишет VTIMEZONE с переходами loc между from и to: смещение, действующее в from,
+// и все следующие смены смещения по базе часовых поясов Go
+func (w *writer) timezone(loc *time.Location, from, to time.Time) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", loc.String())
+
+	t := from.In(loc)
+	start, _ := t.ZoneBounds()
+	for {
+		name, offset := t.Zone()
+		// пояс без переходов действует с начала времен
+		prev, begin := offset, "19700101T000000"
+		if !start.IsZero() {
+			_, prev = start.Add(-time.Second).Zone()
+			begin = start.In(time.FixedZone("", prev)).Format(localLayout)
+		}
+
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		w.line("BEGIN", kind)
+		w.line("DTSTART", begin)
+		w.line("TZOFFSETFROM", formatOffset(prev))
+		w.line("TZOFFSETTO", formatOffset(offset))
+		w.line("TZNAME", escapeText(name))
+		w.line("END", kind)
+
+		_, end := t.ZoneBounds()
+		if end.IsZero() || end.After(to) {
+			break
+		}
+		t, start = end, end
+	}
+
+	w.line("END", "VTIMEZONE")
+}
+
+func isUTC(loc *time.Location) bool {
+	return loc == nil || loc == time.UTC || loc.String() == "UTC"
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeText экранирует значение типа TEXT
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// formatOffset смещение UTC в виде +0300
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds%3600/60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+// formatDuration длительность в виде PT1H30M
+func formatDuration(d time.Duration) string {
+	s := "PT"
+	if h := int(d.Hours()); h > 0 {
+		s += strconv.Itoa(h) + "H"
+	}
+	if m := int(d.Minutes()) % 60; m > 0 || d < time.Minute {
+		s += strconv.Itoa(m) + "M"
+	}
+	return s
+}
@@ -0,0 +1,275 @@
+package ical
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+var update = flag.Bool("update", false, "перезаписать эталонные календари в testdata")
+
+var stamp = time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// golden сравнивает календарь с testdata/name.ics
+func golden(t *testing.T, name string, c Calendar) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, stamp); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", name+".ics")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("calendar differs from %s:\n got:\n%s\nwant:\n%s", path, got, want)
+	}
+	checkLines(t, got)
+}
+
+// checkLines строки не длиннее 75 октетов, заканчиваются CRLF и не режут UTF-8
+func checkLines(t *testing.T, data []byte) {
+	t.Helper()
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		t.Error("calendar does not end with CRLF")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line %d is %d octets: %q", i+1, len(line), line)
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("line %d has a bare LF: %q", i+1, line)
+		}
+		if !utf8Valid(line) {
+			t.Errorf("line %d splits a multi-byte character: %q", i+1, line)
+		}
+	}
+}
+
+func utf8Valid(s string) bool {
+	return strings.ToValidUTF8(s, "\uFFFD") == s
+}
+
+func TestLineFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{
+			name:  "exactly 75 octets",
+			value: strings.Repeat("a", 75-len("SUMMARY:")),
+			want:  "SUMMARY:" + strings.Repeat("a", 67) + "\r\n",
+		},
+		{
+			name:  "76 octets",
+			value: strings.Repeat("a", 76-len("SUMMARY:")),
+			want:  "SUMMARY:" + strings.Repeat("a", 67) + "\r\n a\r\n",
+		},
+		{
+			// 2-байтовая "ж" на октетах 75-76 переносится целиком
+			name:  "two-byte rune across the boundary",
+			value: strings.Repeat("a", 66) + "жb",
+			want:  "SUMMARY:" + strings.Repeat("a", 66) + "\r\n жb\r\n",
+		},
+		{
+			// 2-байтовая "ж" на октетах 74-75 помещается в первую строку
+			name:  "two-byte rune ending at 75 octets",
+			value: strings.Repeat("a", 65) + "жb",
+			want:  "SUMMARY:" + strings.Repeat("a", 65) + "ж\r\n b\r\n",
+		},
+		{
+			// 4-байтовый эмодзи на октетах 73-76 переносится целиком
+			name:  "four-byte rune across the boundary",
+			value: strings.Repeat("a", 64) + "🎉",
+			want:  "SUMMARY:" + strings.Repeat("a", 64) + "\r\n 🎉\r\n",
+		},
+		{
+			// продолжения тоже не длиннее 75 октетов вместе с пробелом в начале
+			name:  "cyrillic continuation lines",
+			value: strings.Repeat("я", 100),
+			want: "SUMMARY:" + strings.Repeat("я", 33) + "\r\n " +
+				strings.Repeat("я", 37) + "\r\n " + strings.Repeat("я", 30) + "\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w writer
+			w.line("SUMMARY", tt.value)
+			got := w.buf.String()
+			if got != tt.want {
+				t.Errorf("line():\n got %q\nwant %q", got, tt.want)
+			}
+			checkLines(t, w.buf.Bytes())
+
+			// после разворачивания по RFC 5545 значение не меняется
+			if unfolded := strings.ReplaceAll(got, "\r\n ", ""); unfolded != "SUMMARY:"+tt.value+"\r\n" {
+				t.Errorf("unfolded line = %q", unfolded)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "Концерт", want: "Концерт"},
+		{in: "Москва, ул. Примерная; д. 1", want: `Москва\, ул. Примерная\; д. 1`},
+		{in: `C:\path`, want: `C:\\path`},
+		{in: "строка 1\nстрока 2", want: `строка 1\nстрока 2`},
+		{in: "строка 1\r\nстрока 2\rстрока 3", want: `строка 1\nстрока 2\nстрока 3`},
+		{in: `\,;`, want: `\\\,\;`},
+		{in: `"кавычки" и двоеточие:`, want: `"кавычки" и двоеточие:`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeEvent(t *testing.T) {
+	lat, lon := 55.7558, 37.6173
+	modified := time.Date(2025, 9, 20, 8, 30, 0, 0, time.UTC)
+
+	golden(t, "event", Calendar{
+		Name: "Джаз, блюз; и \\ всё\nостальное",
+		Events: []Event{{
+			UID:            "event-101@eventify",
+			Sequence:       2,
+			Start:          time.Date(2025, 11, 4, 16, 0, 0, 0, time.UTC),
+			End:            time.Date(2025, 11, 4, 19, 0, 0, 0, time.UTC),
+			Summary:        "Вечер джаза: Эллингтон, Гершвин; импровизации",
+			Description:    "Программа:\n1. Take the \"A\" Train\n2. Summertime\nВход по билетам, дресс-код — свободный. Начало в 19:00, двери открываются за час.",
+			Place:          "Клуб «Синяя птица», Москва, ул. Малая Дмитровка, 23/15",
+			Latitude:       &lat,
+			Longitude:      &lon,
+			OrganizerName:  `Иван "Джаз" Петров`,
+			OrganizerEmail: "ivan@example.com",
+			Created:        time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC),
+			LastModified:   &modified,
+		}},
+	})
+}
+
+func TestEncodeTimezone(t *testing.T) {
+	tests := []struct {
+		name string
+		zone *time.Location
+	}{
+		// летнее и зимнее время
+		{name: "timezone_dst", zone: mustLoad(t, "Europe/Berlin")},
+		// переходов больше нет, последний был в 2014 году
+		{name: "timezone_moscow", zone: mustLoad(t, "Europe/Moscow")},
+		// переходов не было никогда
+		{name: "timezone_fixed", zone: mustLoad(t, "Etc/GMT-3")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2025, 10, 20, 19, 0, 0, 0, tt.zone)
+			golden(t, tt.name, Calendar{
+				Events: []Event{{
+					UID:      "event-7@eventify",
+					Start:    start,
+					End:      start.Add(2 * time.Hour),
+					Location: tt.zone,
+					RRule:    "FREQ=WEEKLY;COUNT=4",
+					Summary:  "Йога",
+					Created:  stamp,
+				}},
+			})
+		})
+	}
+}
+
+func TestEncodeRecurrenceOverrides(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	start := time.Date(2025, 10, 13, 19, 0, 0, 0, berlin)
+	moved := time.Date(2025, 10, 28, 20, 0, 0, 0, berlin)
+
+	series := Event{
+		UID:      "event-42@eventify",
+		Sequence: 1,
+		Start:    start,
+		End:      start.Add(90 * time.Minute),
+		Location: berlin,
+		RRule:    "FREQ=WEEKLY;COUNT=6",
+		ExDates:  []time.Time{start.AddDate(0, 0, 21)},
+		Summary:  "Разговорный клуб",
+		Created:  stamp,
+	}
+	// перенесенное вхождение после перехода на зимнее время
+	changed := series
+	changed.RRule, changed.ExDates = "", nil
+	changed.Sequence = 3
+	changed.RecurrenceID = ptr(start.AddDate(0, 0, 14))
+	changed.Start, changed.End = moved, moved.Add(90*time.Minute)
+	changed.Summary = "Разговорный клуб (перенос)"
+	// отмененное вхождение
+	cancelled := series
+	cancelled.RRule, cancelled.ExDates = "", nil
+	cancelled.Sequence = 2
+	cancelled.RecurrenceID = ptr(start.AddDate(0, 0, 7))
+	cancelled.Start, cancelled.End = *cancelled.RecurrenceID, cancelled.RecurrenceID.Add(90*time.Minute)
+	cancelled.Cancelled = true
+
+	cal := Calendar{Name: "Разговорный клуб", Events: []Event{series, changed, cancelled}}
+	golden(t, "recurrence_overrides", cal)
+
+	var buf bytes.Buffer
+	if err := cal.Encode(&buf, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "UID:event-42@eventify\r\n"); n != 3 {
+		t.Errorf("series UID appears %d times, want 3", n)
+	}
+	if n := strings.Count(buf.String(), "BEGIN:VTIMEZONE"); n != 1 {
+		t.Errorf("VTIMEZONE appears %d times, want 1", n)
+	}
+}
+
+func TestEncodeFeed(t *testing.T) {
+	// вхождение серии в ленте — под UID серии с RECURRENCE-ID, как в выгрузке самой серии
+	golden(t, "feed", Calendar{
+		Name:            "Eventify",
+		RefreshInterval: 90 * time.Minute,
+		Events: []Event{{
+			UID:          "event-9@eventify",
+			RecurrenceID: ptr(time.Date(2025, 10, 20, 16, 0, 0, 0, time.UTC)),
+			Start:        time.Date(2025, 10, 20, 16, 0, 0, 0, time.UTC),
+			End:          time.Date(2025, 10, 20, 18, 0, 0, 0, time.UTC),
+			Summary:      "Лекция",
+			Created:      stamp,
+		}},
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -6,6 +6,9 @@ type Location struct {
 	City    string `json:"city"`
 	Venue   string `json:"venue"`
 	Address string `json:"address"`
+	// Latitude и Longitude задаются вместе; без них координаты ищутся по городу и площадке в справочнике
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
 }
 
 type Organizer struct {
@@ -36,17 +39,190 @@ type EventReq struct {
 	Organizer    Organizer     `json:"organizer"`
 	Participants []Participant `json:"participants"`
 	Status       string        `json:"status"`
+	// Capacity число мест, nil — без ограничения; у повторяющегося события — на каждое вхождение
+	Capacity *int `json:"capacity"`
+	// TimeZone часовой пояс IANA, в нем повторяются вхождения; по умолчанию UTC
+	TimeZone   string      `json:"time_zone"`
+	Recurrence *Recurrence `json:"recurrence"`
 }
 type EventResp struct {
-	ID           uint          `json:"id"`
-	Title        string        `json:"title"`
-	Description  string        `json:"description"`
-	Category     string        `json:"category"`
-	Location     Location      `json:"location"`
-	StartTime    time.Time     `json:"start_time"`
-	EndTime      time.Time     `json:"end_time"`
-	Organizer    Organizer     `json:"organizer"`
-	Participants []Participant `json:"participants"`
-	Status       string        `json:"status"`
-	CreatedAt    time.Time     `json:"created_at"`
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Category    string    `json:"category"`
+	Location    Location  `json:"location"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Organizer   Organizer `json:"organizer"`
+	// Participants заполняется только для одного события, в списках есть лишь ParticipantsCount
+	Participants      []Participant `json:"participants,omitempty"`
+	ParticipantsCount int           `json:"participants_count"`
+	Capacity          *int          `json:"capacity,omitempty"`
+	// SeatsLeft свободные места, только у событий с Capacity
+	SeatsLeft    *int        `json:"seats_left,omitempty"`
+	Status       string      `json:"status"`
+	TimeZone     string      `json:"time_zone"`
+	Recurrence   *Recurrence `json:"recurrence,omitempty"`
+	CancelReason string      `json:"cancel_reason,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    *time.Time  `json:"updated_at,omitempty"`
+	// Sequence растет с каждым изменением, SEQUENCE в iCalendar
+	Sequence int `json:"-"`
+	// SeriesID первое событие серии, из которой это событие выделилось при разделении, иначе само событие.
+	// От него строится UID в календарях
+	SeriesID uint `json:"-"`
+}
+
+// StatusCancelled статус отмененного события; отмененное событие нельзя изменить
+const StatusCancelled = "cancelled"
+
+// EventUpdateReq частичное изменение события, nil поля не меняются.
+// Организатор и участники так не меняются, статус — только через отмену.
+type EventUpdateReq struct {
+	Title       *string     `json:"title"`
+	Description *string     `json:"description"`
+	Category    *string     `json:"category"`
+	Location    *Location   `json:"location"`
+	StartTime   *time.Time  `json:"start_time"`
+	EndTime     *time.Time  `json:"end_time"`
+	TimeZone    *string     `json:"time_zone"`
+	Recurrence  *Recurrence `json:"recurrence"`
+}
+
+type CancelEventReq struct {
+	Reason string `json:"reason"`
+}
+
+// Participation запись пользователя на событие, для выгрузки его данных
+type Participation struct {
+	EventID      uint      `json:"event_id"`
+	OccurrenceID uint      `json:"occurrence_id"`
+	Title        string    `json:"title"`
+	StartTime    time.Time `json:"start_time"`
+	Username     string    `json:"username"`
+}
+
+// UserExport данные пользователя в event сервисе для /auth/me/export
+type UserExport struct {
+	OrganizedEvents []EventResp     `json:"organized_events"`
+	Participations  []Participation `json:"participations"`
+}
+
+// EventFilter параметры GET /events/; пустые поля не фильтруют
+type EventFilter struct {
+	City        string     `form:"city"`
+	Category    string     `form:"category"`
+	Status      string     `form:"status"`
+	OrganizerID int        `form:"organizer_id"`
+	From        *time.Time `form:"from"`
+	To          *time.Time `form:"to"`
+	// Sort start_time, created_at или popularity (число участников)
+	Sort   string `form:"sort"`
+	Order  string `form:"order"`
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+// EventCursor позиция в списке: значение ключа сортировки и id последнего события страницы
+type EventCursor struct {
+	Sort  string     `json:"s"`
+	Order string     `json:"o"`
+	Time  *time.Time `json:"t,omitempty"`
+	Count int        `json:"c,omitempty"`
+	ID    uint       `json:"id"`
+}
+
+// EventPage страница списка событий; next_cursor пуст на последней странице
+type EventPage struct {
+	Events     []EventResp `json:"events"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// SearchResult событие из поиска с релевантностью и подсвеченными совпадениями
+type SearchResult struct {
+	EventResp
+	Rank      float64         `json:"rank"`
+	Highlight SearchHighlight `json:"highlight"`
+}
+
+// SearchHighlight фрагменты с совпадениями в <mark>, остальной текст экранирован для HTML
+type SearchHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type SearchResp struct {
+	Results []SearchResult `json:"results"`
+	// Fuzzy true, если точных совпадений не нашлось и результаты подобраны с учетом опечаток
+	Fuzzy bool `json:"fuzzy"`
+}
+
+// NearbyFilter параметры GET /events/nearby
+type NearbyFilter struct {
+	Lat      *float64 `form:"lat"`
+	Lon      *float64 `form:"lon"`
+	RadiusKm float64  `form:"radius_km"`
+	Limit    int      `form:"limit"`
+}
+
+// NearbyEvent событие с расстоянием до точки поиска
+type NearbyEvent struct {
+	EventResp
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// Recurrence правило повторения RFC 5545 (FREQ=WEEKLY;BYDAY=TU) и исключенные вхождения
+type Recurrence struct {
+	Rule    string      `json:"rule"`
+	ExDates []time.Time `json:"exdates,omitempty"`
+}
+
+// Scope области изменения вхождения повторяющегося события
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+)
+
+// OccurrenceTime начало и конец вхождения по правилу серии
+type OccurrenceTime struct {
+	OriginalStart time.Time
+	Start         time.Time
+	End           time.Time
+}
+
+// Occurrence вхождение события. Title и Description — как у серии, если вхождение не меняли отдельно.
+type Occurrence struct {
+	ID            uint      `json:"id"`
+	EventID       uint      `json:"event_id"`
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	OriginalStart time.Time `json:"original_start"`
+	Status        string    `json:"status"`
+	// Modified вхождение изменено отдельно от серии
+	Modified          bool       `json:"modified"`
+	ParticipantsCount int        `json:"participants_count"`
+	SeatsLeft         *int       `json:"seats_left,omitempty"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+	// Sequence растет с каждым отдельным изменением вхождения
+	Sequence int `json:"-"`
+}
+
+// OccurrenceFilter параметры GET /events/{id}/occurrences, по start_time
+type OccurrenceFilter struct {
+	From *time.Time `form:"from"`
+	To   *time.Time `form:"to"`
+}
+
+// CalendarEntry вхождение события, на которое записан пользователь, для его календаря
+type CalendarEntry struct {
+	Event      EventResp
+	Occurrence Occurrence
+}
+
+// CalendarTokenResp токен подписки на календарь; URL — адрес ленты для календарного приложения
+type CalendarTokenResp struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
 }
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/event/internal/models"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+// SaveCalendarToken сохраняет хэш токена подписки пользователя, прежний токен перестает действовать
+func (r *EventRepository) SaveCalendarToken(ctx context.Context, userID int, tokenHash string) error {
+	_, err := r.db.Exec(ctx, `
+	INSERT INTO schema_name.calendar_tokens (user_id, token_hash)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()`, userID, tokenHash)
+	return err
+}
+
+// DeleteCalendarToken отзывает токен подписки пользователя
+func (r *EventRepository) DeleteCalendarToken(ctx context.Context, userID int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM schema_name.calendar_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCalendarNotFound
+	}
+	return nil
+}
+
+// GetCalendarTokenUser владелец токена подписки по его хэшу
+func (r *EventRepository) GetCalendarTokenUser(ctx context.Context, tokenHash string, userID *int) error {
+	err := r.db.QueryRow(ctx, `
+	SELECT user_id FROM schema_name.calendar_tokens WHERE token_hash = $1`, tokenHash).Scan(userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCalendarNotFound
+	}
+	return err
+}
+
+// GetUserCalendar вхождения событий, на которые записан пользователь, вместе с отмененными
+func (r *EventRepository) GetUserCalendar(ctx context.Context, userID int, entries *[]models.CalendarEntry) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT e.id, e.title, e.description, e.category, e.city, e.venue, e.address, e.latitude, e.longitude,
+		e.organizer_name, e.organizer_email, e.status, e.created_at, e.updated_at,
+		e.time_zone, e.recurrence_rule, e.recurrence_exdates, e.sequence, COALESCE(e.series_id, e.id),
+		o.id, COALESCE(o.title, e.title), COALESCE(o.description, e.description, ''),
+		o.start_time, o.end_time, o.original_start,
+		CASE WHEN e.status = 'cancelled' THEN e.status ELSE o.status END, o.modified, o.updated_at, o.sequence
+	FROM schema_name.event_participants p
+	JOIN schema_name.event_occurrences o ON o.id = p.occurrence_id
+	JOIN schema_name.events e ON e.id = o.event_id
+	WHERE p.user_id = $1
+	ORDER BY o.start_time, o.id`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.CalendarEntry
+		var rule *string
+		var exdates []time.Time
+		e, o := &entry.Event, &entry.Occurrence
+		if err = rows.Scan(
+			&e.ID, &e.Title, &e.Description, &e.Category,
+			&e.Location.City, &e.Location.Venue, &e.Location.Address, &e.Location.Latitude, &e.Location.Longitude,
+			&e.Organizer.Username, &e.Organizer.Email, &e.Status, &e.CreatedAt, &e.UpdatedAt,
+			&e.TimeZone, &rule, &exdates, &e.Sequence, &e.SeriesID,
+			&o.ID, &o.Title, &o.Description,
+			&o.StartTime, &o.EndTime, &o.OriginalStart,
+			&o.Status, &o.Modified, &o.UpdatedAt, &o.Sequence,
+		); err != nil {
+			return err
+		}
+		if rule != nil {
+			e.Recurrence = &models.Recurrence{Rule: *rule, ExDates: exdates}
+		}
+		o.EventID = e.ID
+		*entries = append(*entries, entry)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"eventify/event/internal/models"
+)
+
+// NearbyEvents предстоящие неотмененные события в радиусе radiusMeters от точки, ближайшие первыми.
+// earth_box отбирает кандидатов по индексу events_location_idx, earth_distance отсекает углы квадрата.
+func (r *EventRepository) NearbyEvents(ctx context.Context, lat, lon, radiusMeters float64, limit int, events *[]models.NearbyEvent) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT `+eventColumns+`,
+	       earth_distance(ll_to_earth($1, $2), ll_to_earth(latitude, longitude)) / 1000 AS distance_km
+	FROM schema_name.events
+	WHERE latitude IS NOT NULL AND longitude IS NOT NULL
+	  AND earth_box(ll_to_earth($1, $2), $3) @> ll_to_earth(latitude, longitude)
+	  AND earth_distance(ll_to_earth($1, $2), ll_to_earth(latitude, longitude)) <= $3
+	  AND status <> $4 AND end_time > now()
+	ORDER BY distance_km, start_time, id
+	LIMIT $5`, lat, lon, radiusMeters, models.StatusCancelled, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.NearbyEvent
+		if err = scanEvent(rows, &e.EventResp, &e.DistanceKm); err != nil {
+			return err
+		}
+		*events = append(*events, e)
+	}
+	return rows.Err()
+}
+
+// GetEventsWithoutCoordinates id, город и площадка событий, у которых еще нет координат
+func (r *EventRepository) GetEventsWithoutCoordinates(ctx context.Context, events *[]models.EventResp) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT id, COALESCE(city, ''), COALESCE(venue, '') FROM schema_name.events
+	WHERE latitude IS NULL
+	ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.EventResp
+		if err = rows.Scan(&e.ID, &e.Location.City, &e.Location.Venue); err != nil {
+			return err
+		}
+		*events = append(*events, e)
+	}
+	return rows.Err()
+}
+
+// SetCoordinates записывает координаты, если их еще нет; координаты от организатора не перезаписываются
+func (r *EventRepository) SetCoordinates(ctx context.Context, eventID uint, lat, lon float64) error {
+	_, err := r.db.Exec(ctx, `
+	UPDATE schema_name.events SET latitude = $2, longitude = $3
+	WHERE id = $1 AND latitude IS NULL`, eventID, lat, lon)
+	return err
+}
@@ -0,0 +1,360 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/event/internal/models"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+var ErrOccurrenceNotFound = errors.New("occurrence not found")
+
+// occurrenceColumns колонки, которые читает scanOccurrence; запрос должен соединять event_occurrences o и events e
+const occurrenceColumns = `o.id, o.event_id, COALESCE(o.title, e.title), COALESCE(o.description, e.description, ''),
+	o.start_time, o.end_time, o.original_start,
+	CASE WHEN e.status = 'cancelled' THEN e.status ELSE o.status END, o.modified, o.updated_at, o.sequence, e.capacity,
+	(SELECT count(*)::int FROM schema_name.event_participants p WHERE p.occurrence_id = o.id),
+	(SELECT count(*)::int FROM schema_name.event_waitlist w WHERE w.occurrence_id = o.id AND w.claim_expires_at > now())`
+
+func scanOccurrence(row pgx.Row, o *models.Occurrence) error {
+	var capacity *int
+	var heldSeats int
+	err := row.Scan(&o.ID, &o.EventID, &o.Title, &o.Description,
+		&o.StartTime, &o.EndTime, &o.OriginalStart,
+		&o.Status, &o.Modified, &o.UpdatedAt, &o.Sequence, &capacity,
+		&o.ParticipantsCount, &heldSeats)
+	if err == nil && capacity != nil {
+		seatsLeft := max(*capacity-o.ParticipantsCount-heldSeats, 0)
+		o.SeatsLeft = &seatsLeft
+	}
+	return err
+}
+
+// GetOccurrences вхождения события по времени начала, from и to необязательны
+func (r *EventRepository) GetOccurrences(ctx context.Context, eventID int, from, to *time.Time, occurrences *[]models.Occurrence) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT `+occurrenceColumns+`
+	FROM schema_name.event_occurrences o
+	JOIN schema_name.events e ON e.id = o.event_id
+	WHERE o.event_id = $1
+	  AND ($2::timestamptz IS NULL OR o.start_time >= $2)
+	  AND ($3::timestamptz IS NULL OR o.start_time < $3)
+	ORDER BY o.start_time, o.id`, eventID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.Occurrence
+		if err = scanOccurrence(rows, &o); err != nil {
+			return err
+		}
+		*occurrences = append(*occurrences, o)
+	}
+	return rows.Err()
+}
+
+// GetOccurrence вхождение события eventID
+func (r *EventRepository) GetOccurrence(ctx context.Context, eventID, occurrenceID int, o *models.Occurrence) error {
+	err := scanOccurrence(r.db.QueryRow(ctx, `
+	SELECT `+occurrenceColumns+`
+	FROM schema_name.event_occurrences o
+	JOIN schema_name.events e ON e.id = o.event_id
+	WHERE o.id = $1 AND o.event_id = $2`, occurrenceID, eventID), o)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOccurrenceNotFound
+	}
+	return err
+}
+
+// GetOccurrenceParticipants участники одного вхождения
+func (r *EventRepository) GetOccurrenceParticipants(ctx context.Context, occurrenceID int, participants *[]models.Participant) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT user_id, username FROM schema_name.event_participants
+	WHERE occurrence_id = $1`, occurrenceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Participant
+		if err = rows.Scan(&p.ID, &p.Username); err != nil {
+			return err
+		}
+		*participants = append(*participants, p)
+	}
+	return rows.Err()
+}
+
+// UpdateOccurrence меняет одно вхождение; nil title и description не меняются.
+// После этого изменения серии вхождение не трогают.
+func (r *EventRepository) UpdateOccurrence(ctx context.Context, o *models.Occurrence, title, description *string) error {
+	err := r.db.QueryRow(ctx, `
+	UPDATE schema_name.event_occurrences o
+	SET title = COALESCE($3, o.title), description = COALESCE($4, o.description),
+	    start_time = $5, end_time = $6, modified = true, updated_at = now(), sequence = o.sequence + 1
+	FROM schema_name.events e
+	WHERE o.id = $1 AND o.event_id = $2 AND e.id = o.event_id
+	  AND o.status <> $7 AND e.status <> $7
+	RETURNING o.updated_at, o.sequence`,
+		o.ID, o.EventID, title, description, o.StartTime, o.EndTime, models.StatusCancelled,
+	).Scan(&o.UpdatedAt, &o.Sequence)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrEventCancelled
+	}
+	return err
+}
+
+// CancelOccurrence отменяет одно вхождение; записи остаются, чтобы участников можно было оповестить
+func (r *EventRepository) CancelOccurrence(ctx context.Context, eventID, occurrenceID int) error {
+	tag, err := r.db.Exec(ctx, `
+	UPDATE schema_name.event_occurrences
+	SET status = $3, modified = true, updated_at = now(), sequence = sequence + 1
+	WHERE id = $1 AND event_id = $2 AND status <> $3`, occurrenceID, eventID, models.StatusCancelled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventCancelled
+	}
+	return nil
+}
+
+// SplitSeries делит серию на вхождении splitAt ("это и следующие"): у старой серии остается
+// обрезанное правило из old, с splitAt начинается новая серия next. Вхождения с splitAt
+// вместе с записями и листом ожидания переходят в next и приводятся к occurrences.
+func (r *EventRepository) SplitSeries(ctx context.Context, old, next *models.EventResp, splitAt time.Time, occurrences []models.OccurrenceTime) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+	UPDATE schema_name.events
+	SET recurrence_rule = $2, recurrence_exdates = $3, updated_at = now(), sequence = sequence + 1
+	WHERE id = $1 AND status <> $4
+	RETURNING updated_at, sequence`,
+		old.ID, old.Recurrence.Rule, nonNilTimes(old.Recurrence.ExDates), models.StatusCancelled,
+	).Scan(&old.UpdatedAt, &old.Sequence)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrEventCancelled
+	}
+	if err != nil {
+		return err
+	}
+
+	var rule *string
+	exdates := []time.Time{}
+	if next.Recurrence != nil {
+		rule = &next.Recurrence.Rule
+		exdates = nonNilTimes(next.Recurrence.ExDates)
+	}
+	// перешедшие вхождения продолжают нумерацию версий старой серии, чтобы календари приняли изменения
+	next.Sequence = old.Sequence
+	// и UID старой серии, чтобы календари не считали их новыми событиями
+	next.SeriesID = old.SeriesID
+	if next.SeriesID == 0 {
+		next.SeriesID = old.ID
+	}
+	if err = tx.QueryRow(ctx, `
+	INSERT INTO schema_name.events(title, description, category, city, venue, address, latitude, longitude,
+		start_time, end_time, organizer_id, organizer_name, organizer_email, status, capacity,
+		time_zone, recurrence_rule, recurrence_exdates, sequence, series_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	RETURNING id, created_at`,
+		next.Title, next.Description, next.Category,
+		next.Location.City, next.Location.Venue, next.Location.Address, next.Location.Latitude, next.Location.Longitude,
+		next.StartTime, next.EndTime, next.Organizer.ID, next.Organizer.Username, next.Organizer.Email, next.Status, next.Capacity,
+		next.TimeZone, rule, exdates, next.Sequence, next.SeriesID,
+	).Scan(&next.ID, &next.CreatedAt); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `
+	UPDATE schema_name.event_occurrences SET event_id = $2
+	WHERE event_id = $1 AND original_start >= $3`, old.ID, next.ID, splitAt); err != nil {
+		return err
+	}
+	// записи, лист ожидания и отзывы на перешедшие вхождения теперь относятся к новому событию
+	for _, table := range []string{"event_participants", "event_waitlist", "reviews"} {
+		if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.`+table+` t SET event_id = o.event_id
+		FROM schema_name.event_occurrences o
+		WHERE o.id = t.occurrence_id AND o.event_id = $1 AND t.event_id <> $1`, next.ID); err != nil {
+			return err
+		}
+	}
+	if err = recountParticipants(ctx, tx, old.ID, next.ID); err != nil {
+		return err
+	}
+
+	if err = syncOccurrences(ctx, tx, next.ID, time.Time{}, occurrences); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetRecurringEvents неотмененные повторяющиеся события, для них вхождения создаются заранее
+func (r *EventRepository) GetRecurringEvents(ctx context.Context, events *[]models.EventResp) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT `+eventColumns+`
+	FROM schema_name.events
+	WHERE recurrence_rule IS NOT NULL AND status <> $1
+	ORDER BY id`, models.StatusCancelled)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.EventResp
+		if err = scanEvent(rows, &e); err != nil {
+			return err
+		}
+		*events = append(*events, e)
+	}
+	return rows.Err()
+}
+
+// SyncOccurrences приводит вхождения события с from к occurrences, если серия не менялась
+// после e.UpdatedAt: иначе occurrences посчитаны по устаревшему правилу и будут пересчитаны позже.
+func (r *EventRepository) SyncOccurrences(ctx context.Context, e models.EventResp, from time.Time, occurrences []models.OccurrenceTime) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var unchanged bool
+	err = tx.QueryRow(ctx, `
+	SELECT updated_at IS NOT DISTINCT FROM $2 FROM schema_name.events
+	WHERE id = $1
+	FOR UPDATE`, e.ID, e.UpdatedAt).Scan(&unchanged)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !unchanged {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = syncOccurrences(ctx, tx, e.ID, from, occurrences); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// occurrenceHasPeople есть ли у вхождения o записи или лист ожидания
+const occurrenceHasPeople = `(EXISTS (SELECT 1 FROM schema_name.event_participants p WHERE p.occurrence_id = o.id)
+	OR EXISTS (SELECT 1 FROM schema_name.event_waitlist w WHERE w.occurrence_id = o.id))`
+
+// syncOccurrences приводит вхождения события, которые начинаются с from и не менялись отдельно,
+// к occurrences. Сначала вхождения сопоставляются по original_start, остальные — по порядку:
+// так исключенная дата убирает одно вхождение, а перенос серии на другое время переносит все,
+// и записи остаются на своих вхождениях. Лишние вхождения удаляются, а если на них есть
+// записи или лист ожидания — отменяются, чтобы люди не пропали молча. Вызывается, когда строка события заблокирована или только что создана.
+func syncOccurrences(ctx context.Context, tx pgx.Tx, eventID uint, from time.Time, occurrences []models.OccurrenceTime) error {
+	rows, err := tx.Query(ctx, `
+	SELECT id, original_start, modified FROM schema_name.event_occurrences
+	WHERE event_id = $1 AND original_start >= $2
+	ORDER BY original_start, id`, eventID, from)
+	if err != nil {
+		return err
+	}
+
+	existing := map[int64]uint{}
+	var free []uint
+	taken := map[int64]bool{}
+	for rows.Next() {
+		var id uint
+		var originalStart time.Time
+		var modified bool
+		if err = rows.Scan(&id, &originalStart, &modified); err != nil {
+			rows.Close()
+			return err
+		}
+		if modified {
+			taken[originalStart.Unix()] = true
+		} else {
+			existing[originalStart.Unix()] = id
+			free = append(free, id)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	update := func(id uint, t models.OccurrenceTime) error {
+		_, err := tx.Exec(ctx, `
+		UPDATE schema_name.event_occurrences
+		SET original_start = $2, start_time = $3, end_time = $4, updated_at = now(), sequence = sequence + 1
+		WHERE id = $1 AND (original_start, start_time, end_time) IS DISTINCT FROM ($2, $3, $4)`,
+			id, t.OriginalStart, t.Start, t.End)
+		return err
+	}
+
+	// совпавшие по original_start остаются на месте
+	matched := map[uint]bool{}
+	var unmatched []models.OccurrenceTime
+	for _, t := range occurrences {
+		if t.OriginalStart.Before(from) || taken[t.OriginalStart.Unix()] {
+			continue
+		}
+		if id, ok := existing[t.OriginalStart.Unix()]; ok {
+			matched[id] = true
+			if err = update(id, t); err != nil {
+				return err
+			}
+			continue
+		}
+		unmatched = append(unmatched, t)
+	}
+
+	// остальные по порядку
+	var rest []uint
+	for _, id := range free {
+		if !matched[id] {
+			rest = append(rest, id)
+		}
+	}
+	for i, t := range unmatched {
+		if i < len(rest) {
+			err = update(rest[i], t)
+		} else {
+			_, err = tx.Exec(ctx, `
+			INSERT INTO schema_name.event_occurrences (event_id, original_start, start_time, end_time)
+			VALUES ($1, $2, $3, $4)`, eventID, t.OriginalStart, t.Start, t.End)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(unmatched); i < len(rest); i++ {
+		if _, err = tx.Exec(ctx, `
+		UPDATE schema_name.event_occurrences o
+		SET status = $2, modified = true, updated_at = now(), sequence = o.sequence + 1
+		WHERE id = $1 AND `+occurrenceHasPeople,
+			rest[i], models.StatusCancelled); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx, `
+		DELETE FROM schema_name.event_occurrences o
+		WHERE id = $1 AND NOT `+occurrenceHasPeople,
+			rest[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nonNilTimes(times []time.Time) []time.Time {
+	if times == nil {
+		return []time.Time{}
+	}
+	return times
+}
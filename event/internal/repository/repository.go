@@ -2,8 +2,18 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"eventify/event/internal/models"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEventNotFound  = errors.New("event not found")
+	ErrEventCancelled = errors.New("event is cancelled")
 )
 
 type EventRepository struct {
@@ -14,11 +24,27 @@ func NewEventRepository(db *pgxpool.Pool) *EventRepository {
 	return &EventRepository{db: db}
 }
 
-func (r *EventRepository) CreateEvent(ctx context.Context, req models.EventReq) error {
+// CreateEvent создает событие с вхождениями occurrences; участники из запроса записываются на первое вхождение
+func (r *EventRepository) CreateEvent(ctx context.Context, req models.EventReq, occurrences []models.OccurrenceTime) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var rule *string
+	exdates := []time.Time{}
+	if req.Recurrence != nil {
+		rule = &req.Recurrence.Rule
+		exdates = append(exdates, req.Recurrence.ExDates...)
+	}
+
 	//добавляем данные в бд
-	_, err := r.db.Exec(ctx,
-		`INSERT INTO schema_name.events(title, description, category, city, venue, address, start_time, end_time, organizer_id, organizer_name, organizer_email, status)
-   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+	var eventID uint
+	err = tx.QueryRow(ctx,
+		`INSERT INTO schema_name.events(title, description, category, city, venue, address, start_time, end_time, organizer_id, organizer_name, organizer_email, status, latitude, longitude, capacity, time_zone, recurrence_rule, recurrence_exdates)
+   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+   RETURNING id`,
 		req.Title,
 		req.Description,
 		req.Category,
@@ -31,28 +57,35 @@ func (r *EventRepository) CreateEvent(ctx context.Context, req models.EventReq)
 		req.Organizer.Username,
 		req.Organizer.Email,
 		req.Status,
-	)
+		req.Location.Latitude,
+		req.Location.Longitude,
+		req.Capacity,
+		req.TimeZone,
+		rule,
+		exdates,
+	).Scan(&eventID)
 	if err != nil {
 		return err
 	}
-	var lastEventID uint
-	query := `SELECT id FROM schema_name.events ORDER BY id DESC LIMIT 1`
 
-	err = r.db.QueryRow(ctx, query).Scan(&lastEventID)
-	if err != nil {
+	if err = syncOccurrences(ctx, tx, eventID, time.Time{}, occurrences); err != nil {
 		return err
 	}
+
 	// шаблон для добавления юсера в схему
 	insertParticipantQuery := `
-      INSERT INTO schema_name.event_participants (event_id, user_id, username)
-VALUES ($1, $2, $3)
+      INSERT INTO schema_name.event_participants (event_id, occurrence_id, user_id, username)
+SELECT $1, id, $2, $3 FROM schema_name.event_occurrences
+WHERE event_id = $1
+ORDER BY original_start
+LIMIT 1
 ON CONFLICT DO NOTHING;
   `
 
 	// цикл для добавления участников в базу данных
 	for _, participant := range req.Participants {
-		_, err = r.db.Exec(ctx, insertParticipantQuery,
-			lastEventID,
+		_, err = tx.Exec(ctx, insertParticipantQuery,
+			eventID,
 			participant.ID,
 			participant.Username,
 		)
@@ -60,103 +93,329 @@ ON CONFLICT DO NOTHING;
 			return err
 		}
 	}
+	if err = recountParticipants(ctx, tx, eventID); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
-func (r *EventRepository) GetEvents(ctx context.Context, events *[]models.EventResp) error {
-	rows, err := r.db.Query(ctx, `
-	SELECT * FROM schema_name.events
-	`)
+// recountParticipants пересчитывает participants_count событий после переноса или массовой записи участников
+func recountParticipants(ctx context.Context, tx pgx.Tx, eventIDs ...uint) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE schema_name.events e
+	SET participants_count = (SELECT count(*) FROM schema_name.event_participants p WHERE p.event_id = e.id)
+	WHERE e.id = ANY($1)`, eventIDs)
+	return err
+}
+
+// heldSeatsExpr места, которые держатся за приглашенными из листа ожидания
+const heldSeatsExpr = `(SELECT count(*)::int FROM schema_name.event_waitlist w WHERE w.event_id = events.id AND w.claim_expires_at > now())`
+
+// eventColumns колонки, которые читает scanEvent
+const eventColumns = `id, title, description, category, city, venue, address, latitude, longitude,
+	start_time, end_time, organizer_id, organizer_name, organizer_email,
+	status, COALESCE(cancel_reason, ''), created_at, updated_at, capacity,
+	time_zone, recurrence_rule, recurrence_exdates, sequence, COALESCE(series_id, id), ` + heldSeatsExpr + `, participants_count`
+
+// scanEvent читает eventColumns, extra — колонки запроса после них
+func scanEvent(row pgx.Row, e *models.EventResp, extra ...interface{}) error {
+	var heldSeats int
+	var rule *string
+	var exdates []time.Time
+	err := row.Scan(append([]interface{}{
+		&e.ID,
+		&e.Title, &e.Description, &e.Category,
+		&e.Location.City, &e.Location.Venue, &e.Location.Address, &e.Location.Latitude, &e.Location.Longitude,
+		&e.StartTime, &e.EndTime,
+		&e.Organizer.ID, &e.Organizer.Username, &e.Organizer.Email,
+		&e.Status, &e.CancelReason, &e.CreatedAt, &e.UpdatedAt, &e.Capacity,
+		&e.TimeZone, &rule, &exdates, &e.Sequence, &e.SeriesID, &heldSeats, &e.ParticipantsCount,
+	}, extra...)...)
+	if err == nil && rule != nil {
+		e.Recurrence = &models.Recurrence{Rule: *rule, ExDates: exdates}
+	}
+	// у повторяющегося события места считаются по вхождениям
+	if err == nil && e.Capacity != nil && e.Recurrence == nil {
+		seatsLeft := max(*e.Capacity-e.ParticipantsCount-heldSeats, 0)
+		e.SeatsLeft = &seatsLeft
+	}
+	return err
+}
+
+// sortColumns выражения для сортировок списка событий
+var sortColumns = map[string]string{
+	"start_time": "start_time",
+	"created_at": "created_at",
+	"popularity": "participants_count",
+}
+
+// ListEvents страница событий по фильтру. Пагинация по ключу: следующая страница начинается
+// после (значение сортировки, id) из cursor, поэтому новые события не сдвигают страницы.
+// Сортировка и направление в filter уже проверены сервисом.
+func (r *EventRepository) ListEvents(ctx context.Context, filter models.EventFilter, cursor *models.EventCursor, events *[]models.EventResp) error {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.City != "" {
+		conditions = append(conditions, "lower(city) = lower("+arg(filter.City)+")")
+	}
+	if filter.Category != "" {
+		conditions = append(conditions, "lower(category) = lower("+arg(filter.Category)+")")
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = "+arg(filter.Status))
+	}
+	if filter.OrganizerID != 0 {
+		conditions = append(conditions, "organizer_id = "+arg(filter.OrganizerID))
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "start_time >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "start_time < "+arg(*filter.To))
+	}
+
+	sortColumn := sortColumns[filter.Sort]
+	direction, compare := "ASC", ">"
+	if filter.Order == "desc" {
+		direction, compare = "DESC", "<"
+	}
+	if cursor != nil {
+		var value interface{} = cursor.Count
+		if cursor.Time != nil {
+			value = *cursor.Time
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", sortColumn, compare, arg(value), arg(cursor.ID)))
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM schema_name.events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", sortColumn, direction, direction, arg(filter.Limit))
+
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
-	// проходимся по всем строкам
+
 	for rows.Next() {
 		var e models.EventResp
-		err = rows.Scan(
-			&e.ID,
-			&e.Title,
-			&e.Description,
-			&e.Category,
-			&e.Location.City,
-			&e.Location.Venue,
-			&e.Location.Address,
-			&e.StartTime,
-			&e.EndTime,
-			&e.Organizer.ID,
-			&e.Organizer.Username,
-			&e.Organizer.Email,
-			&e.Status,
-			&e.CreatedAt)
-		if err != nil {
-			return err
-		}
-
-		// запрашиваем участников event
-		participantsRows, err := r.db.Query(ctx, `
-        SELECT user_id, username 
-        FROM schema_name.event_participants
-        WHERE event_id = $1
-    `, e.ID)
-		if err != nil {
+		if err = scanEvent(rows, &e); err != nil {
 			return err
 		}
-		// записываем в нашу переменную
-		var participants []models.Participant
-		for participantsRows.Next() {
-			var p models.Participant
-			err = participantsRows.Scan(&p.ID, &p.Username)
-			if err != nil {
-				return err
-			}
-			participants = append(participants, p)
-		}
-		participantsRows.Close()
-		// добавляем в e
-		e.Participants = participants
-		// заполняем event
 		*events = append(*events, e)
 	}
-	return nil
+	return rows.Err()
 }
 
 func (r *EventRepository) GetEventByID(ctx context.Context, eventID int, e *models.EventResp) error {
-	err := r.db.QueryRow(ctx, `
-	       SELECT
-	           id, title, description, category, city, venue, address,
-	           start_time, end_time, organizer_id, organizer_name, organizer_email,
-	           status, created_at
+	err := scanEvent(r.db.QueryRow(ctx, `
+	       SELECT `+eventColumns+`
 	       FROM schema_name.events
 	       WHERE id = $1
-	   `, eventID).Scan(
-		&e.ID,
-		&e.Title, &e.Description, &e.Category,
-		&e.Location.City, &e.Location.Venue, &e.Location.Address,
-		&e.StartTime, &e.EndTime,
-		&e.Organizer.ID, &e.Organizer.Username, &e.Organizer.Email,
-		&e.Status, &e.CreatedAt,
-	)
-
+	   `, eventID), e)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrEventNotFound
+	}
 	if err != nil {
 		return err
 	}
+
 	// считываем участников и записываем в event
-	participants, err := r.db.Query(ctx, `
-	       SELECT user_id, username FROM schema_name.event_participants
+	return r.GetParticipants(ctx, eventID, &e.Participants)
+}
+
+// GetParticipants участники события
+func (r *EventRepository) GetParticipants(ctx context.Context, eventID int, participants *[]models.Participant) error {
+	rows, err := r.db.Query(ctx, `
+	       SELECT DISTINCT user_id, username FROM schema_name.event_participants
 	       WHERE event_id = $1
 	   `, eventID)
 	if err != nil {
 		return err
 	}
-	defer participants.Close()
-	for participants.Next() {
+	defer rows.Close()
+
+	for rows.Next() {
 		var p models.Participant
-		if err := participants.Scan(&p.ID, &p.Username); err == nil {
-			e.Participants = append(e.Participants, p)
+		if err = rows.Scan(&p.ID, &p.Username); err != nil {
+			return err
+		}
+		*participants = append(*participants, p)
+	}
+	return rows.Err()
+}
+
+// UpdateEvent сохраняет изменяемые поля события; отмененные события не меняются.
+// Если время или правило повторения изменились, occurrences — новые вхождения начиная с from.
+func (r *EventRepository) UpdateEvent(ctx context.Context, e *models.EventResp, occurrences []models.OccurrenceTime, from time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var rule *string
+	exdates := []time.Time{}
+	if e.Recurrence != nil {
+		rule = &e.Recurrence.Rule
+		exdates = append(exdates, e.Recurrence.ExDates...)
+	}
+
+	err = tx.QueryRow(ctx, `
+	UPDATE schema_name.events
+	SET title = $2, description = $3, category = $4, city = $5, venue = $6, address = $7,
+	    start_time = $8, end_time = $9, latitude = $11, longitude = $12,
+	    time_zone = $13, recurrence_rule = $14, recurrence_exdates = $15, updated_at = now(), sequence = sequence + 1
+	WHERE id = $1 AND status <> $10
+	RETURNING updated_at`,
+		e.ID, e.Title, e.Description, e.Category,
+		e.Location.City, e.Location.Venue, e.Location.Address,
+		e.StartTime, e.EndTime, models.StatusCancelled,
+		e.Location.Latitude, e.Location.Longitude,
+		e.TimeZone, rule, exdates,
+	).Scan(&e.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrEventCancelled
+	}
+	if err != nil {
+		return err
+	}
+
+	if occurrences != nil {
+		if err = syncOccurrences(ctx, tx, e.ID, from, occurrences); err != nil {
+			return err
 		}
 	}
+	return tx.Commit(ctx)
+}
+
+// CancelEvent отменяет событие; участники остаются, чтобы их можно было оповестить
+func (r *EventRepository) CancelEvent(ctx context.Context, eventID int, reason string) error {
+	tag, err := r.db.Exec(ctx, `
+	UPDATE schema_name.events
+	SET status = $2, cancelled_at = now(), cancel_reason = NULLIF($3, ''), updated_at = now(), sequence = sequence + 1
+	WHERE id = $1 AND status <> $2`, eventID, models.StatusCancelled, reason)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventCancelled
+	}
+	return nil
+}
 
+// DeleteEvent удаляет событие вместе с участниками и отзывами
+func (r *EventRepository) DeleteEvent(ctx context.Context, eventID int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM schema_name.events WHERE id = $1`, eventID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventNotFound
+	}
 	return nil
 }
+
+// UpdateUsername обновляет копии username пользователя в событиях, списках участников и листах ожидания
+func (r *EventRepository) UpdateUsername(ctx context.Context, userID int, username string) error {
+	if _, err := r.db.Exec(ctx, `
+	UPDATE schema_name.events SET organizer_name = $2
+	WHERE organizer_id = $1 AND organizer_name IS DISTINCT FROM $2`, userID, username); err != nil {
+		return err
+	}
+
+	if _, err := r.db.Exec(ctx, `
+	UPDATE schema_name.event_participants SET username = $2
+	WHERE user_id = $1 AND username <> $2`, userID, username); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+	UPDATE schema_name.event_waitlist SET username = $2
+	WHERE user_id = $1 AND username <> $2`, userID, username)
+	return err
+}
+
+// DeleteUserData удаляет записи пользователя на события, его места в листах ожидания и ленту календаря,
+// обезличивает события, которые он организовал. Сами события остаются, чтобы не пропасть у остальных участников.
+// Освободившиеся места получат следующие в очереди: их раздает проверка листов ожидания в user-interaction сервисе.
+func (r *EventRepository) DeleteUserData(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `
+	WITH deleted AS (
+		DELETE FROM schema_name.event_participants WHERE user_id = $1 RETURNING event_id
+	)
+	UPDATE schema_name.events e SET participants_count = e.participants_count - d.n
+	FROM (SELECT event_id, count(*)::int AS n FROM deleted GROUP BY event_id) d
+	WHERE e.id = d.event_id`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM schema_name.event_waitlist WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM schema_name.calendar_tokens WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `
+	UPDATE schema_name.events SET organizer_name = '', organizer_email = ''
+	WHERE organizer_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetOrganizedEventIDs id событий, которые организовал пользователь
+func (r *EventRepository) GetOrganizedEventIDs(ctx context.Context, userID int, ids *[]int) error {
+	rows, err := r.db.Query(ctx, `SELECT id FROM schema_name.events WHERE organizer_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		*ids = append(*ids, id)
+	}
+	return rows.Err()
+}
+
+// GetParticipations события, на которые записан пользователь
+func (r *EventRepository) GetParticipations(ctx context.Context, userID int, participations *[]models.Participation) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT p.event_id, p.occurrence_id, COALESCE(o.title, e.title), o.start_time, p.username
+	FROM schema_name.event_participants p
+	JOIN schema_name.events e ON e.id = p.event_id
+	JOIN schema_name.event_occurrences o ON o.id = p.occurrence_id
+	WHERE p.user_id = $1
+	ORDER BY o.start_time`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Participation
+		if err = rows.Scan(&p.EventID, &p.OccurrenceID, &p.Title, &p.StartTime, &p.Username); err != nil {
+			return err
+		}
+		*participations = append(*participations, p)
+	}
+	return rows.Err()
+}
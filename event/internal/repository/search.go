@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"eventify/event/internal/models"
+)
+
+// маркеры совпадений в ts_headline; в сервисе текст экранируется и маркеры заменяются на <mark>
+const (
+	HighlightStart = "⟦"
+	HighlightStop  = "⟧"
+)
+
+// searchQuery запрос пользователя в обеих конфигурациях, как и search_vector
+const searchQuery = `(SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS q) AS search`
+
+// SearchEvents полнотекстовый поиск по search_vector, от более релевантных к менее
+func (r *EventRepository) SearchEvents(ctx context.Context, query string, limit, offset int, results *[]models.SearchResult) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT `+eventColumns+`,
+	       ts_rank_cd(search_vector, q)::float8 AS rank,
+	       ts_headline('russian', title, q, 'StartSel=`+HighlightStart+`, StopSel=`+HighlightStop+`, HighlightAll=true'),
+	       ts_headline('russian', COALESCE(description, ''), q,
+	                   'StartSel=`+HighlightStart+`, StopSel=`+HighlightStop+`, MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "')
+	FROM schema_name.events, `+searchQuery+`
+	WHERE search_vector @@ q
+	ORDER BY rank DESC, start_time, id
+	LIMIT $2 OFFSET $3`, query, limit, offset)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.SearchResult
+		if err = scanEvent(rows, &res.EventResp, &res.Rank, &res.Highlight.Title, &res.Highlight.Description); err != nil {
+			return err
+		}
+		*results = append(*results, res)
+	}
+	return rows.Err()
+}
+
+// FuzzySearchEvents поиск с опечатками по триграммам search_text, когда полнотекстовый ничего не нашел
+func (r *EventRepository) FuzzySearchEvents(ctx context.Context, query string, limit, offset int, results *[]models.SearchResult) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// порог по умолчанию (0.6) отсекает почти все слова с одной опечаткой
+	if _, err = tx.Exec(ctx, `SET LOCAL pg_trgm.word_similarity_threshold = 0.4`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `
+	SELECT `+eventColumns+`, word_similarity($1, search_text)::float8 AS rank
+	FROM schema_name.events
+	WHERE $1 <% search_text
+	ORDER BY rank DESC, start_time, id
+	LIMIT $2 OFFSET $3`, query, limit, offset)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.SearchResult
+		if err = scanEvent(rows, &res.EventResp, &res.Rank); err != nil {
+			return err
+		}
+		*results = append(*results, res)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,474 @@
+// Package rrule разбирает и разворачивает правила повторения RRULE из RFC 5545.
+// Поддерживаются FREQ=DAILY/WEEKLY/MONTHLY/YEARLY, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH и WKST.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// WeekdayNum день недели из BYDAY; N — номер в месяце или году (1 — первый, -1 — последний), 0 — каждый
+type WeekdayNum struct {
+	Day time.Weekday
+	N   int
+}
+
+// Rule правило повторения. Until нулевой, если правило ограничено COUNT или не ограничено.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+
+	// untilDate UNTIL задан датой без времени: последний день включается целиком в часовом поясе события
+	untilDate bool
+}
+
+// maxPeriods ограничивает перебор для правил, которые почти или совсем не дают дат (30 февраля)
+const maxPeriods = 10000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Parse разбирает правило вида FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10, префикс RRULE: необязателен
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s is repeated", ErrInvalidRule, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly && r.Freq != Yearly {
+				err = fmt.Errorf("%w: FREQ=%s is not supported", ErrInvalidRule, value)
+			}
+		case "INTERVAL":
+			r.Interval, err = parsePositive(name, value)
+		case "COUNT":
+			r.Count, err = parsePositive(name, value)
+		case "UNTIL":
+			err = r.parseUntil(value)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				var wd WeekdayNum
+				if wd, err = parseWeekdayNum(v); err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				d, convErr := strconv.Atoi(v)
+				if convErr != nil || d == 0 || d < -31 || d > 31 {
+					err = fmt.Errorf("%w: BYMONTHDAY=%s", ErrInvalidRule, v)
+					break
+				}
+				r.ByMonthDay = append(r.ByMonthDay, d)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				m, convErr := strconv.Atoi(v)
+				if convErr != nil || m < 1 || m > 12 {
+					err = fmt.Errorf("%w: BYMONTH=%s", ErrInvalidRule, v)
+					break
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "WKST":
+			day, ok := weekdays[value]
+			if !ok {
+				err = fmt.Errorf("%w: WKST=%s", ErrInvalidRule, value)
+			}
+			r.WeekStart = day
+		default:
+			err = fmt.Errorf("%w: %s is not supported", ErrInvalidRule, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot be used together", ErrInvalidRule)
+	case r.Freq == Weekly && len(r.ByMonthDay) > 0:
+		return nil, fmt.Errorf("%w: BYMONTHDAY cannot be used with FREQ=WEEKLY", ErrInvalidRule)
+	}
+	// номер дня недели имеет смысл только внутри месяца или года
+	if r.Freq == Daily || r.Freq == Weekly || (r.Freq == Yearly && len(r.ByMonth) == 0 && len(r.ByMonthDay) > 0) {
+		for _, wd := range r.ByDay {
+			if wd.N != 0 {
+				return nil, fmt.Errorf("%w: BYDAY=%d%s cannot be used with FREQ=%s", ErrInvalidRule, wd.N, weekdayNames[wd.Day], r.Freq)
+			}
+		}
+	}
+	return r, nil
+}
+
+func parsePositive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s=%s", ErrInvalidRule, name, value)
+	}
+	return n, nil
+}
+
+func (r *Rule) parseUntil(value string) error {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		r.Until = t
+		return nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		r.Until, r.untilDate = t, true
+		return nil
+	}
+	return fmt.Errorf("%w: UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ", ErrInvalidRule)
+}
+
+func parseWeekdayNum(v string) (WeekdayNum, error) {
+	if len(v) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: BYDAY=%s", ErrInvalidRule, v)
+	}
+	day, ok := weekdays[v[len(v)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("%w: BYDAY=%s", ErrInvalidRule, v)
+	}
+	wd := WeekdayNum{Day: day}
+	if prefix := v[:len(v)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("%w: BYDAY=%s", ErrInvalidRule, v)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+// String правило в каноническом виде RFC 5545, без префикса RRULE:
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.untilDate {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = weekdayNames[wd.Day]
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Truncate правило, которое заканчивается до before: так серия делится на "до" и "с этого вхождения"
+func (r *Rule) Truncate(before time.Time) *Rule {
+	truncated := *r
+	truncated.Count = 0
+	truncated.Until = before.Add(-time.Second).UTC()
+	truncated.untilDate = false
+	return &truncated
+}
+
+// Split делит серию с началом dtstart на вхождении at: before заканчивается до at, after начинается с at.
+// У правила с COUNT в after остаются вхождения, которые не вошли в before, но хотя бы одно.
+func (r *Rule) Split(dtstart, at time.Time) (before, after *Rule) {
+	rest := *r
+	if rest.Count > 0 {
+		// COUNT считает и исключенные даты, поэтому считаем без них
+		rest.Count = max(rest.Count-len(r.Occurrences(dtstart, at, nil)), 1)
+	}
+	return r.Truncate(at), &rest
+}
+
+// Occurrences начала вхождений от dtstart до end (не включая), без дат из exdates.
+// Время суток и часовой пояс берутся из dtstart, поэтому при переходе на летнее время
+// вхождения остаются в то же местное время. Сам dtstart всегда первое вхождение и входит в COUNT.
+func (r *Rule) Occurrences(dtstart, end time.Time, exdates []time.Time) []time.Time {
+	excluded := make(map[int64]bool, len(exdates))
+	for _, t := range exdates {
+		excluded[t.Unix()] = true
+	}
+
+	until := r.Until
+	if r.untilDate {
+		// последний день целиком в часовом поясе события
+		until = time.Date(until.Year(), until.Month(), until.Day(), 23, 59, 59, 0, dtstart.Location())
+	}
+
+	var out []time.Time
+	count := 0
+	// add учитывает вхождение и сообщает, продолжать ли перебор
+	add := func(t time.Time) bool {
+		if !until.IsZero() && t.After(until) || !t.Before(end) {
+			return false
+		}
+		count++
+		if !excluded[t.Unix()] {
+			out = append(out, t)
+		}
+		return r.Count == 0 || count < r.Count
+	}
+
+	if !add(dtstart) {
+		return out
+	}
+	hour, minute, sec := dtstart.Clock()
+	for period := 0; period < maxPeriods; period++ {
+		for _, day := range r.periodDays(dtstart, period) {
+			t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, sec, 0, dtstart.Location())
+			if !t.After(dtstart) {
+				continue
+			}
+			if !add(t) {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// periodDays дни period-го периода правила по порядку; время в них не важно
+func (r *Rule) periodDays(dtstart time.Time, period int) []time.Time {
+	y, m, d := dtstart.Date()
+	step := period * r.Interval
+
+	switch r.Freq {
+	case Daily:
+		day := date(y, m, d+step)
+		if r.matchMonth(day) && r.matchMonthDay(day) && r.matchWeekday(day) {
+			return []time.Time{day}
+		}
+		return nil
+	case Weekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := date(y, m, d-offset+step*7)
+		var days []time.Time
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			matches := day.Weekday() == dtstart.Weekday()
+			if len(r.ByDay) > 0 {
+				matches = r.matchWeekday(day)
+			}
+			if matches && r.matchMonth(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+	case Monthly:
+		month := date(y, m+time.Month(step), 1)
+		if !r.matchMonth(month) {
+			return nil
+		}
+		return r.monthDays(month.Year(), month.Month(), d)
+	case Yearly:
+		year := y + step
+		if len(r.ByDay) > 0 && len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 {
+			return r.yearWeekdays(year)
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			if len(r.ByMonthDay) > 0 {
+				months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			} else {
+				months = []time.Month{m}
+			}
+		}
+		months = append([]time.Month(nil), months...)
+		sort.Slice(months, func(i, j int) bool { return months[i] < months[j] })
+
+		var days []time.Time
+		for _, month := range months {
+			days = append(days, r.monthDays(year, month, d)...)
+		}
+		return days
+	}
+	return nil
+}
+
+// monthDays дни месяца по BYMONTHDAY и BYDAY; без них — день dtstart, если он есть в месяце
+func (r *Rule) monthDays(year int, month time.Month, dtstartDay int) []time.Time {
+	last := date(year, month+1, 0).Day()
+
+	var byMonthDay, byDay map[int]bool
+	if len(r.ByMonthDay) > 0 {
+		byMonthDay = map[int]bool{}
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d >= 1 && d <= last {
+				byMonthDay[d] = true
+			}
+		}
+	}
+	if len(r.ByDay) > 0 {
+		byDay = map[int]bool{}
+		for _, wd := range r.ByDay {
+			for _, day := range nthWeekdays(date(year, month, 1), last, wd) {
+				byDay[day] = true
+			}
+		}
+	}
+	if byMonthDay == nil && byDay == nil {
+		if dtstartDay > last {
+			return nil
+		}
+		return []time.Time{date(year, month, dtstartDay)}
+	}
+
+	var days []time.Time
+	for d := 1; d <= last; d++ {
+		if (byMonthDay == nil || byMonthDay[d]) && (byDay == nil || byDay[d]) {
+			days = append(days, date(year, month, d))
+		}
+	}
+	return days
+}
+
+// yearWeekdays дни года по BYDAY, номера считаются внутри года (20MO — двадцатый понедельник)
+func (r *Rule) yearWeekdays(year int) []time.Time {
+	first := date(year, 1, 1)
+	last := date(year, 12, 31).YearDay()
+	selected := map[int]bool{}
+	for _, wd := range r.ByDay {
+		for _, day := range nthWeekdays(first, last, wd) {
+			selected[day] = true
+		}
+	}
+
+	var days []time.Time
+	for d := 1; d <= last; d++ {
+		if selected[d] {
+			days = append(days, first.AddDate(0, 0, d-1))
+		}
+	}
+	return days
+}
+
+// nthWeekdays номера дней (с 1) в отрезке из length дней от first, подходящих под wd
+func nthWeekdays(first time.Time, length int, wd WeekdayNum) []int {
+	offset := (int(wd.Day) - int(first.Weekday()) + 7) % 7
+	var all []int
+	for d := 1 + offset; d <= length; d += 7 {
+		all = append(all, d)
+	}
+	switch {
+	case wd.N == 0:
+		return all
+	case wd.N > 0 && wd.N <= len(all):
+		return all[wd.N-1 : wd.N]
+	case wd.N < 0 && -wd.N <= len(all):
+		return all[len(all)+wd.N : len(all)+wd.N+1]
+	}
+	return nil
+}
+
+func (r *Rule) matchMonth(day time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if day.Month() == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := date(day.Year(), day.Month()+1, 0).Day()
+	for _, d := range r.ByMonthDay {
+		if d == day.Day() || d < 0 && last+d+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// date полночь по UTC; для перебора дней часовой пояс не важен и не мешает переход на летнее время
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,579 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+const layout = "20060102T150405"
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func mustTime(t *testing.T, loc *time.Location, s string) time.Time {
+	t.Helper()
+	tm, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+// daily n дней подряд начиная с from, в формате layout
+func daily(t *testing.T, from string, n int) []string {
+	t.Helper()
+	start := mustTime(t, time.UTC, from)
+	days := make([]string, n)
+	for i := range days {
+		days[i] = start.AddDate(0, 0, i).Format(layout)
+	}
+	return days
+}
+
+func concat(lists ...[]string) []string {
+	var out []string
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
+
+func formatAll(times []time.Time) []string {
+	out := make([]string, len(times))
+	for i, t := range times {
+		out[i] = t.Format(layout)
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Примеры из RFC 5545 §3.8.5.3 в America/New_York. Примеры с BYSETPOS, BYWEEKNO, BYYEARDAY
+// и частотой меньше дня не поддерживаются и пропущены; бесконечные правила обрезаются по end.
+func TestOccurrencesRFC5545(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+
+	tests := []struct {
+		name    string
+		dtstart string
+		rule    string
+		exdates []string
+		end     string
+		want    []string
+	}{
+		{
+			name:    "daily for 10 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;COUNT=10",
+			want:    daily(t, "19970902T090000", 10),
+		},
+		{
+			name:    "daily until December 24, 1997",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;UNTIL=19971224T000000Z",
+			want:    daily(t, "19970902T090000", 113),
+		},
+		{
+			name:    "every other day",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;INTERVAL=2",
+			end:     "19970920T000000",
+			want: []string{
+				"19970902T090000", "19970904T090000", "19970906T090000", "19970908T090000", "19970910T090000",
+				"19970912T090000", "19970914T090000", "19970916T090000", "19970918T090000",
+			},
+		},
+		{
+			name:    "every 10 days, 5 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=DAILY;INTERVAL=10;COUNT=5",
+			want:    []string{"19970902T090000", "19970912T090000", "19970922T090000", "19971002T090000", "19971012T090000"},
+		},
+		{
+			name:    "every day in January, for 3 years (yearly)",
+			dtstart: "19980101T090000",
+			rule:    "FREQ=YEARLY;UNTIL=20000131T140000Z;BYMONTH=1;BYDAY=SU,MO,TU,WE,TH,FR,SA",
+			want:    concat(daily(t, "19980101T090000", 31), daily(t, "19990101T090000", 31), daily(t, "20000101T090000", 31)),
+		},
+		{
+			name:    "every day in January, for 3 years (daily)",
+			dtstart: "19980101T090000",
+			rule:    "FREQ=DAILY;UNTIL=20000131T140000Z;BYMONTH=1",
+			want:    concat(daily(t, "19980101T090000", 31), daily(t, "19990101T090000", 31), daily(t, "20000101T090000", 31)),
+		},
+		{
+			name:    "weekly for 10 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;COUNT=10",
+			want: []string{
+				"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000",
+				"19971007T090000", "19971014T090000", "19971021T090000", "19971028T090000", "19971104T090000",
+			},
+		},
+		{
+			name:    "weekly until December 24, 1997",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;UNTIL=19971224T000000Z",
+			want: []string{
+				"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000",
+				"19971007T090000", "19971014T090000", "19971021T090000", "19971028T090000", "19971104T090000",
+				"19971111T090000", "19971118T090000", "19971125T090000", "19971202T090000", "19971209T090000",
+				"19971216T090000", "19971223T090000",
+			},
+		},
+		{
+			name:    "every other week",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;WKST=SU",
+			end:     "19980201T000000",
+			want: []string{
+				"19970902T090000", "19970916T090000", "19970930T090000", "19971014T090000", "19971028T090000",
+				"19971111T090000", "19971125T090000", "19971209T090000", "19971223T090000", "19980106T090000",
+				"19980120T090000",
+			},
+		},
+		{
+			name:    "weekly on Tuesday and Thursday for five weeks (until)",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH",
+			want: []string{
+				"19970902T090000", "19970904T090000", "19970909T090000", "19970911T090000", "19970916T090000",
+				"19970918T090000", "19970923T090000", "19970925T090000", "19970930T090000", "19971002T090000",
+			},
+		},
+		{
+			name:    "weekly on Tuesday and Thursday for five weeks (count)",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;COUNT=10;WKST=SU;BYDAY=TU,TH",
+			want: []string{
+				"19970902T090000", "19970904T090000", "19970909T090000", "19970911T090000", "19970916T090000",
+				"19970918T090000", "19970923T090000", "19970925T090000", "19970930T090000", "19971002T090000",
+			},
+		},
+		{
+			name:    "every other week on Monday, Wednesday and Friday until December 24, 1997",
+			dtstart: "19970901T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;UNTIL=19971224T000000Z;WKST=SU;BYDAY=MO,WE,FR",
+			want: []string{
+				"19970901T090000", "19970903T090000", "19970905T090000", "19970915T090000", "19970917T090000",
+				"19970919T090000", "19970929T090000", "19971001T090000", "19971003T090000", "19971013T090000",
+				"19971015T090000", "19971017T090000", "19971027T090000", "19971029T090000", "19971031T090000",
+				"19971110T090000", "19971112T090000", "19971114T090000", "19971124T090000", "19971126T090000",
+				"19971128T090000", "19971208T090000", "19971210T090000", "19971212T090000", "19971222T090000",
+			},
+		},
+		{
+			name:    "every other week on Tuesday and Thursday, for 8 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=8;WKST=SU;BYDAY=TU,TH",
+			want: []string{
+				"19970902T090000", "19970904T090000", "19970916T090000", "19970918T090000",
+				"19970930T090000", "19971002T090000", "19971014T090000", "19971016T090000",
+			},
+		},
+		{
+			name:    "monthly on the first Friday for 10 occurrences",
+			dtstart: "19970905T090000",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYDAY=1FR",
+			want: []string{
+				"19970905T090000", "19971003T090000", "19971107T090000", "19971205T090000", "19980102T090000",
+				"19980206T090000", "19980306T090000", "19980403T090000", "19980501T090000", "19980605T090000",
+			},
+		},
+		{
+			name:    "monthly on the first Friday until December 24, 1997",
+			dtstart: "19970905T090000",
+			rule:    "FREQ=MONTHLY;UNTIL=19971224T000000Z;BYDAY=1FR",
+			want:    []string{"19970905T090000", "19971003T090000", "19971107T090000", "19971205T090000"},
+		},
+		{
+			name:    "every other month on the first and last Sunday for 10 occurrences",
+			dtstart: "19970907T090000",
+			rule:    "FREQ=MONTHLY;INTERVAL=2;COUNT=10;BYDAY=1SU,-1SU",
+			want: []string{
+				"19970907T090000", "19970928T090000", "19971102T090000", "19971130T090000", "19980104T090000",
+				"19980125T090000", "19980301T090000", "19980329T090000", "19980503T090000", "19980531T090000",
+			},
+		},
+		{
+			name:    "monthly on the second-to-last Monday for 6 months",
+			dtstart: "19970922T090000",
+			rule:    "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+			want: []string{
+				"19970922T090000", "19971020T090000", "19971117T090000",
+				"19971222T090000", "19980119T090000", "19980216T090000",
+			},
+		},
+		{
+			name:    "monthly on the third-to-the-last day",
+			dtstart: "19970928T090000",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-3",
+			end:     "19980301T000000",
+			want: []string{
+				"19970928T090000", "19971029T090000", "19971128T090000",
+				"19971229T090000", "19980129T090000", "19980226T090000",
+			},
+		},
+		{
+			name:    "monthly on the 2nd and 15th for 10 occurrences",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=2,15",
+			want: []string{
+				"19970902T090000", "19970915T090000", "19971002T090000", "19971015T090000", "19971102T090000",
+				"19971115T090000", "19971202T090000", "19971215T090000", "19980102T090000", "19980115T090000",
+			},
+		},
+		{
+			name:    "monthly on the first and last day for 10 occurrences",
+			dtstart: "19970930T090000",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=1,-1",
+			want: []string{
+				"19970930T090000", "19971001T090000", "19971031T090000", "19971101T090000", "19971130T090000",
+				"19971201T090000", "19971231T090000", "19980101T090000", "19980131T090000", "19980201T090000",
+			},
+		},
+		{
+			name:    "every 18 months on the 10th thru 15th for 10 occurrences",
+			dtstart: "19970910T090000",
+			rule:    "FREQ=MONTHLY;INTERVAL=18;COUNT=10;BYMONTHDAY=10,11,12,13,14,15",
+			want:    concat(daily(t, "19970910T090000", 6), daily(t, "19990310T090000", 4)),
+		},
+		{
+			name:    "every Tuesday, every other month",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MONTHLY;INTERVAL=2;BYDAY=TU",
+			end:     "19980201T000000",
+			want: []string{
+				"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000",
+				"19971104T090000", "19971111T090000", "19971118T090000", "19971125T090000",
+				"19980106T090000", "19980113T090000", "19980120T090000", "19980127T090000",
+			},
+		},
+		{
+			name:    "yearly in June and July for 10 occurrences",
+			dtstart: "19970610T090000",
+			rule:    "FREQ=YEARLY;COUNT=10;BYMONTH=6,7",
+			want: []string{
+				"19970610T090000", "19970710T090000", "19980610T090000", "19980710T090000", "19990610T090000",
+				"19990710T090000", "20000610T090000", "20000710T090000", "20010610T090000", "20010710T090000",
+			},
+		},
+		{
+			name:    "every other year on January, February and March for 10 occurrences",
+			dtstart: "19970310T090000",
+			rule:    "FREQ=YEARLY;INTERVAL=2;COUNT=10;BYMONTH=1,2,3",
+			want: []string{
+				"19970310T090000", "19990110T090000", "19990210T090000", "19990310T090000", "20010110T090000",
+				"20010210T090000", "20010310T090000", "20030110T090000", "20030210T090000", "20030310T090000",
+			},
+		},
+		{
+			name:    "every 20th Monday of the year",
+			dtstart: "19970519T090000",
+			rule:    "FREQ=YEARLY;BYDAY=20MO",
+			end:     "20000101T000000",
+			want:    []string{"19970519T090000", "19980518T090000", "19990517T090000"},
+		},
+		{
+			name:    "every Thursday in March",
+			dtstart: "19970313T090000",
+			rule:    "FREQ=YEARLY;BYMONTH=3;BYDAY=TH",
+			end:     "20000101T000000",
+			want: []string{
+				"19970313T090000", "19970320T090000", "19970327T090000",
+				"19980305T090000", "19980312T090000", "19980319T090000", "19980326T090000",
+				"19990304T090000", "19990311T090000", "19990318T090000", "19990325T090000",
+			},
+		},
+		{
+			name:    "every Thursday, but only during June, July and August",
+			dtstart: "19970605T090000",
+			rule:    "FREQ=YEARLY;BYDAY=TH;BYMONTH=6,7,8",
+			end:     "19980101T000000",
+			want: []string{
+				"19970605T090000", "19970612T090000", "19970619T090000", "19970626T090000", "19970703T090000",
+				"19970710T090000", "19970717T090000", "19970724T090000", "19970731T090000", "19970807T090000",
+				"19970814T090000", "19970821T090000", "19970828T090000",
+			},
+		},
+		{
+			name:    "every Friday the 13th",
+			dtstart: "19970902T090000",
+			rule:    "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+			exdates: []string{"19970902T090000"},
+			end:     "20001101T000000",
+			want:    []string{"19980213T090000", "19980313T090000", "19981113T090000", "19990813T090000", "20001013T090000"},
+		},
+		{
+			name:    "the first Saturday that follows the first Sunday of the month",
+			dtstart: "19970913T090000",
+			rule:    "FREQ=MONTHLY;BYDAY=SA;BYMONTHDAY=7,8,9,10,11,12,13",
+			end:     "19980701T000000",
+			want: []string{
+				"19970913T090000", "19971011T090000", "19971108T090000", "19971213T090000", "19980110T090000",
+				"19980207T090000", "19980307T090000", "19980411T090000", "19980509T090000", "19980613T090000",
+			},
+		},
+		{
+			name:    "U.S. Presidential Election day",
+			dtstart: "19961105T090000",
+			rule:    "FREQ=YEARLY;INTERVAL=4;BYMONTH=11;BYDAY=TU;BYMONTHDAY=2,3,4,5,6,7,8",
+			end:     "20050101T000000",
+			want:    []string{"19961105T090000", "20001107T090000", "20041102T090000"},
+		},
+		{
+			name:    "week start Monday",
+			dtstart: "19970805T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+			want:    []string{"19970805T090000", "19970810T090000", "19970819T090000", "19970824T090000"},
+		},
+		{
+			name:    "week start Sunday",
+			dtstart: "19970805T090000",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+			want:    []string{"19970805T090000", "19970817T090000", "19970819T090000", "19970831T090000"},
+		},
+		{
+			name:    "invalid dates are ignored",
+			dtstart: "20070115T090000",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=15,30;COUNT=5",
+			want:    []string{"20070115T090000", "20070130T090000", "20070215T090000", "20070315T090000", "20070330T090000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			end := time.Date(2100, 1, 1, 0, 0, 0, 0, ny)
+			if tt.end != "" {
+				end = mustTime(t, ny, tt.end)
+			}
+			var exdates []time.Time
+			for _, s := range tt.exdates {
+				exdates = append(exdates, mustTime(t, ny, s))
+			}
+
+			got := r.Occurrences(mustTime(t, ny, tt.dtstart), end, exdates)
+			for _, o := range got {
+				if o.Location() != ny {
+					t.Fatalf("occurrence %v is not in the event time zone", o)
+				}
+			}
+			if gotStr := formatAll(got); !equalStrings(gotStr, tt.want) {
+				t.Errorf("Occurrences():\n got %v\nwant %v", gotStr, tt.want)
+			}
+		})
+	}
+}
+
+// Еженедельное событие остается в то же местное время по обе стороны перехода на зимнее время
+func TestOccurrencesWeeklyAcrossDST(t *testing.T) {
+	tests := []struct {
+		zone    string
+		dtstart string
+		rule    string
+		wantUTC []string
+	}{
+		{
+			// в Европе зимнее время с 26 октября 2025
+			zone:    "Europe/Berlin",
+			dtstart: "20251013T190000",
+			rule:    "FREQ=WEEKLY;COUNT=4",
+			wantUTC: []string{"20251013T170000", "20251020T170000", "20251027T180000", "20251103T180000"},
+		},
+		{
+			// в США летнее время с 9 марта 2025
+			zone:    "America/New_York",
+			dtstart: "20250301T100000",
+			rule:    "FREQ=WEEKLY;BYDAY=SA,SU;COUNT=4",
+			wantUTC: []string{"20250301T150000", "20250302T150000", "20250308T150000", "20250309T140000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			loc := mustLoad(t, tt.zone)
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dtstart := mustTime(t, loc, tt.dtstart)
+
+			got := r.Occurrences(dtstart, dtstart.AddDate(1, 0, 0), nil)
+			if len(got) != len(tt.wantUTC) {
+				t.Fatalf("got %d occurrences, want %d: %v", len(got), len(tt.wantUTC), got)
+			}
+			for i, o := range got {
+				if h, m, _ := o.Clock(); h != dtstart.Hour() || m != dtstart.Minute() {
+					t.Errorf("occurrence %d at %s local, want %s", i, o.Format("15:04"), dtstart.Format("15:04"))
+				}
+				if utc := o.UTC().Format(layout); utc != tt.wantUTC[i] {
+					t.Errorf("occurrence %d at %s UTC, want %s", i, utc, tt.wantUTC[i])
+				}
+			}
+		})
+	}
+}
+
+// Серия, поделенная на вхождении, дает те же вхождения, что и целая, и COUNT не увеличивается
+func TestSplit(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+
+	tests := []struct {
+		name      string
+		dtstart   string
+		rule      string
+		exdates   []string
+		at        string
+		wantCount int
+		wantUntil string
+	}{
+		{
+			name:      "daily count",
+			dtstart:   "20250901T190000",
+			rule:      "FREQ=DAILY;COUNT=10",
+			at:        "20250904T190000",
+			wantCount: 7,
+		},
+		{
+			name:      "weekly by day count",
+			dtstart:   "20250902T190000",
+			rule:      "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10",
+			at:        "20250916T190000",
+			wantCount: 6,
+		},
+		{
+			// исключенные даты входят в COUNT, поэтому остаток от них не зависит
+			name:      "count with excluded dates before split",
+			dtstart:   "20250901T190000",
+			rule:      "FREQ=DAILY;COUNT=10",
+			exdates:   []string{"20250902T190000", "20250903T190000"},
+			at:        "20250905T190000",
+			wantCount: 6,
+		},
+		{
+			name:      "split at the last occurrence",
+			dtstart:   "20250901T190000",
+			rule:      "FREQ=MONTHLY;COUNT=3",
+			at:        "20251101T190000",
+			wantCount: 1,
+		},
+		{
+			name:      "until is kept",
+			dtstart:   "20250901T190000",
+			rule:      "FREQ=WEEKLY;UNTIL=20251231T000000Z",
+			at:        "20251013T190000",
+			wantUntil: "20251231T000000",
+		},
+		{
+			name:    "unbounded",
+			dtstart: "20250901T190000",
+			rule:    "FREQ=DAILY;INTERVAL=3",
+			at:      "20250910T190000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dtstart, at := mustTime(t, moscow, tt.dtstart), mustTime(t, moscow, tt.at)
+			var exdates []time.Time
+			for _, s := range tt.exdates {
+				exdates = append(exdates, mustTime(t, moscow, s))
+			}
+
+			before, after := r.Split(dtstart, at)
+			if after.Count != tt.wantCount {
+				t.Errorf("after.Count = %d, want %d", after.Count, tt.wantCount)
+			}
+			if got := after.Until; tt.wantUntil != "" && got.Format(layout) != tt.wantUntil {
+				t.Errorf("after.Until = %s, want %s", got.Format(layout), tt.wantUntil)
+			}
+			if r.Count != 0 && before.Count != 0 {
+				t.Errorf("before keeps COUNT=%d, want UNTIL", before.Count)
+			}
+
+			// правила переживают сохранение строкой
+			before, err = Parse(before.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err = Parse(after.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end := dtstart.AddDate(1, 0, 0)
+			want := formatAll(r.Occurrences(dtstart, end, exdates))
+			got := formatAll(append(before.Occurrences(dtstart, end, exdates), after.Occurrences(at, end, exdates)...))
+			if !equalStrings(got, want) {
+				t.Errorf("split occurrences:\n got %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{rule: "RRULE:FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10", want: "FREQ=WEEKLY;COUNT=10;BYDAY=TU,TH"},
+		{rule: "freq=monthly;byday=-1su;interval=2", want: "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1SU"},
+		{rule: "FREQ=DAILY;UNTIL=20251231", want: "FREQ=DAILY;UNTIL=20251231"},
+		{rule: "FREQ=WEEKLY;WKST=SU", want: "FREQ=WEEKLY;WKST=SU"},
+		{rule: "COUNT=10", wantErr: true},
+		{rule: "FREQ=HOURLY", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=0", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=5;UNTIL=20251231", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=5;COUNT=6", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYMONTHDAY=1", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+		{rule: "FREQ=YEARLY;BYMONTH=13", wantErr: true},
+		{rule: "FREQ=YEARLY;BYSETPOS=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Fatalf("Parse(%q) error = %v, want ErrInvalidRule", tt.rule, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"eventify/event/internal/ical"
+	"eventify/event/internal/models"
+	"eventify/event/internal/repository"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrCalendarNotFound неизвестный или отозванный токен подписки
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+const (
+	// uidDomain правая часть UID в календарях; UID строится из id серии и не меняется
+	// ни при изменении события, ни при разделении серии
+	uidDomain = "eventify"
+	// feedRefresh как часто календарному приложению перечитывать ленту записей
+	feedRefresh = time.Hour
+)
+
+// EventCalendar календарь одного события. Повторяющееся событие выгружается серией с RRULE,
+// отдельно измененные и отмененные вхождения — с RECURRENCE-ID под тем же UID.
+func (s *EventService) EventCalendar(ctx context.Context, eventID int) ([]byte, error) {
+	var e models.EventResp
+	if err := s.GetEventByID(ctx, eventID, &e); err != nil {
+		return nil, err
+	}
+	var occurrences []models.Occurrence
+	if err := s.repo.GetOccurrences(ctx, eventID, nil, nil, &occurrences); err != nil {
+		return nil, err
+	}
+
+	cal := ical.Calendar{Name: e.Title}
+	if e.Recurrence == nil {
+		ev := calendarEvent(e)
+		// у события без повторения одно вхождение, его могли отменить отдельно
+		if len(occurrences) > 0 {
+			ev = withOccurrence(ev, occurrences[0])
+		}
+		cal.Events = append(cal.Events, ev)
+	} else {
+		series := calendarEvent(e)
+		series.RRule = e.Recurrence.Rule
+		series.ExDates = e.Recurrence.ExDates
+		cal.Events = append(cal.Events, series)
+		for _, o := range occurrences {
+			if !o.Modified {
+				continue
+			}
+			ev := withOccurrence(calendarEvent(e), o)
+			ev.RecurrenceID = &o.OriginalStart
+			cal.Events = append(cal.Events, ev)
+		}
+	}
+	return encodeCalendar(cal)
+}
+
+// CalendarFeed лента вхождений, на которые записан владелец токена подписки.
+// Вхождение повторяющегося события идет под UID серии с RECURRENCE-ID, как в EventCalendar,
+// поэтому лента и импортированный файл описывают одни и те же события календаря.
+func (s *EventService) CalendarFeed(ctx context.Context, token string) ([]byte, error) {
+	var userID int
+	err := s.repo.GetCalendarTokenUser(ctx, hashToken(token), &userID)
+	if errors.Is(err, repository.ErrCalendarNotFound) {
+		return nil, ErrCalendarNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.CalendarEntry
+	if err = s.repo.GetUserCalendar(ctx, userID, &entries); err != nil {
+		return nil, err
+	}
+
+	cal := ical.Calendar{Name: "Eventify", RefreshInterval: feedRefresh}
+	for _, entry := range entries {
+		ev := withOccurrence(calendarEvent(entry.Event), entry.Occurrence)
+		if entry.Event.Recurrence != nil {
+			ev.RecurrenceID = &entry.Occurrence.OriginalStart
+		}
+		cal.Events = append(cal.Events, ev)
+	}
+	return encodeCalendar(cal)
+}
+
+// CreateCalendarToken выпускает токен подписки на календарь записей; прежний токен перестает действовать
+func (s *EventService) CreateCalendarToken(ctx context.Context, userID int) (models.CalendarTokenResp, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return models.CalendarTokenResp{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := s.repo.SaveCalendarToken(ctx, userID, hashToken(token)); err != nil {
+		return models.CalendarTokenResp{}, err
+	}
+	return models.CalendarTokenResp{
+		Token: token,
+		URL:   strings.TrimSuffix(s.calendarURL, "/") + "/" + token + ".ics",
+	}, nil
+}
+
+// RevokeCalendarToken отзывает токен подписки, лента по нему больше не открывается
+func (s *EventService) RevokeCalendarToken(ctx context.Context, userID int) error {
+	err := s.repo.DeleteCalendarToken(ctx, userID)
+	if errors.Is(err, repository.ErrCalendarNotFound) {
+		return ErrCalendarNotFound
+	}
+	return err
+}
+
+// calendarEvent событие календаря по серии; UID — по id серии
+func calendarEvent(e models.EventResp) ical.Event {
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	var place []string
+	for _, part := range []string{e.Location.Venue, e.Location.Address, e.Location.City} {
+		if part != "" {
+			place = append(place, part)
+		}
+	}
+
+	return ical.Event{
+		UID:            calendarUID(e),
+		Sequence:       e.Sequence,
+		Start:          e.StartTime,
+		End:            e.EndTime,
+		Location:       loc,
+		Summary:        e.Title,
+		Description:    e.Description,
+		Place:          strings.Join(place, ", "),
+		Latitude:       e.Location.Latitude,
+		Longitude:      e.Location.Longitude,
+		OrganizerName:  e.Organizer.Username,
+		OrganizerEmail: e.Organizer.Email,
+		Cancelled:      e.Status == models.StatusCancelled,
+		Created:        e.CreatedAt,
+		LastModified:   e.UpdatedAt,
+	}
+}
+
+// calendarUID UID серии: от первого события, из которого она выделилась при разделении
+func calendarUID(e models.EventResp) string {
+	id := e.SeriesID
+	if id == 0 {
+		id = e.ID
+	}
+	return fmt.Sprintf("event-%d@%s", id, uidDomain)
+}
+
+// withOccurrence переносит в событие календаря время, текст и статус вхождения.
+// SEQUENCE складывается из версий серии и вхождения, поэтому растет при изменении любого из них.
+func withOccurrence(ev ical.Event, o models.Occurrence) ical.Event {
+	ev.Start, ev.End = o.StartTime, o.EndTime
+	ev.Summary, ev.Description = o.Title, o.Description
+	ev.Cancelled = ev.Cancelled || o.Status == models.StatusCancelled
+	ev.Sequence += o.Sequence
+	if o.UpdatedAt != nil && (ev.LastModified == nil || o.UpdatedAt.After(*ev.LastModified)) {
+		ev.LastModified = o.UpdatedAt
+	}
+	return ev
+}
+
+func encodeCalendar(cal ical.Calendar) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cal.Encode(&buf, time.Now()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hashToken хэш для хранения токена подписки; токены случайные, поэтому соль не нужна
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
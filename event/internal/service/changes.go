@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventify/common/kafka"
+	"eventify/event/internal/models"
+	"eventify/event/internal/repository"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEventNotFound  = errors.New("event not found")
+	ErrEventCancelled = errors.New("event is cancelled")
+	ErrNotOrganizer   = errors.New("only the organizer can change this event")
+	ErrInvalidEvent   = errors.New("invalid event")
+	// ErrInvalidCapacity вместимость меньше 1 или меньше числа участников из запроса
+	ErrInvalidCapacity = errors.New("capacity must be positive and not less than the number of participants")
+)
+
+// UpdateEvent меняет переданные поля события. Менять событие может его организатор,
+// а с anyEvent (право event:moderate) — любое событие.
+func (s *EventService) UpdateEvent(ctx context.Context, eventID, userID int, anyEvent bool, req models.EventUpdateReq) (models.EventResp, error) {
+	var e models.EventResp
+	if err := s.getOwnEvent(ctx, eventID, userID, anyEvent, &e); err != nil {
+		return models.EventResp{}, err
+	}
+	if e.Status == models.StatusCancelled {
+		return models.EventResp{}, ErrEventCancelled
+	}
+
+	var changes []string
+	if req.Title != nil && *req.Title != e.Title {
+		if strings.TrimSpace(*req.Title) == "" {
+			return models.EventResp{}, ErrInvalidEvent
+		}
+		e.Title = *req.Title
+		changes = append(changes, "title")
+	}
+	if req.Description != nil && *req.Description != e.Description {
+		e.Description = *req.Description
+		changes = append(changes, "description")
+	}
+	if req.Category != nil && *req.Category != e.Category {
+		e.Category = *req.Category
+		changes = append(changes, "category")
+	}
+	if req.Location != nil {
+		// место без координат заново ищется в справочнике
+		location := *req.Location
+		if err := s.locate(&location); err != nil {
+			return models.EventResp{}, err
+		}
+		if !sameLocation(location, e.Location) {
+			e.Location = location
+			changes = append(changes, "location")
+		}
+	}
+	if req.StartTime != nil && !req.StartTime.Equal(e.StartTime) {
+		e.StartTime = *req.StartTime
+		changes = append(changes, "start_time")
+	}
+	if req.EndTime != nil && !req.EndTime.Equal(e.EndTime) {
+		e.EndTime = *req.EndTime
+		changes = append(changes, "end_time")
+	}
+	if req.TimeZone != nil && *req.TimeZone != e.TimeZone {
+		e.TimeZone = *req.TimeZone
+		changes = append(changes, "time_zone")
+	}
+	if req.Recurrence != nil {
+		e.Recurrence = req.Recurrence
+		changes = append(changes, "recurrence")
+	}
+	if !e.EndTime.After(e.StartTime) {
+		return models.EventResp{}, ErrInvalidEvent
+	}
+	if len(changes) == 0 {
+		return e, nil
+	}
+
+	// вхождения пересчитываются, только если изменилось время или правило
+	var occurrences []models.OccurrenceTime
+	for _, field := range changes {
+		if field == "start_time" || field == "end_time" || field == "time_zone" || field == "recurrence" {
+			var err error
+			if occurrences, err = s.occurrenceTimes(e.StartTime, e.EndTime, e.TimeZone, e.Recurrence); err != nil {
+				return models.EventResp{}, err
+			}
+			break
+		}
+	}
+
+	err := s.repo.UpdateEvent(ctx, &e, occurrences, syncFrom(e))
+	if errors.Is(err, repository.ErrEventCancelled) {
+		return models.EventResp{}, ErrEventCancelled
+	}
+	if err != nil {
+		return models.EventResp{}, err
+	}
+
+	err = s.publishEventChange(ctx, kafka.EventUpdated, e, map[string]interface{}{
+		"changes":    changes,
+		"end_time":   e.EndTime,
+		"location":   e.Location,
+		"updated_by": userID,
+	})
+	return e, err
+}
+
+// CancelEvent отменяет событие. Оно остается в списках со статусом cancelled, участники получают уведомление.
+func (s *EventService) CancelEvent(ctx context.Context, eventID, userID int, anyEvent bool, reason string) error {
+	var e models.EventResp
+	if err := s.getOwnEvent(ctx, eventID, userID, anyEvent, &e); err != nil {
+		return err
+	}
+
+	err := s.repo.CancelEvent(ctx, eventID, reason)
+	if errors.Is(err, repository.ErrEventCancelled) {
+		return ErrEventCancelled
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.publishEventChange(ctx, kafka.EventCancelled, e, map[string]interface{}{
+		"reason":       reason,
+		"cancelled_by": userID,
+	})
+}
+
+// DeleteEvent удаляет событие вместе с регистрациями и отзывами
+func (s *EventService) DeleteEvent(ctx context.Context, eventID, userID int, anyEvent bool) error {
+	var e models.EventResp
+	if err := s.getOwnEvent(ctx, eventID, userID, anyEvent, &e); err != nil {
+		return err
+	}
+
+	err := s.repo.DeleteEvent(ctx, eventID)
+	if errors.Is(err, repository.ErrEventNotFound) {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.publishEventChange(ctx, kafka.EventDeleted, e, map[string]interface{}{
+		"deleted_by": userID,
+	})
+}
+
+// getOwnEvent загружает событие и проверяет, что userID его организатор
+func (s *EventService) getOwnEvent(ctx context.Context, eventID, userID int, anyEvent bool, e *models.EventResp) error {
+	err := s.repo.GetEventByID(ctx, eventID, e)
+	if errors.Is(err, repository.ErrEventNotFound) {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !anyEvent && int(e.Organizer.ID) != userID {
+		return ErrNotOrganizer
+	}
+	return nil
+}
+
+// publishEventChange публикует изменение события со списком участников,
+// которым notification сервис разошлет уведомления
+func (s *EventService) publishEventChange(ctx context.Context, key string, e models.EventResp, extra map[string]interface{}) error {
+	participants := e.Participants
+	if participants == nil {
+		participants = []models.Participant{}
+	}
+
+	payload := map[string]interface{}{
+		"event_id":     e.ID,
+		"event_name":   e.Title,
+		"event_date":   e.StartTime.Format(time.DateTime),
+		"participants": participants,
+	}
+	for k, v := range extra {
+		payload[k] = v
+	}
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.producer.SendMessage(ctx, key, value)
+}
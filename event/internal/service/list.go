@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"eventify/event/internal/models"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+const (
+	defaultEventsLimit = 20
+	maxEventsLimit     = 100
+)
+
+// порядок по умолчанию: ближайшие события первыми, новые и популярные — сверху
+var defaultOrders = map[string]string{
+	"start_time": "asc",
+	"created_at": "desc",
+	"popularity": "desc",
+}
+
+// ListEvents страница событий. Курсор из next_cursor продолжает список с теми же сортировкой и порядком,
+// фильтры клиент передает те же, что и для первой страницы.
+func (s *EventService) ListEvents(ctx context.Context, filter models.EventFilter) (models.EventPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = "start_time"
+	}
+	defaultOrder, ok := defaultOrders[filter.Sort]
+	if !ok {
+		return models.EventPage{}, ErrInvalidFilter
+	}
+	if filter.Order == "" {
+		filter.Order = defaultOrder
+	}
+	if filter.Order != "asc" && filter.Order != "desc" {
+		return models.EventPage{}, ErrInvalidFilter
+	}
+	if filter.Limit < 1 {
+		filter.Limit = defaultEventsLimit
+	}
+	if filter.Limit > maxEventsLimit {
+		filter.Limit = maxEventsLimit
+	}
+
+	var cursor *models.EventCursor
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil || c.Sort != filter.Sort || c.Order != filter.Order {
+			return models.EventPage{}, ErrInvalidCursor
+		}
+		cursor = &c
+	}
+
+	// одно лишнее событие показывает, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	page := models.EventPage{Events: []models.EventResp{}}
+	if err := s.repo.ListEvents(ctx, filter, cursor, &page.Events); err != nil {
+		return models.EventPage{}, err
+	}
+	if len(page.Events) <= limit {
+		return page, nil
+	}
+
+	page.Events = page.Events[:limit]
+	last := page.Events[limit-1]
+	next := models.EventCursor{Sort: filter.Sort, Order: filter.Order, ID: last.ID}
+	switch filter.Sort {
+	case "start_time":
+		next.Time = &last.StartTime
+	case "created_at":
+		next.Time = &last.CreatedAt
+	case "popularity":
+		next.Count = last.ParticipantsCount
+	}
+	page.NextCursor = encodeCursor(next)
+	return page, nil
+}
+
+// курсор непрозрачен для клиента: base64url от JSON
+func encodeCursor(c models.EventCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (models.EventCursor, error) {
+	var c models.EventCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err = json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if !validCursor(c) {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// validCursor в курсоре есть id и значение именно того ключа, по которому он сортирует,
+// иначе запрос к репозиторию сравнивал бы с пустым значением
+func validCursor(c models.EventCursor) bool {
+	if c.ID == 0 {
+		return false
+	}
+	switch c.Sort {
+	case "start_time", "created_at":
+		return c.Time != nil && c.Count == 0
+	case "popularity":
+		return c.Time == nil && c.Count >= 0
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"eventify/event/internal/geo"
+	"eventify/event/internal/models"
+)
+
+var ErrInvalidLocation = errors.New("lat and lon are required, radius_km must be at most 100")
+
+const (
+	defaultNearbyRadiusKm = 10
+	maxNearbyRadiusKm     = 100
+	defaultNearbyLimit    = 20
+	maxNearbyLimit        = 100
+)
+
+// NearbyEvents предстоящие события в радиусе от точки, ближайшие первыми.
+// В выдачу попадают только события с координатами.
+func (s *EventService) NearbyEvents(ctx context.Context, filter models.NearbyFilter) ([]models.NearbyEvent, error) {
+	if filter.Lat == nil || filter.Lon == nil || !geo.Valid(*filter.Lat, *filter.Lon) {
+		return nil, ErrInvalidLocation
+	}
+	if filter.RadiusKm == 0 {
+		filter.RadiusKm = defaultNearbyRadiusKm
+	}
+	if !(filter.RadiusKm > 0 && filter.RadiusKm <= maxNearbyRadiusKm) {
+		return nil, ErrInvalidLocation
+	}
+	if filter.Limit < 1 || filter.Limit > maxNearbyLimit {
+		filter.Limit = defaultNearbyLimit
+	}
+
+	events := []models.NearbyEvent{}
+	if err := s.repo.NearbyEvents(ctx, *filter.Lat, *filter.Lon, filter.RadiusKm*1000, filter.Limit, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GeocodeEvents проставляет координаты из справочника событиям, у которых их нет:
+// созданным до появления координат и тем, чьи города добавили в справочник позже.
+// Возвращает число событий, которым нашлись координаты.
+func (s *EventService) GeocodeEvents(ctx context.Context) (int, error) {
+	var events []models.EventResp
+	if err := s.repo.GetEventsWithoutCoordinates(ctx, &events); err != nil {
+		return 0, err
+	}
+
+	located := 0
+	for _, e := range events {
+		p, ok := s.gazetteer.Lookup(e.Location.City, e.Location.Venue)
+		if !ok {
+			continue
+		}
+		if err := s.repo.SetCoordinates(ctx, e.ID, p.Lat, p.Lon); err != nil {
+			return located, err
+		}
+		located++
+	}
+	return located, nil
+}
+
+// locate проверяет координаты от организатора, а если их нет — ищет место в справочнике.
+// Место, которого нет в справочнике, остается без координат.
+func (s *EventService) locate(loc *models.Location) error {
+	if (loc.Latitude == nil) != (loc.Longitude == nil) {
+		return ErrInvalidEvent
+	}
+	if loc.Latitude != nil {
+		if !geo.Valid(*loc.Latitude, *loc.Longitude) {
+			return ErrInvalidEvent
+		}
+		return nil
+	}
+
+	if p, ok := s.gazetteer.Lookup(loc.City, loc.Venue); ok {
+		loc.Latitude, loc.Longitude = &p.Lat, &p.Lon
+	}
+	return nil
+}
+
+// sameLocation сравнивает места по значениям координат, а не по указателям
+func sameLocation(a, b models.Location) bool {
+	if a.City != b.City || a.Venue != b.Venue || a.Address != b.Address {
+		return false
+	}
+	return sameCoordinate(a.Latitude, b.Latitude) && sameCoordinate(a.Longitude, b.Longitude)
+}
+
+func sameCoordinate(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
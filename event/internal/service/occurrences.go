@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"eventify/common/kafka"
+	"eventify/event/internal/models"
+	"eventify/event/internal/repository"
+	"eventify/event/internal/rrule"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrOccurrenceNotFound = errors.New("occurrence not found")
+	ErrInvalidRecurrence  = errors.New("invalid recurrence")
+	// ErrOccurrenceField у одного вхождения меняются только название, описание и время
+	ErrOccurrenceField = errors.New("only title, description, start_time and end_time can be changed for a single occurrence")
+)
+
+// occurrenceTimes вхождения события до горизонта; у события без правила — одно вхождение
+func (s *EventService) occurrenceTimes(start, end time.Time, timeZone string, recurrence *models.Recurrence) ([]models.OccurrenceTime, error) {
+	rule, loc, err := parseRecurrence(timeZone, recurrence)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return []models.OccurrenceTime{{OriginalStart: start, Start: start, End: end}}, nil
+	}
+	duration := end.Sub(start)
+
+	starts := rule.Occurrences(start.In(loc), time.Now().Add(s.horizon), recurrence.ExDates)
+	occurrences := make([]models.OccurrenceTime, 0, len(starts))
+	for _, t := range starts {
+		occurrences = append(occurrences, models.OccurrenceTime{OriginalStart: t, Start: t, End: t.Add(duration)})
+	}
+	return occurrences, nil
+}
+
+// parseRecurrence проверяет часовой пояс и правило; правило приводится к каноническому виду
+func parseRecurrence(timeZone string, recurrence *models.Recurrence) (*rrule.Rule, *time.Location, error) {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil || timeZone == "" || strings.EqualFold(timeZone, "local") {
+		return nil, nil, fmt.Errorf("%w: unknown time_zone %q", ErrInvalidRecurrence, timeZone)
+	}
+	if recurrence == nil {
+		return nil, loc, nil
+	}
+
+	rule, err := rrule.Parse(recurrence.Rule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+	}
+	recurrence.Rule = rule.String()
+	return rule, loc, nil
+}
+
+// syncFrom с какого момента пересчитываются вхождения после изменения серии:
+// у повторяющегося события прошедшие вхождения остаются как были, у обычного — единственное вхождение всегда
+func syncFrom(e models.EventResp) time.Time {
+	if e.Recurrence == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// ListOccurrences вхождения события в промежутке по времени начала
+func (s *EventService) ListOccurrences(ctx context.Context, eventID int, filter models.OccurrenceFilter) ([]models.Occurrence, error) {
+	var e models.EventResp
+	if err := s.GetEventByID(ctx, eventID, &e); err != nil {
+		return nil, err
+	}
+
+	occurrences := []models.Occurrence{}
+	if err := s.repo.GetOccurrences(ctx, eventID, filter.From, filter.To, &occurrences); err != nil {
+		return nil, err
+	}
+	return occurrences, nil
+}
+
+// UpdateOccurrence меняет только одно вхождение; остальная серия и ее будущие изменения его не касаются
+func (s *EventService) UpdateOccurrence(ctx context.Context, eventID, occurrenceID, userID int, anyEvent bool, req models.EventUpdateReq) (models.Occurrence, error) {
+	if req.Category != nil || req.Location != nil || req.TimeZone != nil || req.Recurrence != nil {
+		return models.Occurrence{}, ErrOccurrenceField
+	}
+
+	var e models.EventResp
+	if err := s.getOwnEvent(ctx, eventID, userID, anyEvent, &e); err != nil {
+		return models.Occurrence{}, err
+	}
+	var o models.Occurrence
+	if err := s.getOccurrence(ctx, eventID, occurrenceID, &o); err != nil {
+		return models.Occurrence{}, err
+	}
+	if o.Status == models.StatusCancelled {
+		return models.Occurrence{}, ErrEventCancelled
+	}
+
+	var changes []string
+	if req.Title != nil && *req.Title != o.Title {
+		if strings.TrimSpace(*req.Title) == "" {
+			return models.Occurrence{}, ErrInvalidEvent
+		}
+		o.Title = *req.Title
+		changes = append(changes, "title")
+	}
+	if req.Description != nil && *req.Description != o.Description {
+		o.Description = *req.Description
+		changes = append(changes, "description")
+	}
+	if req.StartTime != nil && !req.StartTime.Equal(o.StartTime) {
+		o.StartTime = *req.StartTime
+		changes = append(changes, "start_time")
+	}
+	if req.EndTime != nil && !req.EndTime.Equal(o.EndTime) {
+		o.EndTime = *req.EndTime
+		changes = append(changes, "end_time")
+	}
+	if !o.EndTime.After(o.StartTime) {
+		return models.Occurrence{}, ErrInvalidEvent
+	}
+	if len(changes) == 0 {
+		return o, nil
+	}
+
+	err := s.repo.UpdateOccurrence(ctx, &o, req.Title, req.Description)
+	if errors.Is(err, repository.ErrEventCancelled) {
+		return models.Occurrence{}, ErrEventCancelled
+	}
+	if err != nil {
+		return models.Occurrence{}, err
+	}
+	o.Modified = true
+
+	err = s.publishOccurrenceChange(ctx, kafka.EventUpdated, e, o, map[string]interface{}{
+		"changes":    changes,
+		"end_time":   o.EndTime,
+		"updated_by": userID,
+	})
+	return o, err
+}
+
+// UpdateFollowing меняет вхождение и все следующие: серия делится, и с этого вхождения
+// начинается новое событие с изменениями. Записи на следующие вхождения переходят в него.
+func (s *EventService) UpdateFollowing(ctx context.Context, eventID, occurrenceID, userID int, anyEvent bool, req models.EventUpdateReq) (models.EventResp, error) {
+	var e models.EventResp
+	if err := s.getOwnEvent(ctx, eventID, userID, anyEvent, &e); err != nil {
+		return models.EventResp{}, err
+	}
+	if e.Status == models.StatusCancelled {
+		return models.EventResp{}, ErrEventCancelled
+	}
+	var o models.Occurrence
+	if err := s.getOccurrence(ctx, eventID, occurrenceID, &o); err != nil {
+		return models.EventResp{}, err
+	}
+	// с первого вхождения "это и следующие" — вся серия
+	if e.Recurrence == nil || !o.OriginalStart.After(e.StartTime) {
+		return s.UpdateEvent(ctx, eventID, userID, anyEvent, req)
+	}
+
+	rule, loc, err := parseRecurrence(e.TimeZone, e.Recurrence)
+	if err != nil {
+		return models.EventResp{}, err
+	}
+
+	// старая серия заканчивается перед вхождением, исключенные даты делятся между сериями
+	oldRule, nextRule := rule.Split(e.StartTime.In(loc), o.OriginalStart)
+	old := e
+	old.Recurrence = &models.Recurrence{Rule: oldRule.String()}
+	next := e
+	next.Participants = nil
+	next.Recurrence = &models.Recurrence{}
+	for _, t := range e.Recurrence.ExDates {
+		if t.Before(o.OriginalStart) {
+			old.Recurrence.ExDates = append(old.Recurrence.ExDates, t)
+		} else {
+			next.Recurrence.ExDates = append(next.Recurrence.ExDates, t)
+		}
+	}
+	next.Recurrence.Rule = nextRule.String()
+
+	duration := e.EndTime.Sub(e.StartTime)
+	next.StartTime, next.EndTime = o.OriginalStart, o.OriginalStart.Add(duration)
+
+	var changes []string
+	if req.Title != nil && *req.Title != next.Title {
+		if strings.TrimSpace(*req.Title) == "" {
+			return models.EventResp{}, ErrInvalidEvent
+		}
+		next.Title = *req.Title
+		changes = append(changes, "title")
+	}
+	if req.Description != nil && *req.Description != next.Description {
+		next.Description = *req.Description
+		changes = append(changes, "description")
+	}
+	if req.Category != nil && *req.Category != next.Category {
+		next.Category = *req.Category
+		changes = append(changes, "category")
+	}
+	if req.Location != nil {
+		location := *req.Location
+		if err = s.locate(&location); err != nil {
+			return models.EventResp{}, err
+		}
+		if !sameLocation(location, next.Location) {
+			next.Location = location
+			changes = append(changes, "location")
+		}
+	}
+	if req.StartTime != nil && !req.StartTime.Equal(next.StartTime) {
+		next.StartTime = *req.StartTime
+		next.EndTime = next.StartTime.Add(duration)
+		changes = append(changes, "start_time")
+	}
+	if req.EndTime != nil && !req.EndTime.Equal(next.EndTime) {
+		next.EndTime = *req.EndTime
+		changes = append(changes, "end_time")
+	}
+	if req.TimeZone != nil && *req.TimeZone != next.TimeZone {
+		next.TimeZone = *req.TimeZone
+		changes = append(changes, "time_zone")
+	}
+	if req.Recurrence != nil {
+		next.Recurrence = req.Recurrence
+		changes = append(changes, "recurrence")
+	}
+	if !next.EndTime.After(next.StartTime) {
+		return models.EventResp{}, ErrInvalidEvent
+	}
+	if len(changes) == 0 {
+		return e, nil
+	}
+
+	occurrences, err := s.occurrenceTimes(next.StartTime, next.EndTime, next.TimeZone, next.Recurrence)
+	if err != nil {
+		return models.EventResp{}, err
+	}
+
+	err = s.repo.SplitSeries(ctx, &old, &next, o.OriginalStart, occurrences)
+	if errors.Is(err, repository.ErrEventCancelled) {
+		return models.EventResp{}, ErrEventCancelled
+	}
+	if err != nil {
+		return models.EventResp{}, err
+	}
+
+	if err = s.repo.GetEventByID(ctx, int(next.ID), &next); err != nil {
+		return models.EventResp{}, err
+	}
+	err = s.publishEventChange(ctx, kafka.EventUpdated, next, map[string]interface{}{
+		"changes":           changes,
+		"end_time":          next.EndTime,
+		"location":          next.Location,
+		"previous_event_id": e.ID,
+		"updated_by":        userID,
+	})
+	return next, err
+}
+
+// CancelOccurrence отменяет одно вхождение, остальная серия остается
+func (s *EventService) CancelOccurrence(ctx context.Context, eventID, occurrenceID, userID int, anyEvent bool, reason string) error {
+	var e models.EventResp
+	if err := s.getOwnEvent(ctx, eventID, userID, anyEvent, &e); err != nil {
+		return err
+	}
+	var o models.Occurrence
+	if err := s.getOccurrence(ctx, eventID, occurrenceID, &o); err != nil {
+		return err
+	}
+
+	err := s.repo.CancelOccurrence(ctx, eventID, occurrenceID)
+	if errors.Is(err, repository.ErrEventCancelled) {
+		return ErrEventCancelled
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.publishOccurrenceChange(ctx, kafka.EventCancelled, e, o, map[string]interface{}{
+		"reason":       reason,
+		"cancelled_by": userID,
+	})
+}
+
+// MaterializeOccurrences создает вхождения повторяющихся событий до горизонта.
+// Возвращает число событий, вхождения которых не удалось обновить.
+func (s *EventService) MaterializeOccurrences(ctx context.Context) (int, error) {
+	var events []models.EventResp
+	if err := s.repo.GetRecurringEvents(ctx, &events); err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, e := range events {
+		occurrences, err := s.occurrenceTimes(e.StartTime, e.EndTime, e.TimeZone, e.Recurrence)
+		if err == nil {
+			err = s.repo.SyncOccurrences(ctx, e, time.Now(), occurrences)
+		}
+		if err != nil {
+			log.Printf("failed to materialize occurrences of event %d: %v", e.ID, err)
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+// RunOccurrenceMaterializer раз в interval продлевает вхождения до горизонта, пока не отменен ctx
+func (s *EventService) RunOccurrenceMaterializer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.MaterializeOccurrences(ctx); err != nil {
+			log.Printf("failed to materialize occurrences: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *EventService) getOccurrence(ctx context.Context, eventID, occurrenceID int, o *models.Occurrence) error {
+	err := s.repo.GetOccurrence(ctx, eventID, occurrenceID, o)
+	if errors.Is(err, repository.ErrOccurrenceNotFound) {
+		return ErrOccurrenceNotFound
+	}
+	return err
+}
+
+// publishOccurrenceChange публикует изменение одного вхождения его участникам
+func (s *EventService) publishOccurrenceChange(ctx context.Context, key string, e models.EventResp, o models.Occurrence, extra map[string]interface{}) error {
+	e.Title, e.StartTime = o.Title, o.StartTime
+	e.Participants = nil
+	if err := s.repo.GetOccurrenceParticipants(ctx, int(o.ID), &e.Participants); err != nil {
+		return err
+	}
+
+	extra["occurrence_id"] = o.ID
+	return s.publishEventChange(ctx, key, e, extra)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"eventify/event/internal/models"
+	"eventify/event/internal/repository"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidSearch = errors.New("q is required and must be at most 200 characters")
+
+const (
+	maxSearchQueryLength = 200
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 50
+)
+
+var highlightReplacer = strings.NewReplacer(
+	repository.HighlightStart, "<mark>",
+	repository.HighlightStop, "</mark>",
+)
+
+// SearchEvents ищет события по названию, описанию, категории, городу и площадке.
+// Если точных совпадений нет, на первой странице ищет с учетом опечаток.
+func (s *EventService) SearchEvents(ctx context.Context, query string, limit, offset int) (models.SearchResp, error) {
+	query = strings.TrimSpace(query)
+	if query == "" || utf8.RuneCountInString(query) > maxSearchQueryLength || offset < 0 {
+		return models.SearchResp{}, ErrInvalidSearch
+	}
+	if limit < 1 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	resp := models.SearchResp{Results: []models.SearchResult{}}
+	if err := s.repo.SearchEvents(ctx, query, limit, offset, &resp.Results); err != nil {
+		return models.SearchResp{}, err
+	}
+	if len(resp.Results) == 0 && offset == 0 {
+		if err := s.repo.FuzzySearchEvents(ctx, query, limit, offset, &resp.Results); err != nil {
+			return models.SearchResp{}, err
+		}
+		resp.Fuzzy = true
+	}
+
+	for i := range resp.Results {
+		h := &resp.Results[i].Highlight
+		if resp.Fuzzy {
+			// у поиска по триграммам нет подсветки, показываем название целиком
+			h.Title = resp.Results[i].Title
+		}
+		h.Title = highlight(h.Title)
+		h.Description = highlight(h.Description)
+	}
+	return resp, nil
+}
+
+// highlight экранирует текст события и превращает маркеры совпадений в <mark>
+func highlight(fragment string) string {
+	return highlightReplacer.Replace(html.EscapeString(fragment))
+}
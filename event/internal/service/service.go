@@ -3,22 +3,46 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"eventify/common/kafka"
+	"eventify/event/internal/geo"
 	"eventify/event/internal/models"
 	"eventify/event/internal/repository"
+	"time"
 )
 
 type EventService struct {
-	repo     *repository.EventRepository
-	producer *kafka.Producer
+	repo      *repository.EventRepository
+	producer  *kafka.Producer
+	gazetteer *geo.Gazetteer
+	// horizon на сколько вперед создаются вхождения повторяющихся событий
+	horizon time.Duration
+	// calendarURL адрес лент календаря, к нему добавляется токен подписки
+	calendarURL string
 }
 
-func NewEventService(repo *repository.EventRepository, producer *kafka.Producer) *EventService {
-	return &EventService{repo: repo, producer: producer}
+func NewEventService(repo *repository.EventRepository, producer *kafka.Producer, gazetteer *geo.Gazetteer, horizon time.Duration, calendarURL string) *EventService {
+	return &EventService{repo: repo, producer: producer, gazetteer: gazetteer, horizon: horizon, calendarURL: calendarURL}
 }
 
 func (s *EventService) CreateEvent(ctx context.Context, req models.EventReq) error {
-	if err := s.repo.CreateEvent(ctx, req); err != nil {
+	if err := s.locate(&req.Location); err != nil {
+		return err
+	}
+	if req.Capacity != nil && (*req.Capacity < 1 || len(req.Participants) > *req.Capacity) {
+		return ErrInvalidCapacity
+	}
+	if req.TimeZone == "" {
+		req.TimeZone = "UTC"
+	}
+	if !req.EndTime.After(req.StartTime) {
+		return ErrInvalidEvent
+	}
+	occurrences, err := s.occurrenceTimes(req.StartTime, req.EndTime, req.TimeZone, req.Recurrence)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.CreateEvent(ctx, req, occurrences); err != nil {
 		return err
 	}
 
@@ -43,16 +67,44 @@ func (s *EventService) CreateEvent(ctx context.Context, req models.EventReq) err
 	return nil
 }
 
-func (s *EventService) GetEvents(ctx context.Context, events *[]models.EventResp) error {
-	if err := s.repo.GetEvents(ctx, events); err != nil {
-		return err
+func (s *EventService) GetEventByID(ctx context.Context, eventID int, e *models.EventResp) error {
+	err := s.repo.GetEventByID(ctx, eventID, e)
+	if errors.Is(err, repository.ErrEventNotFound) {
+		return ErrEventNotFound
 	}
-	return nil
+	return err
 }
 
-func (s *EventService) GetEventByID(ctx context.Context, eventID int, e *models.EventResp) error {
-	if err := s.repo.GetEventByID(ctx, eventID, e); err != nil {
-		return err
+func (s *EventService) UpdateUsername(ctx context.Context, userID int, username string) error {
+	return s.repo.UpdateUsername(ctx, userID, username)
+}
+
+// DeleteUserData вызывается по user.deleted
+func (s *EventService) DeleteUserData(ctx context.Context, userID int) error {
+	return s.repo.DeleteUserData(ctx, userID)
+}
+
+// ExportUserData события, которые пользователь организовал, и события, на которые он записан
+func (s *EventService) ExportUserData(ctx context.Context, userID int) (models.UserExport, error) {
+	export := models.UserExport{
+		OrganizedEvents: []models.EventResp{},
+		Participations:  []models.Participation{},
 	}
-	return nil
+
+	var ids []int
+	if err := s.repo.GetOrganizedEventIDs(ctx, userID, &ids); err != nil {
+		return models.UserExport{}, err
+	}
+	for _, id := range ids {
+		var e models.EventResp
+		if err := s.repo.GetEventByID(ctx, id, &e); err != nil {
+			return models.UserExport{}, err
+		}
+		export.OrganizedEvents = append(export.OrganizedEvents, e)
+	}
+
+	if err := s.repo.GetParticipations(ctx, userID, &export.Participations); err != nil {
+		return models.UserExport{}, err
+	}
+	return export, nil
 }
@@ -0,0 +1,13 @@
+create table if not exists schema_name.refresh_tokens
+(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    family_id VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    rotated_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+create index if not exists refresh_tokens_family_id_idx on schema_name.refresh_tokens (family_id);
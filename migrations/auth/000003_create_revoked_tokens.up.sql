@@ -0,0 +1,9 @@
+create table if not exists schema_name.revoked_tokens
+(
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+create index if not exists revoked_tokens_expires_at_idx on schema_name.revoked_tokens (expires_at);
@@ -0,0 +1,3 @@
+alter table schema_name.users drop column if exists tokens_valid_after;
+
+drop table if exists schema_name.password_reset_tokens;
@@ -0,0 +1,12 @@
+create table if not exists schema_name.password_reset_tokens
+(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- токены, выпущенные раньше этого момента, недействительны (сброс пароля, выход со всех устройств)
+alter table schema_name.users add column if not exists tokens_valid_after TIMESTAMPTZ;
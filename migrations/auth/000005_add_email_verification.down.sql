@@ -0,0 +1,3 @@
+drop table if exists schema_name.email_verification_tokens;
+
+alter table schema_name.users drop column if exists email_verified_at;
@@ -0,0 +1,14 @@
+alter table schema_name.users add column if not exists email_verified_at TIMESTAMPTZ;
+
+-- пользователи, зарегистрированные до появления проверки, считаются подтвержденными
+update schema_name.users set email_verified_at = created_at where email_verified_at is null;
+
+create table if not exists schema_name.email_verification_tokens
+(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+drop table if exists schema_name.role_changes;
@@ -0,0 +1,11 @@
+create table if not exists schema_name.role_changes
+(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    old_role VARCHAR(50),
+    new_role VARCHAR(50) NOT NULL,
+    changed_by INT REFERENCES schema_name.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+create index if not exists role_changes_user_id_idx on schema_name.role_changes (user_id);
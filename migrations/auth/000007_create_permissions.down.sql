@@ -0,0 +1,3 @@
+drop table if exists schema_name.role_permissions;
+drop table if exists schema_name.permissions;
+drop table if exists schema_name.roles;
@@ -0,0 +1,50 @@
+create table if not exists schema_name.roles
+(
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT
+);
+
+create table if not exists schema_name.permissions
+(
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT
+);
+
+create table if not exists schema_name.role_permissions
+(
+    role VARCHAR(50) NOT NULL REFERENCES schema_name.roles(name) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL REFERENCES schema_name.permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+insert into schema_name.roles (name, description) values
+    ('user', 'участник: регистрация на события и отзывы'),
+    ('organizer', 'организатор: создание и ведение своих событий'),
+    ('admin', 'администратор')
+on conflict do nothing;
+
+insert into schema_name.permissions (name, description) values
+    ('event:create', 'создание событий'),
+    ('event:update', 'изменение своих событий'),
+    ('event:moderate', 'изменение и удаление любых событий'),
+    ('event:register', 'регистрация на события'),
+    ('review:write', 'создание, изменение и удаление своих отзывов'),
+    ('review:delete:any', 'удаление любых отзывов'),
+    ('user:manage', 'управление пользователями и ролями')
+on conflict do nothing;
+
+insert into schema_name.role_permissions (role, permission) values
+    ('user', 'event:register'),
+    ('user', 'review:write'),
+    ('organizer', 'event:register'),
+    ('organizer', 'review:write'),
+    ('organizer', 'event:create'),
+    ('organizer', 'event:update'),
+    ('admin', 'event:register'),
+    ('admin', 'review:write'),
+    ('admin', 'event:create'),
+    ('admin', 'event:update'),
+    ('admin', 'event:moderate'),
+    ('admin', 'review:delete:any'),
+    ('admin', 'user:manage')
+on conflict do nothing;
@@ -0,0 +1,6 @@
+alter table schema_name.users
+    drop column if exists display_name,
+    drop column if exists avatar_url,
+    drop column if exists bio,
+    drop column if exists locale,
+    drop column if exists time_zone;
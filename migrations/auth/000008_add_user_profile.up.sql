@@ -0,0 +1,6 @@
+alter table schema_name.users
+    add column if not exists display_name VARCHAR(100),
+    add column if not exists avatar_url TEXT,
+    add column if not exists bio TEXT,
+    add column if not exists locale VARCHAR(20),
+    add column if not exists time_zone VARCHAR(64);
@@ -0,0 +1,8 @@
+-- счетчики неудачных входов: key = 'login:<логин>' или 'ip:<адрес>'
+create table if not exists schema_name.login_failures
+(
+    key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
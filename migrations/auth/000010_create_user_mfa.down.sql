@@ -0,0 +1,5 @@
+alter table schema_name.roles
+    drop column if exists mfa_required;
+
+drop table if exists schema_name.mfa_recovery_codes;
+drop table if exists schema_name.user_mfa;
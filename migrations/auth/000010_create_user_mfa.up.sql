@@ -0,0 +1,23 @@
+-- TOTP секрет пользователя; пока enabled_at пуст, секрет ждет подтверждения кодом
+create table if not exists schema_name.user_mfa
+(
+    user_id INT PRIMARY KEY REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    -- последний принятый шаг TOTP, чтобы один код нельзя было использовать дважды
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+create table if not exists schema_name.mfa_recovery_codes
+(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    used_at TIMESTAMPTZ
+);
+
+create index if not exists mfa_recovery_codes_user_id_idx on schema_name.mfa_recovery_codes (user_id);
+
+alter table schema_name.roles
+    add column if not exists mfa_required BOOLEAN NOT NULL DEFAULT false;
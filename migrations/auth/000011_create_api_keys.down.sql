@@ -0,0 +1 @@
+drop table if exists schema_name.api_keys;
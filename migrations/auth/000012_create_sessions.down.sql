@@ -0,0 +1,4 @@
+alter table schema_name.refresh_tokens
+    drop constraint if exists refresh_tokens_family_id_fkey;
+
+drop table if exists schema_name.sessions;
@@ -0,0 +1,35 @@
+-- сессия — один вход с устройства; id совпадает с family_id его refresh токенов
+create table if not exists schema_name.sessions
+(
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+create index if not exists sessions_user_id_idx on schema_name.sessions (user_id);
+
+-- входы, сделанные до появления сессий
+insert into schema_name.sessions (id, user_id, created_at, last_seen_at, revoked_at)
+select family_id,
+       min(user_id),
+       min(created_at),
+       max(created_at),
+       case when bool_and(revoked_at is not null) then max(revoked_at) end
+from schema_name.refresh_tokens
+group by family_id
+on conflict do nothing;
+
+-- миграции могут запускаться повторно, а add constraint не умеет if not exists
+do $$
+begin
+    if not exists (select 1 from pg_constraint where conname = 'refresh_tokens_family_id_fkey'
+                   and conrelid = 'schema_name.refresh_tokens'::regclass) then
+        alter table schema_name.refresh_tokens
+            add constraint refresh_tokens_family_id_fkey
+            foreign key (family_id) references schema_name.sessions(id) on delete cascade;
+    end if;
+end $$;
@@ -0,0 +1,2 @@
+alter table schema_name.users
+    drop column if exists deleted_at;
@@ -0,0 +1,3 @@
+-- удаленный аккаунт остается строкой без персональных данных, чтобы не ломать ссылки по id
+alter table schema_name.users
+    add column if not exists deleted_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+drop table if exists schema_name.oidc_auth_codes;
+drop table if exists schema_name.oidc_clients;
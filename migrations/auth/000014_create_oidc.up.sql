@@ -0,0 +1,25 @@
+-- клиенты, которые входят через auth сервис по OpenID Connect
+create table if not exists schema_name.oidc_clients
+(
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    -- у публичных клиентов (SPA, CLI) секрета нет, их защищает только PKCE
+    secret_hash VARCHAR(64),
+    redirect_uris TEXT[] NOT NULL,
+    created_by INT REFERENCES schema_name.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+create table if not exists schema_name.oidc_auth_codes
+(
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL REFERENCES schema_name.oidc_clients(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES schema_name.users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    code_challenge VARCHAR(128) NOT NULL,
+    auth_time TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
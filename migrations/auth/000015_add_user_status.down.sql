@@ -0,0 +1,8 @@
+drop index if exists schema_name.users_created_at_idx;
+drop index if exists schema_name.users_status_idx;
+
+alter table schema_name.users
+    drop column if exists suspend_reason,
+    drop column if exists suspended_by,
+    drop column if exists suspended_at,
+    drop column if exists status;
@@ -0,0 +1,10 @@
+-- приостановленный пользователь не может войти, его токены отзываются
+alter table schema_name.users
+    add column if not exists status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended')),
+    add column if not exists suspended_at TIMESTAMPTZ,
+    add column if not exists suspended_by INT REFERENCES schema_name.users(id) ON DELETE SET NULL,
+    add column if not exists suspend_reason TEXT;
+
+-- для списка пользователей в админке
+create index if not exists users_status_idx on schema_name.users (status);
+create index if not exists users_created_at_idx on schema_name.users (created_at);
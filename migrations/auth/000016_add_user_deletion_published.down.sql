@@ -0,0 +1,4 @@
+drop index if exists schema_name.users_deletion_unpublished_idx;
+
+alter table schema_name.users
+    drop column if exists deletion_published_at;
@@ -0,0 +1,6 @@
+-- события удаления аккаунта досылаются, пока не отмечены отправленными
+alter table schema_name.users
+    add column if not exists deletion_published_at TIMESTAMPTZ;
+
+create index if not exists users_deletion_unpublished_idx on schema_name.users (id)
+    where deleted_at is not null and deletion_published_at is null;
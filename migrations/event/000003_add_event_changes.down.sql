@@ -0,0 +1,4 @@
+alter table schema_name.events
+    drop column if exists cancel_reason,
+    drop column if exists cancelled_at,
+    drop column if exists updated_at;
@@ -0,0 +1,5 @@
+-- изменение и отмена событий организатором
+alter table schema_name.events
+    add column if not exists updated_at TIMESTAMPTZ,
+    add column if not exists cancelled_at TIMESTAMPTZ,
+    add column if not exists cancel_reason TEXT;
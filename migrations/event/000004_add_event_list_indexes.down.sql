@@ -0,0 +1,6 @@
+drop index if exists schema_name.events_status_idx;
+drop index if exists schema_name.events_organizer_id_idx;
+drop index if exists schema_name.events_category_idx;
+drop index if exists schema_name.events_city_idx;
+drop index if exists schema_name.events_created_at_idx;
+drop index if exists schema_name.events_start_time_idx;
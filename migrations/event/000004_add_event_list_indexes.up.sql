@@ -0,0 +1,7 @@
+-- индексы для постраничного списка событий: сортировки и фильтры GET /events/
+create index if not exists events_start_time_idx on schema_name.events (start_time, id);
+create index if not exists events_created_at_idx on schema_name.events (created_at, id);
+create index if not exists events_city_idx on schema_name.events (lower(city));
+create index if not exists events_category_idx on schema_name.events (lower(category));
+create index if not exists events_organizer_id_idx on schema_name.events (organizer_id);
+create index if not exists events_status_idx on schema_name.events (status);
@@ -0,0 +1,11 @@
+drop index if exists schema_name.events_search_text_trgm_idx;
+drop index if exists schema_name.events_search_vector_idx;
+
+drop trigger if exists events_search_update on schema_name.events;
+drop function if exists schema_name.events_search_update();
+
+alter table schema_name.events
+    drop column if exists search_text,
+    drop column if exists search_vector;
+
+drop function if exists schema_name.event_search_vector(TEXT, TEXT, TEXT, TEXT, TEXT);
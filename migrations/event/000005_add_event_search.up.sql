@@ -0,0 +1,46 @@
+create extension if not exists pg_trgm;
+
+-- полнотекстовый поиск: русская и английская конфигурации вместе, чтобы находились
+-- и "митап москва", и "go meetup moscow". Вес A — название, B — категория, город и площадка, C — описание.
+create or replace function schema_name.event_search_vector(title TEXT, description TEXT, category TEXT, city TEXT, venue TEXT)
+returns tsvector
+language sql
+immutable
+as $$
+    select setweight(to_tsvector('russian', coalesce(title, '')), 'A')
+        || setweight(to_tsvector('english', coalesce(title, '')), 'A')
+        || setweight(to_tsvector('russian', concat_ws(' ', category, city, venue)), 'B')
+        || setweight(to_tsvector('english', concat_ws(' ', category, city, venue)), 'B')
+        || setweight(to_tsvector('russian', coalesce(description, '')), 'C')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'C')
+$$;
+
+alter table schema_name.events
+    add column if not exists search_vector tsvector,
+    -- строка для поиска с опечатками по триграммам
+    add column if not exists search_text TEXT;
+
+create or replace function schema_name.events_search_update()
+returns trigger
+language plpgsql
+as $$
+begin
+    new.search_vector := schema_name.event_search_vector(new.title, new.description, new.category, new.city, new.venue);
+    new.search_text := lower(concat_ws(' ', new.title, new.category, new.city, new.venue));
+    return new;
+end
+$$;
+
+drop trigger if exists events_search_update on schema_name.events;
+create trigger events_search_update
+    before insert or update of title, description, category, city, venue
+    on schema_name.events
+    for each row
+execute function schema_name.events_search_update();
+
+update schema_name.events
+set search_vector = schema_name.event_search_vector(title, description, category, city, venue),
+    search_text = lower(concat_ws(' ', title, category, city, venue));
+
+create index if not exists events_search_vector_idx on schema_name.events using gin (search_vector);
+create index if not exists events_search_text_trgm_idx on schema_name.events using gin (search_text gin_trgm_ops);
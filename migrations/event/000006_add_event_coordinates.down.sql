@@ -0,0 +1,6 @@
+drop index if exists schema_name.events_location_idx;
+
+alter table schema_name.events
+    drop constraint if exists events_coordinates_check,
+    drop column if exists longitude,
+    drop column if exists latitude;
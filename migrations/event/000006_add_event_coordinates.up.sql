@@ -0,0 +1,25 @@
+create extension if not exists cube;
+create extension if not exists earthdistance;
+
+-- координаты места проведения: от организатора или из справочника городов и площадок
+alter table schema_name.events
+    add column if not exists latitude DOUBLE PRECISION,
+    add column if not exists longitude DOUBLE PRECISION;
+
+-- миграции могут запускаться повторно, а add constraint не умеет if not exists
+do $$
+begin
+    if not exists (select 1 from pg_constraint where conname = 'events_coordinates_check'
+                   and conrelid = 'schema_name.events'::regclass) then
+        alter table schema_name.events
+            add constraint events_coordinates_check check (
+                (latitude is null and longitude is null)
+                or (latitude between -90 and 90 and longitude between -180 and 180)
+            );
+    end if;
+end $$;
+
+-- поиск событий рядом: earth_box по этому индексу, точное расстояние — earth_distance
+create index if not exists events_location_idx on schema_name.events
+    using gist (ll_to_earth(latitude, longitude))
+    where latitude is not null and longitude is not null;
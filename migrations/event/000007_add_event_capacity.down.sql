@@ -0,0 +1,3 @@
+alter table schema_name.events
+    drop constraint if exists events_capacity_check,
+    drop column if exists capacity;
@@ -0,0 +1,12 @@
+-- вместимость события; NULL — без ограничения. Проверяется при записи в user-interaction сервисе
+alter table schema_name.events
+    add column if not exists capacity INT;
+
+do $$
+begin
+    if not exists (select 1 from pg_constraint where conname = 'events_capacity_check'
+                   and conrelid = 'schema_name.events'::regclass) then
+        alter table schema_name.events
+            add constraint events_capacity_check check (capacity > 0);
+    end if;
+end $$;
@@ -0,0 +1,19 @@
+-- лист ожидания на заполненные события. Когда освобождается место, первый в очереди получает его
+-- на claim_expires_at: место держится за ним, пока он не запишется или время не выйдет
+create table if not exists schema_name.event_waitlist
+(
+    event_id INT NOT NULL REFERENCES schema_name.events(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    promoted_at TIMESTAMPTZ,
+    claim_expires_at TIMESTAMPTZ,
+    PRIMARY KEY (event_id, user_id)
+);
+
+-- очередь события по времени записи
+create index if not exists event_waitlist_queue_idx on schema_name.event_waitlist (event_id, joined_at, user_id)
+    where promoted_at is null;
+-- истекшие приглашения для фоновой проверки
+create index if not exists event_waitlist_claim_idx on schema_name.event_waitlist (claim_expires_at)
+    where claim_expires_at is not null;
@@ -0,0 +1,30 @@
+-- у повторяющихся событий остается запись только на первое вхождение
+delete from schema_name.event_waitlist w
+using schema_name.event_occurrences o
+where o.id = w.occurrence_id
+  and o.id <> (select min(id) from schema_name.event_occurrences where event_id = o.event_id);
+delete from schema_name.event_participants p
+using schema_name.event_occurrences o
+where o.id = p.occurrence_id
+  and o.id <> (select min(id) from schema_name.event_occurrences where event_id = o.event_id);
+
+drop index if exists schema_name.event_waitlist_queue_idx;
+alter table schema_name.event_waitlist
+    drop constraint if exists event_waitlist_pkey,
+    add primary key (event_id, user_id),
+    drop column if exists occurrence_id;
+create index if not exists event_waitlist_queue_idx on schema_name.event_waitlist (event_id, joined_at, user_id)
+    where promoted_at is null;
+
+drop index if exists schema_name.event_participants_event_id_idx;
+alter table schema_name.event_participants
+    drop constraint if exists event_participants_pkey,
+    add primary key (event_id, user_id),
+    drop column if exists occurrence_id;
+
+drop table if exists schema_name.event_occurrences;
+
+alter table schema_name.events
+    drop column if exists recurrence_exdates,
+    drop column if exists recurrence_rule,
+    drop column if exists time_zone;
@@ -0,0 +1,59 @@
+-- повторяющиеся события: событие — серия с правилом RRULE, в event_occurrences — ее вхождения
+-- на горизонт вперед. У события без правила ровно одно вхождение.
+alter table schema_name.events
+    add column if not exists time_zone TEXT NOT NULL DEFAULT 'UTC',
+    add column if not exists recurrence_rule TEXT,
+    add column if not exists recurrence_exdates TIMESTAMPTZ[] NOT NULL DEFAULT '{}';
+
+create table if not exists schema_name.event_occurrences
+(
+    id SERIAL PRIMARY KEY,
+    event_id INT NOT NULL REFERENCES schema_name.events(id) ON DELETE CASCADE,
+    -- начало по правилу серии (RECURRENCE-ID), не меняется при переносе одного вхождения
+    original_start TIMESTAMPTZ NOT NULL,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    -- title и description вхождения, NULL — как у серии
+    title VARCHAR(255),
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    -- вхождение изменено отдельно: изменения серии и перегенерация его не трогают
+    modified BOOLEAN NOT NULL DEFAULT false,
+    updated_at TIMESTAMPTZ,
+    -- проверяется в конце транзакции: при сдвиге серии вхождения временно меняются местами
+    constraint event_occurrences_event_start_key unique (event_id, original_start) deferrable initially deferred
+);
+
+create index if not exists event_occurrences_start_time_idx on schema_name.event_occurrences (start_time);
+
+-- у каждого существующего события одно вхождение; on conflict не работает с отложенным unique,
+-- поэтому при повторном запуске пропускаем события, у которых вхождения уже есть
+insert into schema_name.event_occurrences (event_id, original_start, start_time, end_time, status)
+select e.id, e.start_time, e.start_time, e.end_time, case when e.status = 'cancelled' then 'cancelled' else 'active' end
+from schema_name.events e
+where not exists (select 1 from schema_name.event_occurrences o where o.event_id = e.id);
+
+-- записи и лист ожидания теперь на конкретное вхождение
+alter table schema_name.event_participants
+    add column if not exists occurrence_id INT REFERENCES schema_name.event_occurrences(id) ON DELETE CASCADE;
+update schema_name.event_participants p set occurrence_id = o.id
+from schema_name.event_occurrences o where o.event_id = p.event_id and p.occurrence_id is null;
+-- новый первичный ключ называется так же, поэтому при повторном запуске он пересоздается
+alter table schema_name.event_participants
+    alter column occurrence_id set not null,
+    drop constraint if exists event_participants_pkey,
+    add primary key (occurrence_id, user_id);
+create index if not exists event_participants_event_id_idx on schema_name.event_participants (event_id);
+
+alter table schema_name.event_waitlist
+    add column if not exists occurrence_id INT REFERENCES schema_name.event_occurrences(id) ON DELETE CASCADE;
+update schema_name.event_waitlist w set occurrence_id = o.id
+from schema_name.event_occurrences o where o.event_id = w.event_id and w.occurrence_id is null;
+alter table schema_name.event_waitlist
+    alter column occurrence_id set not null,
+    drop constraint if exists event_waitlist_pkey,
+    add primary key (occurrence_id, user_id);
+
+drop index if exists schema_name.event_waitlist_queue_idx;
+create index if not exists event_waitlist_queue_idx on schema_name.event_waitlist (occurrence_id, joined_at, user_id)
+    where promoted_at is null;
@@ -0,0 +1,6 @@
+drop table if exists schema_name.calendar_tokens;
+
+alter table schema_name.event_occurrences
+    drop column if exists sequence;
+alter table schema_name.events
+    drop column if exists sequence;
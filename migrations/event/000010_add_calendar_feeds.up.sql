@@ -0,0 +1,13 @@
+-- SEQUENCE из iCalendar: растет при каждом изменении, по нему календари понимают, что событие обновилось
+alter table schema_name.events
+    add column if not exists sequence INT NOT NULL DEFAULT 0;
+alter table schema_name.event_occurrences
+    add column if not exists sequence INT NOT NULL DEFAULT 0;
+
+-- токен подписки на календарь записей пользователя, хранится только хэш
+create table if not exists schema_name.calendar_tokens
+(
+    user_id INT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
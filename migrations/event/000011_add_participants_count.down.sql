@@ -0,0 +1,4 @@
+drop index if exists schema_name.events_participants_count_idx;
+
+alter table schema_name.events
+    drop column if exists participants_count;
@@ -0,0 +1,9 @@
+-- число участников хранится в событии: по нему сортирует popularity, и курсор не зависит от подзапроса.
+-- Поддерживается при записи и отмене записи
+alter table schema_name.events
+    add column if not exists participants_count INT NOT NULL DEFAULT 0;
+
+update schema_name.events e
+set participants_count = (SELECT count(*) FROM schema_name.event_participants p WHERE p.event_id = e.id);
+
+create index if not exists events_participants_count_idx on schema_name.events (participants_count, id);
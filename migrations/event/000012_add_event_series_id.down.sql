@@ -0,0 +1,2 @@
+alter table schema_name.events
+    drop column if exists series_id;
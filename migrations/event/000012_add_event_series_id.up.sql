@@ -0,0 +1,4 @@
+-- событие, от которого строится UID в календарях; NULL — само событие.
+-- При разделении серии новое событие получает его от старого, поэтому UID вхождений не меняется
+alter table schema_name.events
+    add column if not exists series_id INT;
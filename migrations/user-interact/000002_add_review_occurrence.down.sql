@@ -0,0 +1,4 @@
+drop index if exists schema_name.reviews_occurrence_id_idx;
+
+alter table schema_name.reviews
+    drop column if exists occurrence_id;
@@ -0,0 +1,19 @@
+-- отзыв относится к конкретному вхождению повторяющегося события.
+-- event_occurrences создается миграциями event сервиса, которые могут выполниться позже этой,
+-- поэтому внешнего ключа нет, а старые отзывы заполняются, только если таблица уже есть.
+-- Отзыв без вхождения (NULL) относится к событию целиком.
+alter table schema_name.reviews
+    add column if not exists occurrence_id INT;
+
+do $$
+begin
+    if to_regclass('schema_name.event_occurrences') is not null then
+        update schema_name.reviews r set occurrence_id = o.id
+        from schema_name.event_occurrences o
+        where o.event_id = r.event_id
+          and r.occurrence_id is null
+          and o.id = (select min(id) from schema_name.event_occurrences where event_id = r.event_id);
+    end if;
+end $$;
+
+create index if not exists reviews_occurrence_id_idx on schema_name.reviews (occurrence_id);
@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"log"
+	"strings"
 )
 
 type NotificationHandler struct {
@@ -16,16 +17,42 @@ func (h *NotificationHandler) HandleNotification(eventType string, data []byte)
 	switch eventType {
 	case "event.created":
 		handleEventCreated(data)
+	case "event.updated":
+		handleEventUpdated(data)
+	case "event.cancelled":
+		handleEventCancelled(data)
+	case "event.deleted":
+		handleEventDeleted(data)
 	case "registration.created":
 		handleRegistrationCreated(data)
 	case "review.created":
 		handleReviewCreated(data)
 	case "registration.deleted":
 		handleRegistrationDeleted(data)
+	case "registration.rejected_full":
+		handleRegistrationRejectedFull(data)
+	case "waitlist.joined":
+		handleWaitlistJoined(data)
+	case "waitlist.promoted":
+		handleWaitlistPromoted(data)
+	case "waitlist.expired":
+		handleWaitlistExpired(data)
 	case "review.updated":
 		handleReviewUpdated(data)
 	case "review.deleted":
 		handleReviewDeleted(data)
+	case "user.registered":
+		handleUserRegistered(data)
+	case "user.role_changed":
+		handleUserRoleChanged(data)
+	case "user.locked":
+		handleUserLocked(data)
+	case "user.suspended":
+		handleUserSuspended(data)
+	case "user.reactivated":
+		handleUserReactivated(data)
+	case "user.password_reset_requested":
+		handlePasswordResetRequested(data)
 	default:
 		log.Printf("⚠️ unknown event type: %s", eventType)
 	}
@@ -47,6 +74,68 @@ func handleEventCreated(data []byte) {
 		payload.EventName, payload.EventDate, payload.EventLocation, payload.Organizer)
 }
 
+// eventParticipant участник из сообщений об изменении события, уведомление уходит каждому
+type eventParticipant struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+func handleEventUpdated(data []byte) {
+	var payload struct {
+		EventID      int                `json:"event_id"`
+		EventName    string             `json:"event_name"`
+		EventDate    string             `json:"event_date"`
+		Changes      []string           `json:"changes"`
+		Participants []eventParticipant `json:"participants"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid event.updated payload: %v", err)
+		return
+	}
+
+	for _, p := range payload.Participants {
+		log.Printf("✏️ %s (ID: %d), событие \"%s\" (ID: %d) изменилось: %s. Начало: %s",
+			p.Username, p.ID, payload.EventName, payload.EventID, strings.Join(payload.Changes, ", "), payload.EventDate)
+	}
+}
+
+func handleEventCancelled(data []byte) {
+	var payload struct {
+		EventID      int                `json:"event_id"`
+		EventName    string             `json:"event_name"`
+		EventDate    string             `json:"event_date"`
+		Reason       string             `json:"reason"`
+		Participants []eventParticipant `json:"participants"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid event.cancelled payload: %v", err)
+		return
+	}
+
+	for _, p := range payload.Participants {
+		log.Printf("🚫 %s (ID: %d), событие \"%s\" (ID: %d) %s отменено. Причина: %s",
+			p.Username, p.ID, payload.EventName, payload.EventID, payload.EventDate, payload.Reason)
+	}
+}
+
+func handleEventDeleted(data []byte) {
+	var payload struct {
+		EventID      int                `json:"event_id"`
+		EventName    string             `json:"event_name"`
+		EventDate    string             `json:"event_date"`
+		Participants []eventParticipant `json:"participants"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid event.deleted payload: %v", err)
+		return
+	}
+
+	for _, p := range payload.Participants {
+		log.Printf("🗑 %s (ID: %d), событие \"%s\" (ID: %d) %s удалено организатором, ваша регистрация аннулирована",
+			p.Username, p.ID, payload.EventName, payload.EventID, payload.EventDate)
+	}
+}
+
 func handleRegistrationCreated(data []byte) {
 	var payload struct {
 		UserID    int    `json:"user_id"`
@@ -77,6 +166,63 @@ func handleRegistrationDeleted(data []byte) {
 		payload.UserID, payload.EventName, payload.EventID)
 }
 
+func handleRegistrationRejectedFull(data []byte) {
+	var payload struct {
+		UserName  string `json:"user_name"`
+		EventID   int    `json:"event_id"`
+		EventName string `json:"event_name"`
+		Capacity  int    `json:"capacity"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid registration.rejected_full payload: %v", err)
+		return
+	}
+
+	log.Printf("🚫 %s, на событие \"%s\" (ID: %d) не осталось мест (всего %d), записаться не получилось",
+		payload.UserName, payload.EventName, payload.EventID, payload.Capacity)
+}
+
+type waitlistPayload struct {
+	EventID        int    `json:"event_id"`
+	EventName      string `json:"event_name"`
+	Username       string `json:"username"`
+	Position       int    `json:"position"`
+	ClaimExpiresAt string `json:"claim_expires_at"`
+}
+
+func handleWaitlistJoined(data []byte) {
+	var payload waitlistPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid waitlist.joined payload: %v", err)
+		return
+	}
+
+	log.Printf("⏳ %s, вы в листе ожидания на событие \"%s\" (ID: %d), номер в очереди: %d",
+		payload.Username, payload.EventName, payload.EventID, payload.Position)
+}
+
+func handleWaitlistPromoted(data []byte) {
+	var payload waitlistPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid waitlist.promoted payload: %v", err)
+		return
+	}
+
+	log.Printf("🎟 %s, на событие \"%s\" (ID: %d) освободилось место. Оно ваше, если запишетесь до %s",
+		payload.Username, payload.EventName, payload.EventID, payload.ClaimExpiresAt)
+}
+
+func handleWaitlistExpired(data []byte) {
+	var payload waitlistPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid waitlist.expired payload: %v", err)
+		return
+	}
+
+	log.Printf("⌛ %s, вы не записались на событие \"%s\" (ID: %d) вовремя, место передано следующему в очереди",
+		payload.Username, payload.EventName, payload.EventID)
+}
+
 func handleReviewCreated(data []byte) {
 	var payload struct {
 		UserID   int    `json:"user_id"`
@@ -122,3 +268,93 @@ func handleReviewDeleted(data []byte) {
 
 	log.Printf("🗑 Отзыв пользователя %d на событие %d удалён", payload.UserID, payload.EventID)
 }
+
+func handlePasswordResetRequested(data []byte) {
+	var payload struct {
+		Username  string `json:"username"`
+		Email     string `json:"email"`
+		ResetURL  string `json:"reset_url"`
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid user.password_reset_requested payload: %v", err)
+		return
+	}
+
+	log.Printf("🔑 %s (%s), для сброса пароля перейдите по ссылке: %s (действует до %s)",
+		payload.Username, payload.Email, payload.ResetURL, payload.ExpiresAt)
+}
+
+func handleUserRegistered(data []byte) {
+	var payload struct {
+		Username        string `json:"username"`
+		Email           string `json:"email"`
+		VerificationURL string `json:"verification_url"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid user.registered payload: %v", err)
+		return
+	}
+
+	log.Printf("👋 %s (%s), подтвердите email по ссылке: %s",
+		payload.Username, payload.Email, payload.VerificationURL)
+}
+
+func handleUserRoleChanged(data []byte) {
+	var payload struct {
+		UserID    int    `json:"user_id"`
+		OldRole   string `json:"old_role"`
+		NewRole   string `json:"new_role"`
+		ChangedBy int    `json:"changed_by"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid user.role_changed payload: %v", err)
+		return
+	}
+
+	log.Printf("🛡 Роль пользователя %d изменена: %s → %s (администратор %d)",
+		payload.UserID, payload.OldRole, payload.NewRole, payload.ChangedBy)
+}
+
+func handleUserLocked(data []byte) {
+	var payload struct {
+		Username    string `json:"username"`
+		Email       string `json:"email"`
+		LockedUntil string `json:"locked_until"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid user.locked payload: %v", err)
+		return
+	}
+
+	log.Printf("🔒 %s (%s), в ваш аккаунт несколько раз подряд пытались войти с неверным паролем. Вход заблокирован до %s",
+		payload.Username, payload.Email, payload.LockedUntil)
+}
+
+func handleUserSuspended(data []byte) {
+	var payload struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid user.suspended payload: %v", err)
+		return
+	}
+
+	log.Printf("⛔ %s (%s), ваш аккаунт приостановлен администратором. Причина: %s",
+		payload.Username, payload.Email, payload.Reason)
+}
+
+func handleUserReactivated(data []byte) {
+	var payload struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Printf("❌ Invalid user.reactivated payload: %v", err)
+		return
+	}
+
+	log.Printf("✅ %s (%s), ваш аккаунт снова активен, можно войти", payload.Username, payload.Email)
+}
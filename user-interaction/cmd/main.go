@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"eventify/common/jwt"
 	"eventify/common/kafka"
 	"eventify/common/logger"
 	"eventify/common/postgres"
@@ -13,6 +14,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -36,11 +38,30 @@ func main() {
 	producer := kafka.NewProducer([]string{"kafka:9092"}, "events")
 	defer producer.Close()
 
-	eventService := service.NewUserInteractionService(eventRepo, producer)
-	eventHandler := handler.NewUserInteractionHandler(eventService, router, []byte(cfg.UserInteract.Secret))
+	// у каждого экземпляра своя группа, чтобы отзывы токенов доходили до всех экземпляров
+	denylist := jwt.NewDenylist()
+	hostname, _ := os.Hostname()
+	revocations := kafka.NewConsumer([]string{"kafka:9092"}, "events", "user-interaction-service-denylist-"+hostname)
+	defer revocations.Close()
+	go revocations.StartListening(ctx, denylist.HandleMessage)
+	// kafka доставляет только новые отзывы, отозванные до старта токены берем у auth сервиса
+	if err = denylist.Load(ctx, cfg.UserInteract.RevocationsURL, cfg.UserInteract.ServiceToken, 30, 2*time.Second); err != nil {
+		logger.GetLoggerFromCtx(ctx).Fatal(ctx, "failed to load revoked tokens", zap.Error(err))
+	}
+
+	eventService := service.NewUserInteractionService(eventRepo, producer, cfg.UserInteract.WaitlistClaimWindow)
+	go eventService.RunWaitlistSweeper(ctx, cfg.UserInteract.WaitlistSweepInterval)
+	keys := jwt.NewJWKS(cfg.UserInteract.JWKSURL, cfg.UserInteract.JWKSCacheTTL)
+	apiKeys := jwt.NewAPIKeyIntrospector(cfg.UserInteract.APIKeyIntrospectionURL, cfg.UserInteract.ServiceToken, cfg.UserInteract.APIKeyCacheTTL)
+	eventHandler := handler.NewUserInteractionHandler(eventService, router, keys, denylist, apiKeys)
 
 	eventHandler.RegisterRoutes()
 
+	// изменения пользователей из auth сервиса, одна группа на все экземпляры сервиса
+	users := kafka.NewConsumer([]string{"kafka:9092"}, "events", "user-interaction-service")
+	defer users.Close()
+	go users.StartListening(ctx, eventHandler.HandleMessage)
+
 	go func() {
 		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.UserInteract.Port), router); err != nil {
 			logger.GetLoggerFromCtx(ctx).Fatal(ctx, "auth service failed to start", zap.Error(err))
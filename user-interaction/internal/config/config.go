@@ -3,15 +3,28 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"eventify/common/postgres"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type UserInteractConfig struct {
-	Port          int    `yaml:"port"`
-	MigrationPath string `yaml:"migration-path"`
-	Secret        string `yaml:"secret-key"`
+	Port          int           `yaml:"port"`
+	MigrationPath string        `yaml:"migration-path"`
+	JWKSURL       string        `yaml:"jwks-url"`
+	JWKSCacheTTL  time.Duration `yaml:"jwks-cache-ttl" env-default:"10m"`
+	// APIKeyIntrospectionURL эндпоинт auth сервиса, который проверяет X-API-Key
+	APIKeyIntrospectionURL string        `yaml:"api-key-introspection-url"`
+	APIKeyCacheTTL         time.Duration `yaml:"api-key-cache-ttl" env-default:"1m"`
+	// RevocationsURL эндпоинт auth сервиса с действующими отзывами токенов, читается при старте
+	RevocationsURL string `yaml:"revocations-url" env-default:"http://auth-service:8081/auth/revocations"`
+	// ServiceToken общий секрет сервисов для внутренних эндпоинтов auth сервиса
+	ServiceToken string `yaml:"service-token" env:"SERVICE_TOKEN"`
+	// WaitlistClaimWindow сколько освободившееся место держится за первым в листе ожидания
+	WaitlistClaimWindow time.Duration `yaml:"waitlist-claim-window" env-default:"24h"`
+	// WaitlistSweepInterval как часто проверяются истекшие приглашения
+	WaitlistSweepInterval time.Duration `yaml:"waitlist-sweep-interval" env-default:"1m"`
 }
 
 type Config struct {
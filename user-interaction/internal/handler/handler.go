@@ -1,25 +1,35 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"eventify/common/jwt"
+	"eventify/common/kafka"
 	"eventify/user-interaction/internal/models"
 	"eventify/user-interaction/internal/service"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type UserInteractionHandler struct {
-	service *service.UserInteractionService
-	router  *gin.Engine
-	secret  []byte
+	service  *service.UserInteractionService
+	router   *gin.Engine
+	keys     jwt.KeySet
+	denylist *jwt.Denylist
+	apiKeys  jwt.APIKeyResolver
 }
 
-func NewUserInteractionHandler(service *service.UserInteractionService, router *gin.Engine, secret []byte) *UserInteractionHandler {
+func NewUserInteractionHandler(service *service.UserInteractionService, router *gin.Engine, keys jwt.KeySet, denylist *jwt.Denylist, apiKeys jwt.APIKeyResolver) *UserInteractionHandler {
 	return &UserInteractionHandler{
-		service: service,
-		router:  router,
-		secret:  secret,
+		service:  service,
+		router:   router,
+		keys:     keys,
+		denylist: denylist,
+		apiKeys:  apiKeys,
 	}
 }
 
@@ -34,16 +44,20 @@ func (h *UserInteractionHandler) CreateNewReviews(c *gin.Context) {
 		return
 	}
 
+	// автор отзыва берется из токена, а не из тела запроса
+	claims, _ := jwt.ClaimsFromContext(c)
+	req.UserID = uint(claims.UserId)
+	req.Username = claims.Username
+
 	// добавляем review в таблицу
-	if err := h.service.CreateNewReviews(ctx, req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if writeRegistrationError(c, h.service.CreateNewReviews(ctx, req)) {
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "review created"})
 }
 
-// GetCurrentReviewsByEventID получение review по корректному id
+// GetCurrentReviewsByEventID получение review по корректному id, ?occurrence_id= — только на одно вхождение
 func (h *UserInteractionHandler) GetCurrentReviewsByEventID(c *gin.Context) {
 	ctx := c.Request.Context()
 	//  получаем eventID
@@ -54,10 +68,15 @@ func (h *UserInteractionHandler) GetCurrentReviewsByEventID(c *gin.Context) {
 		return
 	}
 
+	occurrenceID, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
 	// составляем массив review из таблицы
 	var reviews []models.ReviewResp
 
-	if err = h.service.GetCurrentReviewsByEventID(ctx, eventId, &reviews); err != nil {
+	if err = h.service.GetCurrentReviewsByEventID(ctx, eventId, occurrenceID, &reviews); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -85,8 +104,13 @@ func (h *UserInteractionHandler) UpdateReview(c *gin.Context) {
 		return
 	}
 
+	// обновить можно только свой отзыв
+	claims, _ := jwt.ClaimsFromContext(c)
+	req.UserID = uint(claims.UserId)
+	req.Username = claims.Username
+
 	if err = h.service.UpdateReview(ctx, reviewID, req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeReviewError(c, err)
 		return
 	}
 
@@ -106,17 +130,35 @@ func (h *UserInteractionHandler) DeleteReview(c *gin.Context) {
 		return
 	}
 
+	// удалить можно свой отзыв, а с правом review:delete:any — любой
+	claims, _ := jwt.ClaimsFromContext(c)
+	anyReview := claims.HasPermission(jwt.PermReviewDeleteAny)
+	if !anyReview && !claims.HasPermission(jwt.PermReviewWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		return
+	}
+
 	// удаляем из таблицы
-	if err = h.service.DeleteReview(ctx, reviewID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err = h.service.DeleteReview(ctx, reviewID, claims.UserId, anyReview); err != nil {
+		writeReviewError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "review deleted"})
 }
 
-// RegistrationOnEvent регистрация на ивент
+// writeReviewError отвечает на ошибку изменения отзыва
+func writeReviewError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// RegistrationOnEvent регистрация на ивент, у повторяющегося — на вхождение ?occurrence_id=
 func (h *UserInteractionHandler) RegistrationOnEvent(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	// получаем id
 	eventIDParam := c.Param("id")
@@ -126,17 +168,29 @@ func (h *UserInteractionHandler) RegistrationOnEvent(c *gin.Context) {
 		return
 	}
 
-	// берем userID и userName из Header
-	if err = h.service.RegistrationOnEvent(c, eventID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	occurrenceID, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
+	// берем userID и userName из токена
+	claims, _ := jwt.ClaimsFromContext(c)
+	reg, err := h.service.RegistrationOnEvent(ctx, eventID, occurrenceID, claims.UserId, claims.Username)
+	if errors.Is(err, service.ErrEventFull) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "occurrence_id": reg.OccurrenceID, "capacity": reg.Capacity, "seats_left": reg.SeatsLeft})
+		return
+	}
+	if writeRegistrationError(c, err) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "registration on"})
+	c.JSON(http.StatusCreated, gin.H{"message": "registration on", "occurrence_id": reg.OccurrenceID, "capacity": reg.Capacity, "seats_left": reg.SeatsLeft})
 }
 
 // DeleteRegistration удаление регистрации
 func (h *UserInteractionHandler) DeleteRegistration(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	// получаем id
 	eventIDParam := c.Param("id")
 	eventID, err := strconv.Atoi(eventIDParam)
@@ -145,16 +199,102 @@ func (h *UserInteractionHandler) DeleteRegistration(c *gin.Context) {
 		return
 	}
 
-	// берем userID из Header
-	if err = h.service.DeleteRegistration(c, eventID); err != nil {
+	occurrenceID, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
+	// берем userID из токена
+	claims, _ := jwt.ClaimsFromContext(c)
+	reg, err := h.service.DeleteRegistration(ctx, eventID, occurrenceID, claims.UserId)
+	if writeRegistrationError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "delete registration on", "occurrence_id": reg.OccurrenceID, "capacity": reg.Capacity, "seats_left": reg.SeatsLeft})
+}
+
+// occurrenceParam необязательный ?occurrence_id=, 0 если его нет. При неверном значении отвечает 400 и возвращает false
+func occurrenceParam(c *gin.Context) (int, bool) {
+	param := c.Query("occurrence_id")
+	if param == "" {
+		return 0, true
+	}
+	occurrenceID, err := strconv.Atoi(param)
+	if err != nil || occurrenceID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid occurrence ID"})
+		return 0, false
+	}
+	return occurrenceID, true
+}
+
+// writeRegistrationError отвечает на ошибку записи на событие, возвращает false, если ошибки нет
+func writeRegistrationError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, service.ErrEventNotFound), errors.Is(err, service.ErrOccurrenceNotFound),
+		errors.Is(err, service.ErrNotRegistered), errors.Is(err, service.ErrNotWaitlisted):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOccurrenceRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEventCancelled), errors.Is(err, service.ErrAlreadyRegistered),
+		errors.Is(err, service.ErrSeatsAvailable), errors.Is(err, service.ErrAlreadyWaitlisted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+// JoinWaitlist встать в лист ожидания заполненного события
+func (h *UserInteractionHandler) JoinWaitlist(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	occurrenceID, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
+	claims, _ := jwt.ClaimsFromContext(c)
+	entry, err := h.service.JoinWaitlist(ctx, eventID, occurrenceID, claims.UserId, claims.Username)
+	if writeRegistrationError(c, err) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "delete registration on"})
+	c.JSON(http.StatusCreated, gin.H{"message": "joined waitlist", "occurrence_id": entry.OccurrenceID, "position": entry.Position, "joined_at": entry.JoinedAt})
 }
 
-// GetRegistration получаем зарегистрированных пользователей на event
+// LeaveWaitlist выйти из листа ожидания
+func (h *UserInteractionHandler) LeaveWaitlist(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	occurrenceID, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
+	claims, _ := jwt.ClaimsFromContext(c)
+	if writeRegistrationError(c, h.service.LeaveWaitlist(ctx, eventID, occurrenceID, claims.UserId)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "left waitlist"})
+}
+
+// GetRegistration получаем зарегистрированных пользователей на event, ?occurrence_id= — на одно вхождение
 func (h *UserInteractionHandler) GetRegistration(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -166,10 +306,15 @@ func (h *UserInteractionHandler) GetRegistration(c *gin.Context) {
 		return
 	}
 
+	occurrenceID, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
 	// и собираем все registrations
 	var registrations []models.ParticipantResp
 
-	if err = h.service.GetRegistrations(ctx, eventID, &registrations); err != nil {
+	if err = h.service.GetRegistrations(ctx, eventID, occurrenceID, &registrations); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -177,25 +322,74 @@ func (h *UserInteractionHandler) GetRegistration(c *gin.Context) {
 	c.JSON(http.StatusOK, registrations)
 }
 
+// ExportMyData данные текущего пользователя для выгрузки через /auth/me/export
+func (h *UserInteractionHandler) ExportMyData(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := jwt.ClaimsFromContext(c)
+
+	export, err := h.service.ExportUserData(ctx, claims.UserId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
 // RegisterRoutes собираем все хендлеры в одну функцию
 func (UI *UserInteractionHandler) RegisterRoutes() {
 	// user-interact
 	userInteractionRev := UI.router.Group("/user-interact")
 
 	// делаем middleware для проверки регистрации пользователя
-	userInteractionRev.Use(jwt.AuthMiddleware())
+	userInteractionRev.Use(jwt.AuthMiddleware(UI.keys, UI.denylist, UI.apiKeys))
 
-	userInteractionRev.POST("/", UI.CreateNewReviews)
+	userInteractionRev.POST("/", jwt.RequirePermission(jwt.PermReviewWrite), UI.CreateNewReviews)
 	userInteractionRev.GET("/event/:id", UI.GetCurrentReviewsByEventID)
-	userInteractionRev.PUT("/:id", UI.UpdateReview)
+	userInteractionRev.GET("/me/export", UI.ExportMyData)
+	userInteractionRev.PUT("/:id", jwt.RequirePermission(jwt.PermReviewWrite), UI.UpdateReview)
+	// права проверяются в самом хендлере: review:write для своего отзыва или review:delete:any
 	userInteractionRev.DELETE("/:id", UI.DeleteReview)
 
 	// registation
 	userInteractionRegister := UI.router.Group("/registration")
 
-	userInteractionRegister.Use(jwt.AuthMiddleware())
+	userInteractionRegister.Use(jwt.AuthMiddleware(UI.keys, UI.denylist, UI.apiKeys))
 
-	userInteractionRegister.POST("/event/:id", UI.RegistrationOnEvent)
-	userInteractionRegister.DELETE("/event/:id", UI.DeleteRegistration)
+	userInteractionRegister.POST("/event/:id", jwt.RequirePermission(jwt.PermEventRegister), UI.RegistrationOnEvent)
+	userInteractionRegister.DELETE("/event/:id", jwt.RequirePermission(jwt.PermEventRegister), UI.DeleteRegistration)
 	userInteractionRegister.GET("/event/:id", UI.GetRegistration)
+	userInteractionRegister.POST("/event/:id/waitlist", jwt.RequirePermission(jwt.PermEventRegister), UI.JoinWaitlist)
+	userInteractionRegister.DELETE("/event/:id/waitlist", jwt.RequirePermission(jwt.PermEventRegister), UI.LeaveWaitlist)
+}
+
+// HandleMessage обработчик сообщений kafka от других сервисов
+func (UI *UserInteractionHandler) HandleMessage(key, value []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch string(key) {
+	case kafka.UserUpdated:
+		var payload struct {
+			UserID   int    `json:"user_id"`
+			Username string `json:"username"`
+		}
+		if err := json.Unmarshal(value, &payload); err != nil {
+			log.Printf("invalid %s payload: %v", kafka.UserUpdated, err)
+			return
+		}
+		if err := UI.service.UpdateUsername(ctx, payload.UserID, payload.Username); err != nil {
+			log.Printf("failed to update username of user %d: %v", payload.UserID, err)
+		}
+	case kafka.UserDeleted:
+		var payload struct {
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(value, &payload); err != nil {
+			log.Printf("invalid %s payload: %v", kafka.UserDeleted, err)
+			return
+		}
+		if err := UI.service.DeleteUserData(ctx, payload.UserID); err != nil {
+			log.Printf("failed to delete data of user %d: %v", payload.UserID, err)
+		}
+	}
 }
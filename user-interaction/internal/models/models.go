@@ -5,23 +5,26 @@ import (
 	"time"
 )
 
+// ReviewReq отзыв; OccurrenceID обязателен для повторяющегося события
 type ReviewReq struct {
-	EventID  uint   `json:"event_id"`
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Rating   uint   `json:"rating"`
-	Comment  string `json:"comment"`
+	EventID      uint   `json:"event_id"`
+	OccurrenceID uint   `json:"occurrence_id"`
+	UserID       uint   `json:"user_id"`
+	Username     string `json:"username"`
+	Rating       uint   `json:"rating"`
+	Comment      string `json:"comment"`
 }
 
 type ReviewResp struct {
-	ID        uint         `json:"id"`
-	EventID   uint         `json:"event_id"`
-	UserID    uint         `json:"user_id"`
-	Username  string       `json:"username"`
-	Rating    uint         `json:"rating"`
-	Comment   string       `json:"comment"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt sql.NullTime `json:"updated_at"`
+	ID           uint         `json:"id"`
+	EventID      uint         `json:"event_id"`
+	OccurrenceID *uint        `json:"occurrence_id"`
+	UserID       uint         `json:"user_id"`
+	Username     string       `json:"username"`
+	Rating       uint         `json:"rating"`
+	Comment      string       `json:"comment"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    sql.NullTime `json:"updated_at"`
 }
 
 type RegistrationEvent struct {
@@ -30,8 +33,38 @@ type RegistrationEvent struct {
 	Username string `json:"username"`
 }
 
+// RegistrationResp результат записи на событие или ее отмены.
+// SeatsLeft и Capacity nil, если у события нет ограничения мест.
+type RegistrationResp struct {
+	EventID      uint   `json:"event_id"`
+	OccurrenceID uint   `json:"occurrence_id"`
+	EventName    string `json:"event_name"`
+	Capacity     *int   `json:"capacity"`
+	SeatsLeft    *int   `json:"seats_left"`
+}
+
+// WaitlistEntry место в листе ожидания. Position — номер в очереди при записи;
+// у приглашенных есть PromotedAt и ClaimExpiresAt — до этого времени место держится за ними.
+type WaitlistEntry struct {
+	EventID        uint       `json:"event_id"`
+	OccurrenceID   uint       `json:"occurrence_id"`
+	EventName      string     `json:"event_name"`
+	UserID         uint       `json:"user_id"`
+	Username       string     `json:"username"`
+	Position       int        `json:"position,omitempty"`
+	JoinedAt       time.Time  `json:"joined_at"`
+	PromotedAt     *time.Time `json:"promoted_at,omitempty"`
+	ClaimExpiresAt *time.Time `json:"claim_expires_at,omitempty"`
+}
+
 type ParticipantResp struct {
-	EventID  string `json:"event_id"`
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
+	EventID      string `json:"event_id"`
+	OccurrenceID uint   `json:"occurrence_id"`
+	ID           uint   `json:"id"`
+	Username     string `json:"username"`
+}
+
+// UserExport данные пользователя в user-interaction сервисе для /auth/me/export
+type UserExport struct {
+	Reviews []ReviewResp `json:"reviews"`
 }
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrOccurrenceRequired = errors.New("occurrence is required for a recurring event")
+	ErrOccurrenceNotFound = errors.New("occurrence not found")
+)
+
+// rowQuerier общий для пула и транзакции запрос одной строки
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// findOccurrence находит вхождение события и его статус. occurrenceID 0 допустим только
+// для события без повторения: у него единственное вхождение.
+func findOccurrence(ctx context.Context, q rowQuerier, eventID, occurrenceID int) (int, string, error) {
+	var (
+		id        int
+		status    string
+		recurring bool
+	)
+	err := q.QueryRow(ctx, `
+	SELECT o.id, o.status, e.recurrence_rule IS NOT NULL
+	FROM schema_name.event_occurrences o
+	JOIN schema_name.events e ON e.id = o.event_id
+	WHERE o.event_id = $1 AND ($2 = 0 OR o.id = $2)
+	ORDER BY o.original_start
+	LIMIT 1`, eventID, occurrenceID).Scan(&id, &status, &recurring)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// вхождение есть у каждого события, без него нет и события
+		if occurrenceID == 0 {
+			return 0, "", ErrEventNotFound
+		}
+		return 0, "", ErrOccurrenceNotFound
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if recurring && occurrenceID == 0 {
+		return 0, "", ErrOccurrenceRequired
+	}
+	return id, status, nil
+}
@@ -2,9 +2,21 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"eventify/user-interaction/internal/models"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
-	"eventify/user-interaction/internal/models"
+)
+
+var (
+	ErrEventNotFound     = errors.New("event not found")
+	ErrEventCancelled    = errors.New("event is cancelled")
+	ErrEventFull         = errors.New("no seats left")
+	ErrAlreadyRegistered = errors.New("already registered")
+	ErrNotRegistered     = errors.New("not registered")
+	// ErrReviewNotFound отзыва нет или он чужой
+	ErrReviewNotFound = errors.New("review not found")
 )
 
 type UserInteractionRepository struct {
@@ -17,11 +29,20 @@ func NewUserInteractionRepository(db *pgxpool.Pool) *UserInteractionRepository {
 	}
 }
 
-func (r *UserInteractionRepository) CreateNewReviews(ctx context.Context, req models.ReviewReq) error {
-	_, err := r.db.Exec(ctx, `
-	INSERT INTO schema_name.reviews (event_id, user_id, username, rating, comment, updated_at)
-	VALUES ($1, $2, $3, $4, $5, NULL)`,
+// CreateNewReviews сохраняет отзыв на вхождение req.OccurrenceID, у события без повторения его можно не указывать.
+// Найденное вхождение записывается в req.OccurrenceID.
+func (r *UserInteractionRepository) CreateNewReviews(ctx context.Context, req *models.ReviewReq) error {
+	occurrenceID, _, err := findOccurrence(ctx, r.db, int(req.EventID), int(req.OccurrenceID))
+	if err != nil {
+		return err
+	}
+	req.OccurrenceID = uint(occurrenceID)
+
+	_, err = r.db.Exec(ctx, `
+	INSERT INTO schema_name.reviews (event_id, occurrence_id, user_id, username, rating, comment, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, NULL)`,
 		req.EventID,
+		req.OccurrenceID,
 		req.UserID,
 		req.Username,
 		req.Rating,
@@ -34,19 +55,24 @@ func (r *UserInteractionRepository) CreateNewReviews(ctx context.Context, req mo
 	return nil
 }
 
-func (r *UserInteractionRepository) GetCurrentReviewsByEventID(ctx context.Context, eventId int, reviews *[]models.ReviewResp) error {
+// GetCurrentReviewsByEventID отзывы на событие; с occurrenceID отличным от 0 — только на это вхождение
+func (r *UserInteractionRepository) GetCurrentReviewsByEventID(ctx context.Context, eventId, occurrenceID int, reviews *[]models.ReviewResp) error {
 	rows, err := r.db.Query(ctx, `
-	SELECT * FROM schema_name.reviews
-	WHERE event_id = $1`, eventId)
+	SELECT id, event_id, occurrence_id, user_id, username, rating, comment, created_at, updated_at
+	FROM schema_name.reviews
+	WHERE event_id = $1 AND ($2 = 0 OR occurrence_id = $2)
+	ORDER BY created_at`, eventId, occurrenceID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var temp models.ReviewResp
 		err = rows.Scan(
 			&temp.ID,
 			&temp.EventID,
+			&temp.OccurrenceID,
 			&temp.UserID,
 			&temp.Username,
 			&temp.Rating,
@@ -59,12 +85,12 @@ func (r *UserInteractionRepository) GetCurrentReviewsByEventID(ctx context.Conte
 		*reviews = append(*reviews, temp)
 	}
 
-	return nil
+	return rows.Err()
 }
 
 func (r *UserInteractionRepository) UpdateReview(ctx context.Context, reviewID int, req models.ReviewReq) error {
 	// обновляем базу
-	_, err := r.db.Exec(ctx, `
+	tag, err := r.db.Exec(ctx, `
 	UPDATE schema_name.reviews
 	SET rating = $1, comment = $2, updated_at = $3
 	WHERE id = $4 AND username = $5 AND user_id = $6;`,
@@ -79,55 +105,247 @@ func (r *UserInteractionRepository) UpdateReview(ctx context.Context, reviewID i
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrReviewNotFound
+	}
 
 	return nil
 }
 
-func (r *UserInteractionRepository) DeleteReview(ctx context.Context, reviewID int) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM schema_name.reviews WHERE id = $1`, reviewID)
+func (r *UserInteractionRepository) DeleteReview(ctx context.Context, reviewID, userID int, anyReview bool) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM schema_name.reviews WHERE id = $1 AND (user_id = $2 OR $3)`, reviewID, userID, anyReview)
 
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrReviewNotFound
+	}
 	return nil
 }
 
-func (r *UserInteractionRepository) RegistrationOnEvent(ctx context.Context, eventID, userID int, username string) error {
-	_, err := r.db.Exec(ctx, `INSERT INTO schema_name.event_participants(event_id, user_id, username) VALUES ($1, $2, $3)`, eventID, userID, username)
+// RegistrationOnEvent записывает пользователя на вхождение события; вместимость события действует
+// для каждого вхождения отдельно. Строка события блокируется до конца транзакции,
+// поэтому одновременные записи проверяют вместимость по очереди и не превышают ее.
+// Место, которое держится за пользователем из листа ожидания, достается только ему.
+// В reg возвращаются событие, вхождение и оставшиеся места, в том числе при ErrEventFull.
+func (r *UserInteractionRepository) RegistrationOnEvent(ctx context.Context, eventID, occurrenceID, userID int, username string, reg *models.RegistrationResp) error {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	if err = lockEvent(ctx, tx, eventID, occurrenceID, reg); err != nil {
+		return err
+	}
+
+	registered, err := isRegistered(ctx, tx, reg.OccurrenceID, userID)
+	if err != nil {
+		return err
+	}
+	if registered {
+		return ErrAlreadyRegistered
+	}
+	if err = seatsLeft(ctx, tx, userID, reg); err != nil {
+		return err
+	}
+	if reg.SeatsLeft != nil && *reg.SeatsLeft == 0 {
+		return ErrEventFull
+	}
+
+	if _, err = tx.Exec(ctx, `
+	INSERT INTO schema_name.event_participants(event_id, occurrence_id, user_id, username)
+	VALUES ($1, $2, $3, $4)`, eventID, reg.OccurrenceID, userID, username); err != nil {
+		return err
+	}
+	if err = addParticipants(ctx, tx, eventID, 1); err != nil {
+		return err
+	}
+	// записавшийся больше не ждет, приглашение использовано
+	if _, err = tx.Exec(ctx, `DELETE FROM schema_name.event_waitlist WHERE occurrence_id = $1 AND user_id = $2`, reg.OccurrenceID, userID); err != nil {
+		return err
+	}
+	if reg.SeatsLeft != nil {
+		*reg.SeatsLeft--
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *UserInteractionRepository) DeleteRegistration(ctx context.Context, eventID, userID int) error {
-	_, err := r.db.Exec(ctx, `
+// DeleteRegistration отменяет запись пользователя на вхождение. Освободившееся место получает первый в листе ожидания
+// на claimWindow, он попадает в promoted. В reg возвращаются оставшиеся после этого места.
+func (r *UserInteractionRepository) DeleteRegistration(ctx context.Context, eventID, occurrenceID, userID int, claimWindow time.Duration, reg *models.RegistrationResp, promoted *[]models.WaitlistEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = lockEvent(ctx, tx, eventID, occurrenceID, reg)
+	cancelled := errors.Is(err, ErrEventCancelled)
+	if err != nil && !cancelled {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
 	DELETE FROM schema_name.event_participants
-	WHERE user_id = $1 AND event_id = $2`, userID, eventID)
+	WHERE user_id = $1 AND occurrence_id = $2`, userID, reg.OccurrenceID)
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotRegistered
+	}
+	if err = addParticipants(ctx, tx, eventID, -1); err != nil {
+		return err
+	}
+
+	// на отмененное событие никого не приглашаем
+	if !cancelled {
+		if err = promoteWaiting(ctx, tx, claimWindow, reg, promoted); err != nil {
+			return err
+		}
+	}
+	if err = seatsLeft(ctx, tx, userID, reg); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockEvent блокирует строку события до конца транзакции, читает его название и вместимость
+// и находит вхождение occurrenceID (см. findOccurrence).
+// Для отмененного события или вхождения reg заполняется, но возвращается ErrEventCancelled.
+func lockEvent(ctx context.Context, tx pgx.Tx, eventID, occurrenceID int, reg *models.RegistrationResp) error {
+	var status string
+	err := tx.QueryRow(ctx, `
+	SELECT title, status, capacity FROM schema_name.events
+	WHERE id = $1
+	FOR UPDATE`, eventID).Scan(&reg.EventName, &status, &reg.Capacity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+	reg.EventID = uint(eventID)
+
+	occurrenceID, occurrenceStatus, err := findOccurrence(ctx, tx, eventID, occurrenceID)
+	if err != nil {
+		return err
+	}
+	reg.OccurrenceID = uint(occurrenceID)
+
+	if status == "cancelled" || occurrenceStatus == "cancelled" {
+		return ErrEventCancelled
+	}
 	return nil
 }
 
-func (r *UserInteractionRepository) GetRegistrations(ctx context.Context, eventID int, registrations *[]models.ParticipantResp) error {
-	rows, err := r.db.Query(ctx, `SELECT * FROM schema_name.event_participants WHERE event_id = $1`, eventID)
-	defer rows.Close()
+// addParticipants меняет число участников события, по нему event сервис сортирует список событий
+func addParticipants(ctx context.Context, tx pgx.Tx, eventID, delta int) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE schema_name.events SET participants_count = participants_count + $2 WHERE id = $1`, eventID, delta)
+	return err
+}
+
+// isRegistered записан ли пользователь на вхождение
+func isRegistered(ctx context.Context, tx pgx.Tx, occurrenceID uint, userID int) (bool, error) {
+	var registered bool
+	err := tx.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM schema_name.event_participants WHERE occurrence_id = $1 AND user_id = $2)`,
+		occurrenceID, userID).Scan(&registered)
+	return registered, err
+}
 
+// seatsLeft свободные для userID места на вхождении reg.OccurrenceID: вместимость без участников и мест,
+// которые держатся за другими приглашенными из листа ожидания. Без ограничения мест reg.SeatsLeft остается nil.
+func seatsLeft(ctx context.Context, tx pgx.Tx, userID int, reg *models.RegistrationResp) error {
+	if reg.Capacity == nil {
+		reg.SeatsLeft = nil
+		return nil
+	}
+
+	var taken int
+	if err := tx.QueryRow(ctx, `
+	SELECT (SELECT count(*) FROM schema_name.event_participants WHERE occurrence_id = $1)
+	     + (SELECT count(*) FROM schema_name.event_waitlist
+	        WHERE occurrence_id = $1 AND user_id <> $2 AND claim_expires_at > now())`,
+		reg.OccurrenceID, userID).Scan(&taken); err != nil {
+		return err
+	}
+	left := max(*reg.Capacity-taken, 0)
+	reg.SeatsLeft = &left
+	return nil
+}
+
+// GetRegistrations записи на событие; с occurrenceID отличным от 0 — только на это вхождение
+func (r *UserInteractionRepository) GetRegistrations(ctx context.Context, eventID, occurrenceID int, registrations *[]models.ParticipantResp) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT user_id, username, event_id::text, occurrence_id
+	FROM schema_name.event_participants
+	WHERE event_id = $1 AND ($2 = 0 OR occurrence_id = $2)
+	ORDER BY occurrence_id, user_id`, eventID, occurrenceID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
 	// добавляем все в наш массив
 	for rows.Next() {
 		var temp models.ParticipantResp
-		err = rows.Scan(&temp.ID, &temp.Username, &temp.EventID)
+		err = rows.Scan(&temp.ID, &temp.Username, &temp.EventID, &temp.OccurrenceID)
 		if err != nil {
 			return err
 		}
 		*registrations = append(*registrations, temp)
 	}
 
-	return nil
+	return rows.Err()
+}
+
+// UpdateUsername обновляет копии username пользователя в отзывах
+func (r *UserInteractionRepository) UpdateUsername(ctx context.Context, userID int, username string) error {
+	_, err := r.db.Exec(ctx, `
+	UPDATE schema_name.reviews SET username = $2
+	WHERE user_id = $1 AND username IS DISTINCT FROM $2`, userID, username)
+	return err
+}
+
+// DeleteUserReviews удаляет все отзывы пользователя
+func (r *UserInteractionRepository) DeleteUserReviews(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM schema_name.reviews WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *UserInteractionRepository) GetReviewsByUserID(ctx context.Context, userID int, reviews *[]models.ReviewResp) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT id, event_id, occurrence_id, user_id, username, rating, comment, created_at, updated_at
+	FROM schema_name.reviews
+	WHERE user_id = $1
+	ORDER BY created_at`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var temp models.ReviewResp
+		err = rows.Scan(
+			&temp.ID,
+			&temp.EventID,
+			&temp.OccurrenceID,
+			&temp.UserID,
+			&temp.Username,
+			&temp.Rating,
+			&temp.Comment,
+			&temp.CreatedAt,
+			&temp.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		*reviews = append(*reviews, temp)
+	}
+	return rows.Err()
 }
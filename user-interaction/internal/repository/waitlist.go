@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"eventify/user-interaction/internal/models"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+var (
+	ErrSeatsAvailable    = errors.New("seats are available")
+	ErrAlreadyWaitlisted = errors.New("already on the waitlist")
+	ErrNotWaitlisted     = errors.New("not on the waitlist")
+)
+
+// JoinWaitlist ставит пользователя в конец листа ожидания заполненного вхождения события
+func (r *UserInteractionRepository) JoinWaitlist(ctx context.Context, eventID, occurrenceID, userID int, username string, entry *models.WaitlistEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var reg models.RegistrationResp
+	if err = lockEvent(ctx, tx, eventID, occurrenceID, &reg); err != nil {
+		return err
+	}
+
+	registered, err := isRegistered(ctx, tx, reg.OccurrenceID, userID)
+	if err != nil {
+		return err
+	}
+	if registered {
+		return ErrAlreadyRegistered
+	}
+	// ждать имеет смысл только на заполненное событие; приглашенному место уже доступно
+	if err = seatsLeft(ctx, tx, userID, &reg); err != nil {
+		return err
+	}
+	if reg.SeatsLeft == nil || *reg.SeatsLeft > 0 {
+		return ErrSeatsAvailable
+	}
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO schema_name.event_waitlist (event_id, occurrence_id, user_id, username)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT DO NOTHING
+	RETURNING joined_at`, eventID, reg.OccurrenceID, userID, username).Scan(&entry.JoinedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAlreadyWaitlisted
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow(ctx, `
+	SELECT count(*) FROM schema_name.event_waitlist
+	WHERE occurrence_id = $1 AND promoted_at IS NULL AND (joined_at, user_id) <= ($2, $3)`,
+		reg.OccurrenceID, entry.JoinedAt, userID).Scan(&entry.Position); err != nil {
+		return err
+	}
+	entry.EventID = uint(eventID)
+	entry.OccurrenceID = reg.OccurrenceID
+	entry.EventName = reg.EventName
+	entry.UserID = uint(userID)
+	entry.Username = username
+
+	return tx.Commit(ctx)
+}
+
+// LeaveWaitlist убирает пользователя из листа ожидания вхождения. Если за ним держалось место,
+// оно переходит следующему в очереди.
+func (r *UserInteractionRepository) LeaveWaitlist(ctx context.Context, eventID, occurrenceID, userID int, claimWindow time.Duration, promoted *[]models.WaitlistEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var reg models.RegistrationResp
+	err = lockEvent(ctx, tx, eventID, occurrenceID, &reg)
+	cancelled := errors.Is(err, ErrEventCancelled)
+	if err != nil && !cancelled {
+		return err
+	}
+
+	var claimExpiresAt *time.Time
+	err = tx.QueryRow(ctx, `
+	DELETE FROM schema_name.event_waitlist
+	WHERE occurrence_id = $1 AND user_id = $2
+	RETURNING claim_expires_at`, reg.OccurrenceID, userID).Scan(&claimExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotWaitlisted
+	}
+	if err != nil {
+		return err
+	}
+
+	if claimExpiresAt != nil && !cancelled {
+		if err = promoteWaiting(ctx, tx, claimWindow, &reg, promoted); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// GetOccurrencesToPromote вхождения, где истекло время хотя бы одного приглашения или есть свободные
+// места и ожидающие в очереди. Места освобождаются и без отмены записи через этот сервис,
+// например когда event сервис удаляет данные пользователя по user.deleted.
+func (r *UserInteractionRepository) GetOccurrencesToPromote(ctx context.Context, occurrenceIDs *[]int) error {
+	rows, err := r.db.Query(ctx, `
+	SELECT occurrence_id FROM schema_name.event_waitlist
+	WHERE claim_expires_at <= now()
+	UNION
+	SELECT o.id
+	FROM schema_name.event_occurrences o
+	JOIN schema_name.events e ON e.id = o.event_id
+	WHERE e.capacity IS NOT NULL AND e.status <> 'cancelled' AND o.status <> 'cancelled'
+	  AND EXISTS (SELECT 1 FROM schema_name.event_waitlist w WHERE w.occurrence_id = o.id AND w.promoted_at IS NULL)
+	  AND e.capacity > (SELECT count(*) FROM schema_name.event_participants p WHERE p.occurrence_id = o.id)
+	                 + (SELECT count(*) FROM schema_name.event_waitlist w
+	                    WHERE w.occurrence_id = o.id AND w.claim_expires_at > now())`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		*occurrenceIDs = append(*occurrenceIDs, id)
+	}
+	return rows.Err()
+}
+
+// ExpireClaims убирает из листа ожидания вхождения тех, кто не записался за отведенное время (expired),
+// и отдает их места следующим в очереди (promoted)
+func (r *UserInteractionRepository) ExpireClaims(ctx context.Context, occurrenceID int, claimWindow time.Duration, expired, promoted *[]models.WaitlistEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var eventID int
+	err = tx.QueryRow(ctx, `SELECT event_id FROM schema_name.event_occurrences WHERE id = $1`, occurrenceID).Scan(&eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// вхождение удалили вместе с листом ожидания
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var reg models.RegistrationResp
+	err = lockEvent(ctx, tx, eventID, occurrenceID, &reg)
+	cancelled := errors.Is(err, ErrEventCancelled)
+	if errors.Is(err, ErrEventNotFound) || errors.Is(err, ErrOccurrenceNotFound) {
+		// событие удалили вместе с листом ожидания
+		return nil
+	}
+	if err != nil && !cancelled {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `
+	DELETE FROM schema_name.event_waitlist
+	WHERE occurrence_id = $1 AND claim_expires_at <= now()
+	RETURNING user_id, username, joined_at, promoted_at, claim_expires_at`, reg.OccurrenceID)
+	if err != nil {
+		return err
+	}
+	if err = scanWaitlistEntries(rows, reg, expired); err != nil {
+		return err
+	}
+
+	if !cancelled {
+		if err = promoteWaiting(ctx, tx, claimWindow, &reg, promoted); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// promoteWaiting отдает свободные места вхождения reg.OccurrenceID первым в очереди: место держится за каждым claimWindow.
+// Вызывается в транзакции, где строка события уже заблокирована lockEvent.
+func promoteWaiting(ctx context.Context, tx pgx.Tx, claimWindow time.Duration, reg *models.RegistrationResp, promoted *[]models.WaitlistEntry) error {
+	if err := seatsLeft(ctx, tx, 0, reg); err != nil {
+		return err
+	}
+	if reg.SeatsLeft == nil || *reg.SeatsLeft == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `
+	UPDATE schema_name.event_waitlist
+	SET promoted_at = now(), claim_expires_at = now() + make_interval(secs => $3)
+	WHERE occurrence_id = $1 AND user_id IN (
+		SELECT user_id FROM schema_name.event_waitlist
+		WHERE occurrence_id = $1 AND promoted_at IS NULL
+		ORDER BY joined_at, user_id
+		LIMIT $2
+	)
+	RETURNING user_id, username, joined_at, promoted_at, claim_expires_at`,
+		reg.OccurrenceID, *reg.SeatsLeft, claimWindow.Seconds())
+	if err != nil {
+		return err
+	}
+	return scanWaitlistEntries(rows, *reg, promoted)
+}
+
+func scanWaitlistEntries(rows pgx.Rows, reg models.RegistrationResp, entries *[]models.WaitlistEntry) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := models.WaitlistEntry{EventID: reg.EventID, OccurrenceID: reg.OccurrenceID, EventName: reg.EventName}
+		if err := rows.Scan(&entry.UserID, &entry.Username, &entry.JoinedAt, &entry.PromotedAt, &entry.ClaimExpiresAt); err != nil {
+			return err
+		}
+		*entries = append(*entries, entry)
+	}
+	return rows.Err()
+}
@@ -3,47 +3,65 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"github.com/gin-gonic/gin"
+	"errors"
 	"eventify/common/kafka"
 	"eventify/user-interaction/internal/models"
 	"eventify/user-interaction/internal/repository"
+	"time"
+)
+
+var (
+	ErrEventNotFound     = errors.New("event not found")
+	ErrEventCancelled    = errors.New("event is cancelled")
+	ErrEventFull         = errors.New("no seats left")
+	ErrAlreadyRegistered = errors.New("already registered for this event")
+	ErrNotRegistered     = errors.New("not registered for this event")
+	// ErrOccurrenceRequired у повторяющегося события нужно указать occurrence_id
+	ErrOccurrenceRequired = errors.New("occurrence_id is required for a recurring event")
+	ErrOccurrenceNotFound = errors.New("occurrence not found")
+	// ErrReviewNotFound отзыва нет или менять его может только автор
+	ErrReviewNotFound = errors.New("review not found")
 )
 
 type UserInteractionService struct {
 	repo     *repository.UserInteractionRepository
 	producer *kafka.Producer
+	// claimWindow сколько место держится за приглашенным из листа ожидания
+	claimWindow time.Duration
 }
 
-func NewUserInteractionService(repo *repository.UserInteractionRepository, producer *kafka.Producer) *UserInteractionService {
+func NewUserInteractionService(repo *repository.UserInteractionRepository, producer *kafka.Producer, claimWindow time.Duration) *UserInteractionService {
 	return &UserInteractionService{
-		repo:     repo,
-		producer: producer,
+		repo:        repo,
+		producer:    producer,
+		claimWindow: claimWindow,
 	}
 }
 
 func (s *UserInteractionService) CreateNewReviews(ctx context.Context, req models.ReviewReq) error {
-	if err := s.repo.CreateNewReviews(ctx, req); err != nil {
-		return err
+	if err := s.repo.CreateNewReviews(ctx, &req); err != nil {
+		return registrationError(err)
 	}
 
 	payload, _ := json.Marshal(map[string]interface{}{
-		"user_id":   req.UserID,
-		"user_name": req.Username,
-		"event_id":  req.EventID,
-		"rating":    req.Rating,
-		"comment":   req.Comment,
+		"user_id":       req.UserID,
+		"user_name":     req.Username,
+		"event_id":      req.EventID,
+		"occurrence_id": req.OccurrenceID,
+		"rating":        req.Rating,
+		"comment":       req.Comment,
 	})
 
 	return s.producer.SendMessage(ctx, "review.created", payload)
 }
 
-func (s *UserInteractionService) GetCurrentReviewsByEventID(ctx context.Context, eventId int, req *[]models.ReviewResp) error {
-	return s.repo.GetCurrentReviewsByEventID(ctx, eventId, req)
+func (s *UserInteractionService) GetCurrentReviewsByEventID(ctx context.Context, eventId, occurrenceID int, req *[]models.ReviewResp) error {
+	return s.repo.GetCurrentReviewsByEventID(ctx, eventId, occurrenceID, req)
 }
 
 func (s *UserInteractionService) UpdateReview(ctx context.Context, reviewID int, req models.ReviewReq) error {
 	if err := s.repo.UpdateReview(ctx, reviewID, req); err != nil {
-		return err
+		return reviewError(err)
 	}
 
 	payload, _ := json.Marshal(map[string]interface{}{
@@ -56,57 +74,129 @@ func (s *UserInteractionService) UpdateReview(ctx context.Context, reviewID int,
 	return s.producer.SendMessage(ctx, "review.updated", payload)
 }
 
-func (s *UserInteractionService) DeleteReview(ctx context.Context, reviewID int) error {
-	// можно расширить, если нужно знать ID пользователя/события
+// DeleteReview удаляет отзыв пользователя userID; с anyReview — отзыв любого автора
+func (s *UserInteractionService) DeleteReview(ctx context.Context, reviewID, userID int, anyReview bool) error {
+	// можно расширить, если нужно знать ID события
 	payload, _ := json.Marshal(map[string]interface{}{
 		"review_id": reviewID,
+		"user_id":   userID,
 	})
 
-	if err := s.repo.DeleteReview(ctx, reviewID); err != nil {
-		return err
+	if err := s.repo.DeleteReview(ctx, reviewID, userID, anyReview); err != nil {
+		return reviewError(err)
 	}
 
 	return s.producer.SendMessage(ctx, "review.deleted", payload)
 }
 
-func (s *UserInteractionService) RegistrationOnEvent(c *gin.Context, eventId int) error {
-	ctx := c.Request.Context()
-
-	userID, _ := c.Get("userID")
-	username, _ := c.Get("username")
-	userIDint := userID.(int)
-	usernameStr := username.(string)
+// reviewError переводит ошибки репозитория по отзывам в ошибки сервиса
+func reviewError(err error) error {
+	if errors.Is(err, repository.ErrReviewNotFound) {
+		return ErrReviewNotFound
+	}
+	return err
+}
 
-	if err := s.repo.RegistrationOnEvent(ctx, eventId, userIDint, usernameStr); err != nil {
-		return err
+// RegistrationOnEvent записывает пользователя на вхождение события, если остались места.
+// occurrenceID 0 — единственное вхождение события без повторения.
+// При ErrEventFull возвращает и ответ с нулем свободных мест.
+func (s *UserInteractionService) RegistrationOnEvent(ctx context.Context, eventId, occurrenceID, userID int, username string) (models.RegistrationResp, error) {
+	var reg models.RegistrationResp
+	err := s.repo.RegistrationOnEvent(ctx, eventId, occurrenceID, userID, username, &reg)
+	if errors.Is(err, repository.ErrEventFull) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"user_id":       userID,
+			"user_name":     username,
+			"event_id":      eventId,
+			"occurrence_id": reg.OccurrenceID,
+			"event_name":    reg.EventName,
+			"capacity":      reg.Capacity,
+		})
+		if err = s.producer.SendMessage(ctx, kafka.RegistrationRejectedFull, payload); err != nil {
+			return models.RegistrationResp{}, err
+		}
+		return reg, ErrEventFull
+	}
+	if err != nil {
+		return models.RegistrationResp{}, registrationError(err)
 	}
 
 	payload, _ := json.Marshal(map[string]interface{}{
-		"user_id":   userIDint,
-		"event_id":  eventId,
-		"user_name": usernameStr,
+		"user_id":       userID,
+		"event_id":      eventId,
+		"occurrence_id": reg.OccurrenceID,
+		"event_name":    reg.EventName,
+		"user_name":     username,
+		"seats_left":    reg.SeatsLeft,
 	})
 
-	return s.producer.SendMessage(ctx, "registration.created", payload)
+	return reg, s.producer.SendMessage(ctx, kafka.RegistrationCreated, payload)
 }
 
-func (s *UserInteractionService) DeleteRegistration(c *gin.Context, eventId int) error {
-	ctx := c.Request.Context()
-	userID, _ := c.Get("userID")
-	userIDint := userID.(int)
-
-	if err := s.repo.DeleteRegistration(ctx, eventId, userIDint); err != nil {
-		return err
+// DeleteRegistration отменяет запись; освободившееся место предлагается первому в листе ожидания
+func (s *UserInteractionService) DeleteRegistration(ctx context.Context, eventId, occurrenceID, userID int) (models.RegistrationResp, error) {
+	var reg models.RegistrationResp
+	var promoted []models.WaitlistEntry
+	if err := s.repo.DeleteRegistration(ctx, eventId, occurrenceID, userID, s.claimWindow, &reg, &promoted); err != nil {
+		return models.RegistrationResp{}, registrationError(err)
+	}
+	if err := s.publishWaitlist(ctx, kafka.WaitlistPromoted, promoted); err != nil {
+		return models.RegistrationResp{}, err
 	}
 
 	payload, _ := json.Marshal(map[string]interface{}{
-		"user_id":  userIDint,
-		"event_id": eventId,
+		"user_id":       userID,
+		"event_id":      eventId,
+		"occurrence_id": reg.OccurrenceID,
+		"event_name":    reg.EventName,
+		"seats_left":    reg.SeatsLeft,
 	})
 
-	return s.producer.SendMessage(ctx, "registration.deleted", payload)
+	return reg, s.producer.SendMessage(ctx, kafka.RegistrationDeleted, payload)
+}
+
+// registrationError переводит ошибки записи из репозитория в ошибки сервиса
+func registrationError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrEventNotFound):
+		return ErrEventNotFound
+	case errors.Is(err, repository.ErrEventCancelled):
+		return ErrEventCancelled
+	case errors.Is(err, repository.ErrAlreadyRegistered):
+		return ErrAlreadyRegistered
+	case errors.Is(err, repository.ErrNotRegistered):
+		return ErrNotRegistered
+	case errors.Is(err, repository.ErrOccurrenceRequired):
+		return ErrOccurrenceRequired
+	case errors.Is(err, repository.ErrOccurrenceNotFound):
+		return ErrOccurrenceNotFound
+	case errors.Is(err, repository.ErrSeatsAvailable):
+		return ErrSeatsAvailable
+	case errors.Is(err, repository.ErrAlreadyWaitlisted):
+		return ErrAlreadyWaitlisted
+	case errors.Is(err, repository.ErrNotWaitlisted):
+		return ErrNotWaitlisted
+	}
+	return err
 }
 
-func (s *UserInteractionService) GetRegistrations(ctx context.Context, eventID int, registrations *[]models.ParticipantResp) error {
-	return s.repo.GetRegistrations(ctx, eventID, registrations)
+func (s *UserInteractionService) GetRegistrations(ctx context.Context, eventID, occurrenceID int, registrations *[]models.ParticipantResp) error {
+	return s.repo.GetRegistrations(ctx, eventID, occurrenceID, registrations)
+}
+
+func (s *UserInteractionService) UpdateUsername(ctx context.Context, userID int, username string) error {
+	return s.repo.UpdateUsername(ctx, userID, username)
+}
+
+// DeleteUserData вызывается по user.deleted; записи на события удаляет event сервис
+func (s *UserInteractionService) DeleteUserData(ctx context.Context, userID int) error {
+	return s.repo.DeleteUserReviews(ctx, userID)
+}
+
+func (s *UserInteractionService) ExportUserData(ctx context.Context, userID int) (models.UserExport, error) {
+	export := models.UserExport{Reviews: []models.ReviewResp{}}
+	if err := s.repo.GetReviewsByUserID(ctx, userID, &export.Reviews); err != nil {
+		return models.UserExport{}, err
+	}
+	return export, nil
 }
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventify/common/kafka"
+	"eventify/user-interaction/internal/models"
+	"log"
+	"time"
+)
+
+var (
+	ErrSeatsAvailable    = errors.New("seats are available, register for the event instead")
+	ErrAlreadyWaitlisted = errors.New("already on the waitlist for this event")
+	ErrNotWaitlisted     = errors.New("not on the waitlist for this event")
+)
+
+// JoinWaitlist ставит пользователя в очередь на заполненное вхождение события
+func (s *UserInteractionService) JoinWaitlist(ctx context.Context, eventID, occurrenceID, userID int, username string) (models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	if err := s.repo.JoinWaitlist(ctx, eventID, occurrenceID, userID, username, &entry); err != nil {
+		return models.WaitlistEntry{}, registrationError(err)
+	}
+	return entry, s.publishWaitlist(ctx, kafka.WaitlistJoined, []models.WaitlistEntry{entry})
+}
+
+// LeaveWaitlist убирает пользователя из очереди; место, которое держалось за ним, переходит следующему
+func (s *UserInteractionService) LeaveWaitlist(ctx context.Context, eventID, occurrenceID, userID int) error {
+	var promoted []models.WaitlistEntry
+	if err := s.repo.LeaveWaitlist(ctx, eventID, occurrenceID, userID, s.claimWindow, &promoted); err != nil {
+		return registrationError(err)
+	}
+	return s.publishWaitlist(ctx, kafka.WaitlistPromoted, promoted)
+}
+
+// ExpireClaims убирает из очередей тех, кто не записался за claimWindow, и приглашает следующих на все свободные места
+func (s *UserInteractionService) ExpireClaims(ctx context.Context) error {
+	var occurrenceIDs []int
+	if err := s.repo.GetOccurrencesToPromote(ctx, &occurrenceIDs); err != nil {
+		return err
+	}
+
+	for _, occurrenceID := range occurrenceIDs {
+		var expired, promoted []models.WaitlistEntry
+		if err := s.repo.ExpireClaims(ctx, occurrenceID, s.claimWindow, &expired, &promoted); err != nil {
+			return err
+		}
+		if err := s.publishWaitlist(ctx, kafka.WaitlistExpired, expired); err != nil {
+			return err
+		}
+		if err := s.publishWaitlist(ctx, kafka.WaitlistPromoted, promoted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunWaitlistSweeper раз в interval проверяет истекшие приглашения, пока не отменен ctx
+func (s *UserInteractionService) RunWaitlistSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ExpireClaims(ctx); err != nil {
+				log.Printf("failed to expire waitlist claims: %v", err)
+			}
+		}
+	}
+}
+
+// publishWaitlist публикует по сообщению на каждую запись листа ожидания
+func (s *UserInteractionService) publishWaitlist(ctx context.Context, key string, entries []models.WaitlistEntry) error {
+	for _, entry := range entries {
+		payload, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err = s.producer.SendMessage(ctx, key, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}